@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 )
 
 // Config содержит настройки приложения
@@ -14,6 +15,8 @@ type Config struct {
 	DBPassword string
 	DBName     string
 	JWTSecret  string
+	// SweepInterval — период проверки просроченных попыток
+	SweepInterval time.Duration
 }
 
 // LoadConfig загружает конфигурацию из переменных окружения
@@ -26,6 +29,13 @@ func LoadConfig() (*Config, error) {
 		}
 	}
 
+	sweepInterval := 30 * time.Second
+	if v := os.Getenv("ATTEMPT_SWEEP_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			sweepInterval = d
+		}
+	}
+
 	config := &Config{
 		DBHost:     getEnv("DB_HOST", "localhost"),
 		DBPort:     port,
@@ -33,6 +43,8 @@ func LoadConfig() (*Config, error) {
 		DBPassword: getEnv("DB_PASSWORD", ""),
 		DBName:     getEnv("DB_NAME", ""),
 		JWTSecret:  getEnv("JWT_SECRET", ""),
+
+		SweepInterval: sweepInterval,
 	}
 
 	if config.DBUser == "" {
@@ -0,0 +1,313 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles содержит миграции схемы вида NNNN_name.up.sql и NNNN_name.down.sql
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey — ключ pg_advisory_lock, под которым реплики по очереди применяют миграции
+const migrationLockKey = 4216003
+
+// Migration описывает одну миграцию схемы
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+	// Checksum — SHA-256 скрипта Up; по нему обнаруживается правка уже применённой миграции
+	Checksum string
+}
+
+// MigrationStatus описывает состояние миграции в БД
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	// Drift — применённая миграция отличается от встроенной или отсутствует в этой сборке
+	Drift bool
+}
+
+// appliedMigration — запись из schema_migrations
+type appliedMigration struct {
+	version   int
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// LoadMigrations читает встроенные миграции и проверяет, что номера идут подряд с 1
+// и у каждой есть скрипты up и down
+func LoadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		file := e.Name()
+		base, direction := strings.TrimSuffix(file, ".up.sql"), "up"
+		if base == file {
+			base, direction = strings.TrimSuffix(file, ".down.sql"), "down"
+		}
+		number, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if base == file || !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name %s", file)
+		}
+		body, err := migrationFiles.ReadFile(path.Join("migrations", file))
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has different names: %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			sum := sha256.Sum256(body)
+			m.Up, m.Checksum = string(body), hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(body)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both up and down scripts", m.Version, m.Name)
+		}
+	}
+	return migrations, nil
+}
+
+// MigrateUp применяет все неприменённые миграции и возвращает их число.
+// Если применённая миграция была изменена или неизвестна этой сборке, ничего не применяется
+func MigrateUp(db *sql.DB) (int, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	applied := 0
+	err = withMigrationLock(db, func(conn *sql.Conn) error {
+		done, err := checkedMigrations(conn, migrations)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+			err := inMigrationTx(conn, func(tx *sql.Tx) error {
+				if _, err := tx.Exec(m.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(`
+					INSERT INTO schema_migrations (version, name, checksum, applied_at)
+					VALUES ($1, $2, $3, $4)
+				`, m.Version, m.Name, m.Checksum, time.Now())
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+			log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown откатывает steps последних применённых миграций и возвращает их число
+func MigrateDown(db *sql.DB, steps int) (int, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	reverted := 0
+	err = withMigrationLock(db, func(conn *sql.Conn) error {
+		done, err := checkedMigrations(conn, migrations)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && reverted < steps; i-- {
+			m := migrations[i]
+			if _, ok := done[m.Version]; !ok {
+				continue
+			}
+			err := inMigrationTx(conn, func(tx *sql.Tx) error {
+				if _, err := tx.Exec(m.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = $1", m.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+			log.Printf("Reverted migration %04d_%s", m.Version, m.Name)
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// MigrationStatuses возвращает состояние встроенных миграций и применённых миграций,
+// которых нет в этой сборке
+func MigrationStatuses(db *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	var statuses []MigrationStatus
+	err = withMigrationLock(db, func(conn *sql.Conn) error {
+		done, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			s := MigrationStatus{Version: m.Version, Name: m.Name}
+			if a, ok := done[m.Version]; ok {
+				appliedAt := a.appliedAt
+				s.AppliedAt = &appliedAt
+				s.Drift = a.checksum != m.Checksum
+				delete(done, m.Version)
+			}
+			statuses = append(statuses, s)
+		}
+		for _, a := range done {
+			appliedAt := a.appliedAt
+			statuses = append(statuses, MigrationStatus{Version: a.version, Name: a.name, AppliedAt: &appliedAt, Drift: true})
+		}
+		return nil
+	})
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, err
+}
+
+// withMigrationLock выполняет fn на отдельном соединении под advisory-блокировкой,
+// предварительно создав таблицу schema_migrations
+func withMigrationLock(db *sql.DB, fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockKey)
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// inMigrationTx выполняет fn в транзакции на соединении conn
+func inMigrationTx(conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// appliedMigrations читает schema_migrations
+func appliedMigrations(conn *sql.Conn) (map[int]appliedMigration, error) {
+	rows, err := conn.QueryContext(context.Background(), "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	done := make(map[int]appliedMigration)
+	for rows.Next() {
+		var a appliedMigration
+		if err := rows.Scan(&a.version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		done[a.version] = a
+	}
+	return done, rows.Err()
+}
+
+// checkedMigrations читает применённые миграции и сверяет их со встроенными.
+// БД, созданная старым init/migrations.sql без schema_migrations, считается
+// находящейся на первой миграции
+func checkedMigrations(conn *sql.Conn, migrations []Migration) (map[int]appliedMigration, error) {
+	done, err := appliedMigrations(conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(done) == 0 {
+		var legacy bool
+		err := conn.QueryRowContext(context.Background(), "SELECT to_regclass('public.users') IS NOT NULL").Scan(&legacy)
+		if err != nil {
+			return nil, err
+		}
+		if legacy {
+			m := migrations[0]
+			a := appliedMigration{version: m.Version, name: m.Name, checksum: m.Checksum, appliedAt: time.Now()}
+			_, err := conn.ExecContext(context.Background(), `
+				INSERT INTO schema_migrations (version, name, checksum, applied_at)
+				VALUES ($1, $2, $3, $4)
+			`, a.version, a.name, a.checksum, a.appliedAt)
+			if err != nil {
+				return nil, err
+			}
+			log.Printf("Existing schema found, marked migration %04d_%s as applied", m.Version, m.Name)
+			done[a.version] = a
+		}
+	}
+	known := make(map[int]Migration, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+	for version, a := range done {
+		m, ok := known[version]
+		if !ok {
+			return nil, fmt.Errorf("database has migration %04d_%s unknown to this build", version, a.name)
+		}
+		if a.checksum != m.Checksum {
+			return nil, fmt.Errorf("migration %04d_%s was changed after it had been applied (checksum mismatch)", version, m.Name)
+		}
+	}
+	return done, nil
+}
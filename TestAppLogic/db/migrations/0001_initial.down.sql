@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS answers;
+DROP TABLE IF EXISTS attempts;
+DROP TABLE IF EXISTS questions;
+DROP TABLE IF EXISTS tests;
+DROP TABLE IF EXISTS user_courses;
+DROP TABLE IF EXISTS courses;
+DROP TABLE IF EXISTS users;
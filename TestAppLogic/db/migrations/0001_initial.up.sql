@@ -72,4 +72,4 @@ CREATE INDEX idx_questions_test_id ON questions(test_id);
 CREATE INDEX idx_attempts_user_id ON attempts(user_id);
 CREATE INDEX idx_attempts_test_id ON attempts(test_id);
 CREATE INDEX idx_answers_attempt_id ON answers(attempt_id);
-CREATE INDEX idx_answers_question_id ON answers(question_id);
\ No newline at end of file
+CREATE INDEX idx_answers_question_id ON answers(question_id);
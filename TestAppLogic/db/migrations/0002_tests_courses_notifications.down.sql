@@ -0,0 +1,19 @@
+DROP TABLE notifications;
+DROP TABLE survey_participants;
+DROP TABLE course_invites;
+
+ALTER TABLE courses DROP COLUMN deleted_at;
+
+ALTER TABLE tests
+    DROP COLUMN kind,
+    DROP COLUMN anonymous,
+    DROP COLUMN allow_review,
+    DROP COLUMN time_limit_seconds,
+    DROP COLUMN opens_at,
+    DROP COLUMN closes_at,
+    DROP COLUMN max_attempts,
+    DROP COLUMN cooldown_seconds,
+    DROP COLUMN grading_policy,
+    DROP COLUMN shuffle_questions,
+    DROP COLUMN shuffle_options,
+    DROP COLUMN deleted_at;
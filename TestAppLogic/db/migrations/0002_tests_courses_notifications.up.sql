@@ -0,0 +1,53 @@
+-- Настройки тестов: вид, разбор, расписание, пересдачи, перемешивание и мягкое удаление
+ALTER TABLE tests
+    ADD COLUMN kind VARCHAR(20) NOT NULL DEFAULT 'quiz' CHECK (kind IN ('quiz', 'survey')),
+    ADD COLUMN anonymous BOOLEAN DEFAULT false,
+    ADD COLUMN allow_review BOOLEAN DEFAULT false,
+    ADD COLUMN time_limit_seconds INTEGER CHECK (time_limit_seconds > 0),
+    ADD COLUMN opens_at TIMESTAMP,
+    ADD COLUMN closes_at TIMESTAMP,
+    ADD COLUMN max_attempts INTEGER CHECK (max_attempts > 0),
+    ADD COLUMN cooldown_seconds INTEGER CHECK (cooldown_seconds > 0),
+    ADD COLUMN grading_policy VARCHAR(20) NOT NULL DEFAULT 'best' CHECK (grading_policy IN ('best', 'last', 'average', 'first')),
+    ADD COLUMN shuffle_questions BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN shuffle_options BOOLEAN NOT NULL DEFAULT false,
+    -- Время удаления; попытки и ответы удалённого теста сохраняются до восстановления
+    ADD COLUMN deleted_at TIMESTAMP;
+
+-- Время удаления; удалённая дисциплина скрыта, но её можно восстановить
+ALTER TABLE courses ADD COLUMN deleted_at TIMESTAMP;
+
+-- Таблица кодов приглашения на дисциплины
+CREATE TABLE course_invites (
+    code VARCHAR(32) PRIMARY KEY,
+    course_id INTEGER REFERENCES courses(id) ON DELETE CASCADE,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    max_uses INTEGER,
+    uses INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Таблица участников анонимных опросов: фиксирует факт прохождения,
+-- не связывая пользователя с его ответами
+CREATE TABLE survey_participants (
+    test_id INTEGER REFERENCES tests(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (test_id, user_id)
+);
+
+-- Таблица уведомлений
+CREATE TABLE notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,
+    message TEXT NOT NULL,
+    is_read BOOLEAN DEFAULT false,
+    delivered_at TIMESTAMP,
+    read_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_course_invites_course_id ON course_invites(course_id);
+CREATE INDEX idx_notifications_user_unread ON notifications(user_id) WHERE is_read = false;
@@ -0,0 +1,30 @@
+-- Вопрос возвращается в первый тест, в который он входит; вопросы вне тестов
+-- и ключи, не являющиеся индексом варианта, при откате теряются
+ALTER TABLE questions ADD COLUMN test_id INTEGER REFERENCES tests(id) ON DELETE CASCADE;
+
+UPDATE questions q SET test_id = (
+    SELECT MIN(tq.test_id) FROM test_questions tq WHERE tq.question_id = q.id
+);
+
+DELETE FROM questions WHERE test_id IS NULL;
+
+DROP TABLE test_pools;
+DROP TABLE test_questions;
+DROP TABLE question_versions;
+
+ALTER TABLE questions
+    ALTER COLUMN correct_answer TYPE INTEGER USING CASE
+        WHEN jsonb_typeof(correct_answer) = 'number' THEN (correct_answer #>> '{}')::INTEGER
+        ELSE 0
+    END,
+    ALTER COLUMN correct_answer SET NOT NULL,
+    ALTER COLUMN options DROP DEFAULT,
+    DROP COLUMN course_id,
+    DROP COLUMN kind,
+    DROP COLUMN type,
+    DROP COLUMN matches,
+    DROP COLUMN tags,
+    DROP COLUMN version,
+    DROP COLUMN deleted_at;
+
+CREATE INDEX idx_questions_test_id ON questions(test_id);
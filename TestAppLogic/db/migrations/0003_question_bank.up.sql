@@ -0,0 +1,65 @@
+-- Вопросы переезжают из тестов в банк дисциплины; kind — вид тестов,
+-- в которые можно включить вопрос
+ALTER TABLE questions
+    ADD COLUMN course_id INTEGER REFERENCES courses(id) ON DELETE CASCADE,
+    ADD COLUMN kind VARCHAR(20) NOT NULL DEFAULT 'quiz' CHECK (kind IN ('quiz', 'survey')),
+    ADD COLUMN type VARCHAR(20) NOT NULL DEFAULT 'single',
+    ADD COLUMN matches TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}',
+    -- Номер текущей версии; содержимое всех версий хранится в question_versions
+    ADD COLUMN version INTEGER NOT NULL DEFAULT 1,
+    -- Время удаления; удалённый вопрос пропадает из банка и тестов, но ответы на него сохраняются
+    ADD COLUMN deleted_at TIMESTAMP,
+    ALTER COLUMN options SET DEFAULT '{}',
+    ALTER COLUMN correct_answer DROP NOT NULL,
+    ALTER COLUMN correct_answer TYPE JSONB USING to_jsonb(correct_answer);
+
+UPDATE questions q SET course_id = t.course_id FROM tests t WHERE t.id = q.test_id;
+
+-- Версии вопросов: каждое изменение вопроса сохраняется отдельной версией
+CREATE TABLE question_versions (
+    question_id INTEGER REFERENCES questions(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    text TEXT NOT NULL,
+    options TEXT[] NOT NULL DEFAULT '{}',
+    matches TEXT[] NOT NULL DEFAULT '{}',
+    correct_answer JSONB,
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (question_id, version)
+);
+
+INSERT INTO question_versions (question_id, version, type, text, options, matches, correct_answer, tags, created_at)
+SELECT id, version, type, text, options, matches, correct_answer, tags, created_at FROM questions;
+
+-- Состав тестов: вопросы банка с порядком и весом в каждом тесте
+CREATE TABLE test_questions (
+    test_id INTEGER REFERENCES tests(id) ON DELETE CASCADE,
+    question_id INTEGER REFERENCES questions(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    points DOUBLE PRECISION NOT NULL DEFAULT 1 CHECK (points > 0),
+    PRIMARY KEY (test_id, question_id)
+);
+
+INSERT INTO test_questions (test_id, question_id, position)
+SELECT test_id, id, ROW_NUMBER() OVER (PARTITION BY test_id ORDER BY id)
+FROM questions
+WHERE test_id IS NOT NULL;
+
+-- Пулы теста: сколько случайных вопросов банка с тегом добавить в каждую попытку
+CREATE TABLE test_pools (
+    id SERIAL PRIMARY KEY,
+    test_id INTEGER REFERENCES tests(id) ON DELETE CASCADE,
+    tag TEXT NOT NULL,
+    count INTEGER NOT NULL CHECK (count > 0),
+    points DOUBLE PRECISION NOT NULL DEFAULT 1 CHECK (points > 0)
+);
+
+DROP INDEX idx_questions_test_id;
+ALTER TABLE questions DROP COLUMN test_id;
+
+CREATE INDEX idx_questions_course_id ON questions(course_id);
+CREATE INDEX idx_questions_tags ON questions USING GIN (tags);
+CREATE INDEX idx_test_questions_question_id ON test_questions(question_id);
+CREATE INDEX idx_test_pools_test_id ON test_pools(test_id);
@@ -0,0 +1,19 @@
+DROP TABLE answer_revisions;
+
+ALTER TABLE answers
+    DROP CONSTRAINT answers_attempt_id_question_id_key,
+    DROP COLUMN is_correct,
+    DROP COLUMN revision,
+    DROP COLUMN updated_at,
+    ALTER COLUMN answer TYPE INTEGER USING CASE
+        WHEN jsonb_typeof(answer) = 'number' THEN (answer #>> '{}')::INTEGER
+    END;
+
+DROP TABLE attempt_questions;
+
+ALTER TABLE attempts
+    DROP COLUMN score,
+    DROP COLUMN max_score,
+    DROP COLUMN percentage,
+    DROP COLUMN expires_at,
+    DROP COLUMN completed_at;
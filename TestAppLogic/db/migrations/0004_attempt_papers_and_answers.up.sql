@@ -0,0 +1,56 @@
+-- Результаты и сроки попыток
+ALTER TABLE attempts
+    ADD COLUMN score DOUBLE PRECISION,
+    ADD COLUMN max_score DOUBLE PRECISION,
+    ADD COLUMN percentage DOUBLE PRECISION,
+    ADD COLUMN expires_at TIMESTAMP,
+    ADD COLUMN completed_at TIMESTAMP;
+
+-- Вариант попытки: вопросы, выпавшие студенту, их версии, порядок, веса и порядок вариантов.
+-- Ответы проверяются по версии вопроса из варианта.
+-- option_order[i] — исходный индекс варианта, показанного i-м; NULL — без перемешивания
+CREATE TABLE attempt_questions (
+    attempt_id INTEGER REFERENCES attempts(id) ON DELETE CASCADE,
+    question_id INTEGER REFERENCES questions(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL DEFAULT 1,
+    position INTEGER NOT NULL,
+    points DOUBLE PRECISION NOT NULL DEFAULT 1,
+    option_order INTEGER[],
+    PRIMARY KEY (attempt_id, question_id),
+    FOREIGN KEY (question_id, version) REFERENCES question_versions(question_id, version)
+);
+
+-- Вариантом существующих попыток считается состав теста
+INSERT INTO attempt_questions (attempt_id, question_id, version, position, points)
+SELECT a.id, tq.question_id, 1, tq.position, tq.points
+FROM attempts a
+JOIN test_questions tq ON tq.test_id = a.test_id;
+
+-- На вопрос попытки остаётся один ответ — последний
+DELETE FROM answers a
+USING answers b
+WHERE a.attempt_id = b.attempt_id AND a.question_id = b.question_id AND a.id < b.id;
+
+ALTER TABLE answers
+    ALTER COLUMN answer TYPE JSONB USING to_jsonb(answer),
+    ADD COLUMN is_correct BOOLEAN,
+    ADD COLUMN revision INTEGER NOT NULL DEFAULT 1,
+    ADD COLUMN updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    ADD CONSTRAINT answers_attempt_id_question_id_key UNIQUE (attempt_id, question_id);
+
+UPDATE answers SET updated_at = created_at;
+
+-- История изменений ответов
+CREATE TABLE answer_revisions (
+    answer_id INTEGER REFERENCES answers(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    answer JSONB,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (answer_id, revision)
+);
+
+INSERT INTO answer_revisions (answer_id, revision, answer, created_at)
+SELECT id, revision, answer, created_at FROM answers;
+
+CREATE INDEX idx_attempt_questions_question_id ON attempt_questions(question_id);
+CREATE INDEX idx_attempts_expires_at ON attempts(expires_at) WHERE finished = false;
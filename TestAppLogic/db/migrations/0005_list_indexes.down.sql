@@ -0,0 +1,3 @@
+DROP INDEX idx_questions_course_created_at;
+DROP INDEX idx_tests_course_created_at;
+DROP INDEX idx_courses_created_at;
@@ -0,0 +1,4 @@
+-- Индексы для постраничной выдачи списков по ключу (колонка сортировки, id)
+CREATE INDEX idx_courses_created_at ON courses(created_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX idx_tests_course_created_at ON tests(course_id, created_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX idx_questions_course_created_at ON questions(course_id, created_at, id) WHERE deleted_at IS NULL;
@@ -0,0 +1 @@
+ALTER TABLE tests DROP COLUMN deleted_with_course;
@@ -0,0 +1,8 @@
+-- Тесты, скрытые удалением дисциплины, помечаются явно: RestoreCourse возвращает
+-- только их, а не тесты, удалённые раньше отдельно
+ALTER TABLE tests ADD COLUMN deleted_with_course BOOLEAN NOT NULL DEFAULT false;
+
+-- Раньше такие тесты узнавались по совпадению времени удаления с дисциплиной
+UPDATE tests t SET deleted_with_course = true
+FROM courses c
+WHERE c.id = t.course_id AND c.deleted_at IS NOT NULL AND t.deleted_at = c.deleted_at;
@@ -0,0 +1 @@
+DROP INDEX idx_attempts_one_active;
@@ -0,0 +1,10 @@
+-- У пользователя не больше одной незавершённой попытки по тесту. Лишние незавершённые
+-- попытки, оставшиеся от одновременных запросов, закрываются без оценки: остаётся новейшая
+UPDATE attempts a SET finished = true, completed_at = CURRENT_TIMESTAMP
+WHERE a.finished = false AND a.user_id IS NOT NULL AND EXISTS(
+    SELECT 1 FROM attempts b
+    WHERE b.user_id = a.user_id AND b.test_id = a.test_id AND b.finished = false
+        AND b.id > a.id
+);
+
+CREATE UNIQUE INDEX idx_attempts_one_active ON attempts(user_id, test_id) WHERE finished = false;
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testapplogic/models"
+)
+
+var (
+	// aikenOption — вариант ответа Aiken: «A. текст» или «A) текст»
+	aikenOption = regexp.MustCompile(`^([A-Z])[.)]\s+(.*)$`)
+	// aikenAnswerLine — строка с правильным ответом, завершающая вопрос
+	aikenAnswerLine = regexp.MustCompile(`(?m)^ANSWER:\s*(.*)$`)
+)
+
+// parseAiken разбирает вопросы в формате Aiken: текст вопроса, варианты с буквами
+// и строка ANSWER: с буквой правильного варианта. Несколько букв через запятую
+// дают вопрос с несколькими правильными ответами
+func parseAiken(text string) []importedQuestion {
+	var items []importedQuestion
+	var textLines []string
+	var options []string
+	var letters []string
+	reset := func() {
+		textLines, options, letters = nil, nil, nil
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if m := aikenAnswerLine.FindStringSubmatch(line); m != nil {
+			items = append(items, aikenQuestion(strings.Join(textLines, "\n"), options, letters, m[1]))
+			reset()
+			continue
+		}
+		if m := aikenOption.FindStringSubmatch(line); m != nil && len(textLines) > 0 {
+			letters = append(letters, m[1])
+			options = append(options, strings.TrimSpace(m[2]))
+			continue
+		}
+		// Текст после вариантов означает, что у предыдущего вопроса не было строки ANSWER:
+		if len(options) > 0 {
+			item := importedQuestion{question: models.Question{Text: strings.Join(textLines, "\n")}}
+			item.err = errors.New("ANSWER: line is missing")
+			items = append(items, item)
+			reset()
+		}
+		textLines = append(textLines, line)
+	}
+	if len(textLines) > 0 {
+		item := importedQuestion{question: models.Question{Text: strings.Join(textLines, "\n")}}
+		item.err = errors.New("ANSWER: line is missing")
+		items = append(items, item)
+	}
+	return items
+}
+
+// aikenQuestion строит вопрос Aiken по вариантам и строке ответа
+func aikenQuestion(text string, options, letters []string, answer string) importedQuestion {
+	item := importedQuestion{question: models.Question{Text: text}}
+	answers := make([]importAnswer, len(options))
+	for i, o := range options {
+		answers[i] = importAnswer{text: o}
+	}
+	for _, letter := range strings.Split(answer, ",") {
+		letter = strings.ToUpper(strings.TrimSpace(letter))
+		found := false
+		for i, l := range letters {
+			if l == letter {
+				answers[i].weight = 100
+				found = true
+			}
+		}
+		if !found {
+			item.err = errors.New("ANSWER: " + letter + " does not match any option")
+			return item
+		}
+	}
+	q, err := choiceQuestion(text, answers, nil)
+	item.question, item.err = q, err
+	return item
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"testapplogic/models"
+	"testing"
+)
+
+func TestParseAiken(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []wantImport
+	}{
+		{"single", "Столица Франции?\nA. Париж\nB. Лион\nANSWER: A\n", []wantImport{{
+			typ: models.QuestionSingle, text: "Столица Франции?", options: []string{"Париж", "Лион"}, key: 0,
+		}}},
+		{"parenthesis letters and CRLF", "2 + 2?\r\nA) 3\r\nB) 4\r\nANSWER: B\r\n", []wantImport{{
+			typ: models.QuestionSingle, text: "2 + 2?", options: []string{"3", "4"}, key: 1,
+		}}},
+		{"several answers", "Чётные числа\nA. 1\nB. 2\nC. 4\nANSWER: B, c\n", []wantImport{{
+			typ: models.QuestionMultiple, text: "Чётные числа", options: []string{"1", "2", "4"}, key: []int{1, 2},
+		}}},
+		{"two questions", "Первый\nA. да\nB. нет\nANSWER: A\n\nВторой\nA. да\nB. нет\nANSWER: B\n", []wantImport{
+			{typ: models.QuestionSingle, text: "Первый", options: []string{"да", "нет"}, key: 0},
+			{typ: models.QuestionSingle, text: "Второй", options: []string{"да", "нет"}, key: 1},
+		}},
+		{"multiline text", "Строка один\nстрока два\nA. да\nB. нет\nANSWER: A\n", []wantImport{{
+			typ: models.QuestionSingle, text: "Строка один\nстрока два", options: []string{"да", "нет"}, key: 0,
+		}}},
+		{"unknown letter", "Вопрос\nA. да\nB. нет\nANSWER: C\n", []wantImport{{err: true}}},
+		{"missing answer before next question", "Первый\nA. да\nВторой\nA. да\nANSWER: A\n", []wantImport{
+			{err: true},
+			{typ: models.QuestionSingle, text: "Второй", options: []string{"да"}, key: 0},
+		}},
+		{"missing answer at end", "Вопрос\nA. да\nB. нет\n", []wantImport{{err: true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := parseAiken(tt.text)
+			if len(items) != len(tt.want) {
+				t.Fatalf("got %d questions, want %d", len(items), len(tt.want))
+			}
+			for i, want := range tt.want {
+				checkImported(t, items[i], want)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"testapplogic/models"
+	"testapplogic/store"
+
+	"github.com/gorilla/mux"
+)
+
+// itemGroupShare — доля попыток в верхней и нижней группах для индекса дискриминативности
+const itemGroupShare = 0.27
+
+// itemResponse — ответ попытки на вопрос для анализа
+type itemResponse struct {
+	answer  json.RawMessage
+	correct bool
+	seconds float64
+}
+
+// analyzedAttempt — завершённая попытка с ответами по ID вопроса.
+// presented — вопросы варианта попытки; nil означает, что попытке выдавались все вопросы
+type analyzedAttempt struct {
+	id        int
+	total     float64
+	items     map[int]itemResponse
+	presented map[int]bool
+}
+
+// sawQuestion проверяет, выпадал ли вопрос в варианте попытки
+func (a analyzedAttempt) sawQuestion(questionID int) bool {
+	return a.presented == nil || a.presented[questionID]
+}
+
+// analyzedAttempts отбирает оценённые попытки теста с ответами. Время ответа считается
+// от предыдущего ответа в попытке (для первого — от начала попытки) до первой отправки ответа
+func analyzedAttempts(finished []store.AttemptAnswers) []analyzedAttempt {
+	var attempts []analyzedAttempt
+	for _, f := range finished {
+		if f.Attempt.Score == nil {
+			continue
+		}
+		a := analyzedAttempt{id: f.Attempt.ID, items: make(map[int]itemResponse, len(f.Answers))}
+		prev := f.Attempt.CreatedAt
+		for _, ans := range f.Answers {
+			r := itemResponse{
+				answer:  ans.Answer,
+				correct: ans.IsCorrect != nil && *ans.IsCorrect,
+				seconds: ans.CreatedAt.Sub(prev).Seconds(),
+			}
+			prev = ans.CreatedAt
+			a.items[ans.QuestionID] = r
+		}
+		if len(f.Presented) > 0 {
+			a.presented = make(map[int]bool, len(f.Presented))
+			for _, id := range f.Presented {
+				a.presented[id] = true
+			}
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts
+}
+
+// samePaper проверяет, что все попытки получили одинаковый набор вопросов
+func samePaper(attempts []analyzedAttempt, questions []models.Question) bool {
+	for _, a := range attempts {
+		for _, q := range questions {
+			if !a.sawQuestion(q.ID) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// selectedOptions возвращает индексы вариантов, выбранных в ответе на вопрос с вариантами
+func selectedOptions(q models.Question, raw json.RawMessage) []int {
+	switch q.Type {
+	case models.QuestionSingle:
+		var idx int
+		if json.Unmarshal(raw, &idx) == nil {
+			return []int{idx}
+		}
+	case models.QuestionMultiple:
+		var idx []int
+		if json.Unmarshal(raw, &idx) == nil {
+			return idx
+		}
+	case models.QuestionTrueFalse:
+		// true соответствует первому варианту
+		var value bool
+		if json.Unmarshal(raw, &value) == nil {
+			if value {
+				return []int{0}
+			}
+			return []int{1}
+		}
+	}
+	return nil
+}
+
+// roundStat округляет статистику до четырёх знаков
+func roundStat(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
+
+// analyzeTest считает статистику вопросов и надёжность теста. Доли по вопросу считаются
+// от числа попыток, которым он выпадал; при случайных вариантах KR-20 не рассчитывается
+func analyzeTest(testID int, questions []models.Question, attempts []analyzedAttempt) models.TestAnalytics {
+	result := models.TestAnalytics{TestID: testID, Attempts: len(attempts), Questions: []models.ItemAnalysis{}}
+	n := len(attempts)
+	// Итоговый балл считаем по текущему набору вопросов
+	for i := range attempts {
+		attempts[i].total = 0
+		for _, q := range questions {
+			if attempts[i].items[q.ID].correct {
+				attempts[i].total++
+			}
+		}
+	}
+	var variance float64
+	if n > 0 {
+		var sum float64
+		for _, a := range attempts {
+			sum += a.total
+		}
+		result.MeanScore = sum / float64(n)
+		for _, a := range attempts {
+			variance += (a.total - result.MeanScore) * (a.total - result.MeanScore)
+		}
+		variance /= float64(n)
+		result.MeanScore = roundStat(result.MeanScore)
+		result.StdDev = roundStat(math.Sqrt(variance))
+	}
+	// Верхняя и нижняя группы по итоговому баллу
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return attempts[order[i]].total > attempts[order[j]].total })
+	groupSize := int(math.Round(itemGroupShare * float64(n)))
+	if groupSize < 1 && n >= 2 {
+		groupSize = 1
+	}
+	upper, lower := order[:groupSize], order[n-groupSize:]
+
+	var sumPQ float64
+	for _, q := range questions {
+		item := models.ItemAnalysis{QuestionID: q.ID, Type: q.Type, Text: q.Text}
+		keyOptions := selectedOptions(q, q.CorrectAnswer)
+		correctOption := make([]bool, len(q.Options))
+		for _, i := range keyOptions {
+			if i >= 0 && i < len(correctOption) {
+				correctOption[i] = true
+			}
+		}
+		counts := make([]int, len(q.Options))
+		var correct, shown int
+		var seconds float64
+		for _, a := range attempts {
+			if !a.sawQuestion(q.ID) {
+				continue
+			}
+			shown++
+			r, ok := a.items[q.ID]
+			if !ok {
+				continue
+			}
+			item.Answered++
+			seconds += r.seconds
+			if r.correct {
+				correct++
+			}
+			for _, i := range selectedOptions(q, r.answer) {
+				if i >= 0 && i < len(counts) {
+					counts[i]++
+				}
+			}
+		}
+		if shown > 0 {
+			p := float64(correct) / float64(shown)
+			sumPQ += p * (1 - p)
+			p = roundStat(p)
+			item.Difficulty = &p
+		}
+		if item.Answered > 0 {
+			avg := roundStat(seconds / float64(item.Answered))
+			item.AvgTimeSeconds = &avg
+		}
+		if groupSize > 0 && shown > 0 {
+			d := roundStat(groupShareCorrect(attempts, upper, q.ID) - groupShareCorrect(attempts, lower, q.ID))
+			item.Discrimination = &d
+		}
+		// Распределение по вариантам строится для вопросов с выбором ответа
+		if keyOptions != nil {
+			for i, option := range q.Options {
+				item.Options = append(item.Options, models.OptionStat{
+					Option:     option,
+					Correct:    correctOption[i],
+					Count:      counts[i],
+					Percentage: percentage(float64(counts[i]), float64(shown)),
+					UpperCount: groupOptionCount(attempts, upper, q, i),
+					LowerCount: groupOptionCount(attempts, lower, q, i),
+				})
+			}
+		}
+		result.Questions = append(result.Questions, item)
+	}
+	// KR-20 имеет смысл при двух и более вопросах и ненулевом разбросе баллов
+	if k := float64(len(questions)); k >= 2 && n >= 2 && variance > 0 && samePaper(attempts, questions) {
+		kr20 := roundStat(k / (k - 1) * (1 - sumPQ/variance))
+		result.KR20 = &kr20
+	}
+	return result
+}
+
+// groupShareCorrect возвращает долю правильных ответов на вопрос в группе попыток,
+// которым он выпадал
+func groupShareCorrect(attempts []analyzedAttempt, group []int, questionID int) float64 {
+	correct, shown := 0, 0
+	for _, i := range group {
+		if !attempts[i].sawQuestion(questionID) {
+			continue
+		}
+		shown++
+		if attempts[i].items[questionID].correct {
+			correct++
+		}
+	}
+	if shown == 0 {
+		return 0
+	}
+	return float64(correct) / float64(shown)
+}
+
+// groupOptionCount считает, сколько раз вариант выбран в группе попыток
+func groupOptionCount(attempts []analyzedAttempt, group []int, q models.Question, option int) int {
+	count := 0
+	for _, i := range group {
+		r, ok := attempts[i].items[q.ID]
+		if !ok {
+			continue
+		}
+		for _, selected := range selectedOptions(q, r.answer) {
+			if selected == option {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// GetTestAnalytics возвращает анализ вопросов теста: трудность, дискриминативность,
+// распределение выбора вариантов, среднее время ответа и надёжность теста (KR-20)
+func (h *DBHandler) GetTestAnalytics(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid test ID")
+		return
+	}
+	t, err := h.Store.Test(testID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Test not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if !CheckCourseAccess(h.Store, r, t.CourseID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+		return
+	}
+	if t.Kind == models.TestKindSurvey {
+		WriteError(w, r, http.StatusBadRequest, CodeSurveyNotGraded, "Survey responses are not graded, use survey results")
+		return
+	}
+	questions, err := h.Store.PresentedQuestions(testID)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	finished, err := h.Store.FinishedAttempts(testID)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	attempts := analyzedAttempts(finished)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(analyzeTest(testID, questions, attempts))
+}
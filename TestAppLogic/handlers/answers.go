@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testapplogic/models"
+	"testapplogic/store"
+
+	"github.com/gorilla/mux"
+)
+
+// GetAnswerHistory возвращает историю изменений ответов попытки.
+// Доступна владельцу попытки и преподавателю курса; ?question_id= сужает выборку до одного вопроса
+func (h *DBHandler) GetAnswerHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	attemptID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid attempt ID")
+		return
+	}
+	userID, ok := GetUserID(r)
+	if !ok {
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "User not authenticated")
+		return
+	}
+	var questionID int
+	if s := r.URL.Query().Get("question_id"); s != "" {
+		if questionID, err = strconv.Atoi(s); err != nil {
+			WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid question ID")
+			return
+		}
+	}
+	a, t, err := attemptTest(h.Store, attemptID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Attempt not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if a.UserID != userID && !CheckCourseAccess(h.Store, r, t.CourseID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+		return
+	}
+	history, err := h.Store.AnswerRevisions(attemptID, questionID)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if history == nil {
+		history = []models.AnswerRevision{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
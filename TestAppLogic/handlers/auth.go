@@ -2,14 +2,13 @@ package handlers
 
 import (
 	"context"
-	"database/sql"
 	"log"
 	"net/http"
 	"strings"
+	"testapplogic/store"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/lib/pq"
 )
 
 var jwtSecret []byte
@@ -20,12 +19,12 @@ func InitAuth(secret string) {
 }
 
 // AuthMiddleware проверяет JWT-токен и кладёт user_id и user_id_reference в контекст запроса
-func AuthMiddleware(db *sql.DB) func(http.Handler) http.Handler {
+func AuthMiddleware(users store.UserStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
-				http.Error(w, "Authorization header is required", http.StatusUnauthorized)
+				WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Authorization header is required")
 				return
 			}
 
@@ -38,20 +37,20 @@ func AuthMiddleware(db *sql.DB) func(http.Handler) http.Handler {
 			})
 
 			if err != nil || !token.Valid {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				WriteError(w, r, http.StatusUnauthorized, CodeInvalidToken, "Invalid token")
 				return
 			}
 
 			claims, ok := token.Claims.(jwt.MapClaims)
 			if !ok {
-				http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+				WriteError(w, r, http.StatusUnauthorized, CodeInvalidToken, "Invalid token claims")
 				return
 			}
 
 			// Получаем user_id из токена (это email, строка)
 			userIDRef, ok := claims["user_id"].(string)
 			if !ok {
-				http.Error(w, "User ID not found in token", http.StatusUnauthorized)
+				WriteError(w, r, http.StatusUnauthorized, CodeInvalidToken, "User ID not found in token")
 				return
 			}
 
@@ -64,7 +63,7 @@ func AuthMiddleware(db *sql.DB) func(http.Handler) http.Handler {
 			// Получаем разрешения из токена
 			permissions, ok := claims["permissions"].([]interface{})
 			if !ok {
-				http.Error(w, "Permissions not found in token", http.StatusUnauthorized)
+				WriteError(w, r, http.StatusUnauthorized, CodeInvalidToken, "Permissions not found in token")
 				return
 			}
 
@@ -77,21 +76,9 @@ func AuthMiddleware(db *sql.DB) func(http.Handler) http.Handler {
 			}
 
 			// Ищем или создаём пользователя по user_id_reference
-			var userID int
-			err = db.QueryRow("SELECT id FROM users WHERE user_id_reference = $1", userIDRef).Scan(&userID)
-			if err == sql.ErrNoRows {
-				// Создаём нового пользователя
-				err = db.QueryRow(`
-					INSERT INTO users (user_id_reference, full_name, roles, created_at)
-					VALUES ($1, $2, $3, $4)
-					RETURNING id
-				`, userIDRef, username, pq.Array([]string{"Student"}), time.Now()).Scan(&userID)
-				if err != nil {
-					http.Error(w, "Failed to create user in database", http.StatusInternalServerError)
-					return
-				}
-			} else if err != nil {
-				http.Error(w, "Database error during user lookup", http.StatusInternalServerError)
+			userID, err := users.EnsureUser(userIDRef, username)
+			if err != nil {
+				WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error during user lookup")
 				return
 			}
 
@@ -136,7 +123,7 @@ func CheckPermission(r *http.Request, requiredPermission string) bool {
 
 // CheckCourseAccess проверяет, имеет ли пользователь доступ к курсу
 // (либо как студент, либо как преподаватель)
-func CheckCourseAccess(db *sql.DB, r *http.Request, courseID int) bool {
+func CheckCourseAccess(courses store.CourseStore, r *http.Request, courseID int) bool {
 	userID, ok := GetUserID(r)
 	if !ok {
 		return false
@@ -144,50 +131,81 @@ func CheckCourseAccess(db *sql.DB, r *http.Request, courseID int) bool {
 
 	// Сначала проверяем базовые разрешения
 	if CheckPermission(r, "course:userList") || CheckPermission(r, "course:testList") {
-		var exists bool
-		err := db.QueryRow(`
-			SELECT EXISTS(
-				SELECT 1 FROM user_courses
-				WHERE user_id = $1 AND course_id = $2
-			) OR EXISTS(
-				SELECT 1 FROM courses
-				WHERE id = $2 AND teacher_id = $1
-			)
-		`, userID, courseID).Scan(&exists)
+		exists, err := courses.HasCourseAccess(userID, courseID)
 		return err == nil && exists
 	}
 
 	return false
 }
 
+// CheckCourseMembership проверяет, записан ли пользователь на дисциплину
+// (в отличие от CheckCourseAccess не требует разрешений преподавателя)
+func CheckCourseMembership(courses store.CourseStore, r *http.Request, courseID int) bool {
+	userID, ok := GetUserID(r)
+	if !ok {
+		return false
+	}
+	exists, err := courses.IsCourseMember(userID, courseID)
+	return err == nil && exists
+}
+
+// CheckTeacherAccess проверяет, что пользователь ведёт дисциплину: владелец или
+// участник с ролью teacher. Запись студентом на чужую дисциплину её не даёт,
+// даже если у пользователя есть разрешения преподавателя
+func CheckTeacherAccess(courses store.CourseStore, r *http.Request, courseID int) bool {
+	if !CheckCourseAccess(courses, r, courseID) {
+		return false
+	}
+	userID, _ := GetUserID(r)
+	teacher, err := courses.IsCourseTeacher(userID, courseID)
+	return err == nil && teacher
+}
+
 // CheckTestAccess проверяет доступ к тесту и его вопросам
-func CheckTestAccess(db *sql.DB, r *http.Request, testID int) bool {
+func CheckTestAccess(s store.Store, r *http.Request, testID int) bool {
 	if !CheckPermission(r, "course:test:read") {
 		return false
 	}
 
-	var courseID int
-	err := db.QueryRow("SELECT course_id FROM tests WHERE id = $1", testID).Scan(&courseID)
+	t, err := s.Test(testID)
 	if err != nil {
 		return false
 	}
 
-	return CheckCourseAccess(db, r, courseID)
+	return CheckCourseAccess(s, r, t.CourseID)
 }
 
 // CheckQuestionAccess проверяет доступ к вопросу
-func CheckQuestionAccess(db *sql.DB, r *http.Request, questionID int) bool {
+func CheckQuestionAccess(s store.Store, r *http.Request, questionID int) bool {
 	if !CheckPermission(r, "quest:read") {
 		return false
 	}
 
-	var testID int
-	err := db.QueryRow("SELECT test_id FROM questions WHERE id = $1", questionID).Scan(&testID)
+	q, err := s.Question(questionID)
 	if err != nil {
 		return false
 	}
 
-	return CheckTestAccess(db, r, testID)
+	return CheckCourseAccess(s, r, q.CourseID)
+}
+
+// CheckAuthorAccess проверяет, может ли пользователь редактировать вопросы курса
+// и видеть правильные ответы
+func CheckAuthorAccess(courses store.CourseStore, r *http.Request, courseID int) bool {
+	if !CheckPermission(r, "quest:create") && !CheckPermission(r, "quest:update") {
+		return false
+	}
+	return CheckTeacherAccess(courses, r, courseID)
+}
+
+// HasQuestionAttempt проверяет, выпадал ли вопрос пользователю в одной из его попыток
+func HasQuestionAttempt(attempts store.AttemptStore, r *http.Request, questionID int) bool {
+	userID, ok := GetUserID(r)
+	if !ok {
+		return false
+	}
+	exists, err := attempts.HasQuestionAttempt(userID, questionID)
+	return err == nil && exists
 }
 
 // CheckAdminAccess проверяет права администратора
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testapplogic/models"
+	"testapplogic/store"
+
+	"github.com/gorilla/mux"
+)
+
+// normalizeTags приводит теги к нижнему регистру, убирает пустые и повторяющиеся
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	result := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// testForComposition загружает тест и проверяет право менять его состав
+func (h *DBHandler) testForComposition(w http.ResponseWriter, r *http.Request) (models.Test, bool) {
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid test ID")
+		return models.Test{}, false
+	}
+	t, err := h.Store.Test(testID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Test not found")
+		return models.Test{}, false
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return models.Test{}, false
+	}
+	if !CheckAuthorAccess(h.Store, r, t.CourseID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+		return models.Test{}, false
+	}
+	return t, true
+}
+
+// checkBankQuestion проверяет, что вопрос есть в банке дисциплины и подходит тесту по виду
+func checkBankQuestion(s store.Store, questionID, courseID int, kind string) error {
+	q, err := s.Question(questionID)
+	if err == store.ErrNotFound || (err == nil && (q.DeletedAt != nil || q.CourseID != courseID)) {
+		return errors.New("Question " + strconv.Itoa(questionID) + " not found in the course bank")
+	} else if err != nil {
+		return err
+	}
+	if q.Kind != kind {
+		return errors.New("Question " + strconv.Itoa(questionID) + " is a " + q.Kind + " question and cannot be used in a " + kind)
+	}
+	return nil
+}
+
+// SearchCourseQuestions ищет вопросы в банке дисциплины.
+// Параметры: ?q= — подстрока текста, ?tag= (можно несколько, нужны все),
+// ?type= — тип вопроса, ?kind=quiz|survey — вид тестов, а также общие параметры
+// списков (см. listOptions; sort=id|created_at, по умолчанию id)
+func (h *DBHandler) SearchCourseQuestions(w http.ResponseWriter, r *http.Request) {
+	courseID, ok := h.courseIDFromVars(w, r, "quest:list:read")
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	var errs fieldErrors
+	filter := store.QuestionFilter{
+		ListOptions: listOptions(r, []string{"id", "created_at"}, "id", &errs),
+		CourseID:    courseID,
+		Tags:        normalizeTags(query["tag"]),
+		Type:        query.Get("type"),
+		Kind:        query.Get("kind"),
+	}
+	if err := errs.err(); err != nil {
+		writeInvalid(w, r, err)
+		return
+	}
+	questions, next, err := h.Store.CourseQuestions(filter)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if questions == nil {
+		questions = []models.Question{}
+	}
+	writePage(w, r, questions, next)
+}
+
+// GetTestQuestions возвращает вопросы теста с ключами, порядком и весами
+func (h *DBHandler) GetTestQuestions(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.testForComposition(w, r)
+	if !ok {
+		return
+	}
+	questions, err := h.Store.TestQuestions(t.ID)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if questions == nil {
+		questions = []models.Question{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(questions)
+}
+
+// AddTestQuestion добавляет вопрос из банка в тест.
+// Тело: {"question_id": 1, "position": 2, "points": 1.5}; без position вопрос идёт в конец
+func (h *DBHandler) AddTestQuestion(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.testForComposition(w, r)
+	if !ok {
+		return
+	}
+	testID := t.ID
+	var input struct {
+		QuestionID int     `json:"question_id"`
+		Position   int     `json:"position"`
+		Points     float64 `json:"points"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if input.Points == 0 {
+		input.Points = 1
+	}
+	if input.Points < 0 {
+		writeInvalid(w, r, invalidField("points", "points must be positive"))
+		return
+	}
+	if err := checkBankQuestion(h.Store, input.QuestionID, t.CourseID, t.Kind); err != nil {
+		writeInvalid(w, r, err)
+		return
+	}
+	position, err := h.Store.LinkQuestion(testID, input.QuestionID, input.Position, input.Points)
+	if err == store.ErrQuestionLinked {
+		WriteError(w, r, http.StatusConflict, CodeQuestionInTest, "Question is already in the test")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"test_id":     testID,
+		"question_id": input.QuestionID,
+		"position":    position,
+		"points":      input.Points,
+	})
+}
+
+// SetTestQuestions задаёт состав теста целиком: порядок вопросов и их веса.
+// Тело: {"questions": [{"question_id": 3, "points": 2}, {"question_id": 1}]}.
+// Вопросы, которых нет в списке, убираются из теста, но остаются в банке
+func (h *DBHandler) SetTestQuestions(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.testForComposition(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Questions []struct {
+			QuestionID int     `json:"question_id"`
+			Points     float64 `json:"points"`
+		} `json:"questions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	list := make([]store.TestQuestion, 0, len(input.Questions))
+	seen := make(map[int]bool, len(input.Questions))
+	for _, item := range input.Questions {
+		if seen[item.QuestionID] {
+			WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Duplicate question_id "+strconv.Itoa(item.QuestionID))
+			return
+		}
+		seen[item.QuestionID] = true
+		if item.Points == 0 {
+			item.Points = 1
+		}
+		if item.Points < 0 {
+			writeInvalid(w, r, invalidField("points", "points must be positive"))
+			return
+		}
+		if err := checkBankQuestion(h.Store, item.QuestionID, t.CourseID, t.Kind); err != nil {
+			writeInvalid(w, r, err)
+			return
+		}
+		list = append(list, store.TestQuestion{QuestionID: item.QuestionID, Points: item.Points})
+	}
+	tx, err := h.Store.Begin()
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction error")
+		return
+	}
+	defer tx.Rollback()
+	if err := tx.SetTestQuestions(t.ID, list); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	questions, err := tx.TestQuestions(t.ID)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction commit failed")
+		return
+	}
+	if questions == nil {
+		questions = []models.Question{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(questions)
+}
+
+// RemoveTestQuestion убирает вопрос из теста, оставляя его в банке дисциплины
+func (h *DBHandler) RemoveTestQuestion(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.testForComposition(w, r)
+	if !ok {
+		return
+	}
+	questionID, err := strconv.Atoi(mux.Vars(r)["question_id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid question ID")
+		return
+	}
+	err = h.Store.UnlinkQuestion(t.ID, questionID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotInTest, "Question is not in the test")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Question removed from test"})
+}
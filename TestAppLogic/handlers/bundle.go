@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"testapplogic/models"
+	"testapplogic/store"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// maxBundleSize ограничивает размер импортируемого пакета теста
+const maxBundleSize = 20 << 20
+
+// mediaURL находит внешние ссылки в текстах вопросов
+var mediaURL = regexp.MustCompile(`https?://[^\s"'<>()\[\]]+`)
+
+// bundleMedia собирает ссылки на медиафайлы из текстов и вариантов вопросов
+func bundleMedia(questions []models.BundleQuestion) []string {
+	seen := make(map[string]bool)
+	var media []string
+	add := func(s string) {
+		for _, u := range mediaURL.FindAllString(s, -1) {
+			if !seen[u] {
+				seen[u] = true
+				media = append(media, u)
+			}
+		}
+	}
+	for _, q := range questions {
+		add(q.Text)
+		for _, o := range q.Options {
+			add(o)
+		}
+		for _, m := range q.Matches {
+			add(m)
+		}
+	}
+	sort.Strings(media)
+	return media
+}
+
+// bundleQuestion переводит вопрос в вид для пакета
+func bundleQuestion(q models.Question, inTest bool) models.BundleQuestion {
+	bq := models.BundleQuestion{
+		ID:            q.ID,
+		Type:          q.Type,
+		Text:          q.Text,
+		Options:       q.Options,
+		Matches:       q.Matches,
+		CorrectAnswer: q.CorrectAnswer,
+		Tags:          q.Tags,
+		InTest:        inTest,
+	}
+	if inTest {
+		bq.Points = q.Points
+	}
+	return bq
+}
+
+// Форматы переноса теста
+const (
+	bundleJSON = "json"
+	bundleQTI  = "qti"
+)
+
+// bundleFormat читает формат пакета из ?format=; по умолчанию — JSON
+func bundleFormat(w http.ResponseWriter, r *http.Request) (string, bool) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = bundleJSON
+	}
+	if format != bundleJSON && format != bundleQTI {
+		writeInvalid(w, r, invalidField("format", "format must be json or qti"))
+		return "", false
+	}
+	return format, true
+}
+
+// buildTestBundle собирает пакет теста: настройки, вопросы с ключами,
+// пулы вместе с вопросами банка, из которых они выбирают, и ссылки на медиафайлы
+func buildTestBundle(s store.Store, t models.Test) (models.TestBundle, error) {
+	bundle := models.TestBundle{
+		Version:    models.TestBundleVersion,
+		ExportedAt: time.Now(),
+		Test: models.BundleTest{
+			Name:             t.Name,
+			Kind:             t.Kind,
+			Anonymous:        t.Anonymous,
+			AllowReview:      t.AllowReview,
+			TimeLimit:        t.TimeLimit,
+			OpensAt:          t.OpensAt,
+			ClosesAt:         t.ClosesAt,
+			MaxAttempts:      t.MaxAttempts,
+			Cooldown:         t.Cooldown,
+			GradingPolicy:    t.GradingPolicy,
+			ShuffleQuestions: t.ShuffleQuestions,
+			ShuffleOptions:   t.ShuffleOptions,
+		},
+		Questions: []models.BundleQuestion{},
+		Pools:     []models.BundlePool{},
+	}
+	questions, err := s.TestQuestions(t.ID)
+	if err != nil {
+		return bundle, err
+	}
+	inTest := make([]int, len(questions))
+	for i, question := range questions {
+		bundle.Questions = append(bundle.Questions, bundleQuestion(question, true))
+		inTest[i] = question.ID
+	}
+	pools, err := s.TestPools(t.ID)
+	if err != nil {
+		return bundle, err
+	}
+	for _, p := range pools {
+		bundle.Pools = append(bundle.Pools, models.BundlePool{Tag: p.Tag, Count: p.Count, Points: p.Points})
+	}
+	// Вопросы банка, из которых пулы выбирают вопросы в попытки
+	if len(pools) > 0 {
+		candidates, err := s.PoolCandidates(t.CourseID, t.Kind, poolTags(pools), inTest)
+		if err != nil {
+			return bundle, err
+		}
+		for _, question := range candidates {
+			bundle.Questions = append(bundle.Questions, bundleQuestion(question, false))
+		}
+	}
+	bundle.Media = bundleMedia(bundle.Questions)
+	return bundle, nil
+}
+
+// ExportTestBundle выгружает тест в переносимый пакет: JSON (?format=json, по умолчанию)
+// или пакет IMS QTI 2.1 (?format=qti)
+func (h *DBHandler) ExportTestBundle(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid test ID")
+		return
+	}
+	format, ok := bundleFormat(w, r)
+	if !ok {
+		return
+	}
+	t, err := h.Store.Test(testID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Test not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	// Пакет содержит ключи, поэтому его могут получить только авторы курса
+	if !CheckAuthorAccess(h.Store, r, t.CourseID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+		return
+	}
+	bundle, err := buildTestBundle(h.Store, t)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if format == bundleQTI {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="test-%d-qti.zip"`, testID))
+		if err := writeQTIPackage(w, testID, bundle); err != nil {
+			log.Printf("QTI export of test %d failed: %v", testID, err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="test-%d.json"`, testID))
+	json.NewEncoder(w).Encode(bundle)
+}
+
+// validateBundle проверяет пакет теста по правилам создания тестов и вопросов
+// и приводит значения по умолчанию. Возвращает вопросы и пулы, готовые к сохранению
+func validateBundle(b *models.TestBundle) ([]models.Question, []models.QuestionPool, error) {
+	if b.Version <= 0 {
+		return nil, nil, errors.New("version is required")
+	}
+	if b.Version > models.TestBundleVersion {
+		return nil, nil, fmt.Errorf("bundle version %d is not supported, latest is %d", b.Version, models.TestBundleVersion)
+	}
+	t := &b.Test
+	if t.Name == "" {
+		return nil, nil, errors.New("test.name is required")
+	}
+	if t.Kind == "" {
+		t.Kind = models.TestKindQuiz
+	}
+	if t.Kind != models.TestKindQuiz && t.Kind != models.TestKindSurvey {
+		return nil, nil, errors.New("test.kind must be quiz or survey")
+	}
+	if t.Anonymous && t.Kind != models.TestKindSurvey {
+		return nil, nil, errors.New("Only surveys can be anonymous")
+	}
+	if err := validateSchedule(t.TimeLimit, t.OpensAt, t.ClosesAt); err != nil {
+		return nil, nil, errors.New("test: " + err.Error())
+	}
+	if t.GradingPolicy == "" {
+		t.GradingPolicy = models.GradingBest
+	}
+	if err := validatePolicy(t.MaxAttempts, t.Cooldown, t.GradingPolicy); err != nil {
+		return nil, nil, errors.New("test: " + err.Error())
+	}
+	questions := make([]models.Question, len(b.Questions))
+	seen := make(map[int]bool, len(b.Questions))
+	for i, bq := range b.Questions {
+		if bq.ID <= 0 || seen[bq.ID] {
+			return nil, nil, fmt.Errorf("questions[%d]: id must be positive and unique", i)
+		}
+		seen[bq.ID] = true
+		if bq.Points < 0 {
+			return nil, nil, fmt.Errorf("questions[%d]: points must be positive", i)
+		}
+		q := models.Question{
+			Kind:          t.Kind,
+			Type:          bq.Type,
+			Text:          bq.Text,
+			Options:       bq.Options,
+			Matches:       bq.Matches,
+			CorrectAnswer: bq.CorrectAnswer,
+			Tags:          normalizeTags(bq.Tags),
+			Points:        bq.Points,
+		}
+		if err := validateQuestion(&q, t.Kind); err != nil {
+			return nil, nil, fmt.Errorf("questions[%d]: %s", i, err.Error())
+		}
+		if bq.InTest && q.Points == 0 {
+			q.Points = 1
+		}
+		questions[i] = q
+	}
+	pools := bundlePools(b.Pools)
+	if err := validatePools(pools); err != nil {
+		return nil, nil, errors.New("pools: " + err.Error())
+	}
+	return questions, pools, nil
+}
+
+// bundlePools переводит пулы пакета в пулы теста
+func bundlePools(pools []models.BundlePool) []models.QuestionPool {
+	result := make([]models.QuestionPool, len(pools))
+	for i, p := range pools {
+		result[i] = models.QuestionPool{Tag: p.Tag, Count: p.Count, Points: p.Points}
+	}
+	return result
+}
+
+// ImportTestBundle создаёт в дисциплине тест из пакета ExportTestBundle: JSON или
+// пакета QTI 2.1 (?format=qti; ZIP-архив распознаётся и без параметра).
+// Вопросы создаются в банке дисциплины заново; в ответе — новый тест и соответствие
+// ID вопросов пакета новым ID. Тест создаётся неактивным; настройки теста из пакета,
+// как и при CreateTest, требуют course:test:write
+func (h *DBHandler) ImportTestBundle(w http.ResponseWriter, r *http.Request) {
+	courseID, ok := h.courseIDFromVars(w, r, "quest:create")
+	if !ok {
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBundleSize))
+	if err != nil {
+		WriteError(w, r, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Bundle is too large")
+		return
+	}
+	var bundle models.TestBundle
+	if r.URL.Query().Get("format") == bundleQTI || bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		if bundle, err = readQTIPackage(data); err != nil {
+			WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Invalid QTI package: "+err.Error())
+			return
+		}
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&bundle); err != nil {
+			WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Invalid bundle: "+err.Error())
+			return
+		}
+	}
+	questions, pools, err := validateBundle(&bundle)
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Invalid bundle: "+err.Error())
+		return
+	}
+	bt := bundle.Test
+	tx, err := h.Store.Begin()
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction error")
+		return
+	}
+	defer tx.Rollback()
+	now := time.Now()
+	t := models.Test{
+		CourseID:         courseID,
+		Name:             bt.Name,
+		Kind:             bt.Kind,
+		Anonymous:        bt.Anonymous,
+		AllowReview:      bt.AllowReview,
+		TimeLimit:        bt.TimeLimit,
+		OpensAt:          bt.OpensAt,
+		ClosesAt:         bt.ClosesAt,
+		MaxAttempts:      bt.MaxAttempts,
+		Cooldown:         bt.Cooldown,
+		GradingPolicy:    bt.GradingPolicy,
+		ShuffleQuestions: bt.ShuffleQuestions,
+		ShuffleOptions:   bt.ShuffleOptions,
+		CreatedAt:        now,
+	}
+	if hasTestSettings(t) && !CheckPermission(r, "course:test:write") {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Test settings require course:test:write")
+		return
+	}
+	if err := tx.CreateTest(&t); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	result := models.BundleImportResult{QuestionIDs: make(map[int]int, len(questions))}
+	for i := range questions {
+		q := &questions[i]
+		q.CourseID = courseID
+		q.CreatedAt = now
+		if err := tx.CreateQuestion(q); err != nil {
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+			return
+		}
+		result.QuestionIDs[bundle.Questions[i].ID] = q.ID
+		if bundle.Questions[i].InTest {
+			if _, err := tx.LinkQuestion(t.ID, q.ID, 0, q.Points); err != nil {
+				WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+				return
+			}
+			t.Questions = append(t.Questions, q.ID)
+		}
+	}
+	if err := checkPoolSizes(tx, t.ID, courseID, t.Kind, pools); errors.As(err, new(poolTooSmallError)) {
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, "Invalid bundle: "+err.Error())
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if err := tx.SetTestPools(t.ID, pools); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction commit failed")
+		return
+	}
+	result.Test = t
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testapplogic/models"
+	"testapplogic/store"
+	"testing"
+	"time"
+)
+
+func TestTestBundleRoundTrip(t *testing.T) {
+	mem := store.NewMemory()
+	h := &DBHandler{Store: mem}
+	teacherID, course, test := seedCourse(t, mem)
+
+	body := `{"test_id": ` + strconv.Itoa(test.ID) + `, "type": "single", "text": "См. https://example.com/a.png", "options": ["3", "4"], "correct_answer": 1, "points": 2}`
+	decode(t, call(h.CreateQuestion, "POST", body, teacherID, teacherPermissions, nil), http.StatusCreated, nil)
+	for _, text := range []string{"Пул 1", "Пул 2"} {
+		q := models.Question{CourseID: course.ID, Kind: models.TestKindQuiz, Type: models.QuestionTrueFalse, Text: text,
+			Options: []string{"Верно", "Неверно"}, CorrectAnswer: mustJSON(true), Tags: []string{"алгебра"}, CreatedAt: time.Now()}
+		if err := mem.CreateQuestion(&q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mem.SetTestPools(test.ID, []models.QuestionPool{{Tag: "алгебра", Count: 1, Points: 3}}); err != nil {
+		t.Fatal(err)
+	}
+
+	testVars := map[string]string{"id": strconv.Itoa(test.ID)}
+	w := call(h.ExportTestBundle, "GET", "", teacherID, teacherPermissions, testVars)
+	var bundle models.TestBundle
+	exported := w.Body.String()
+	decode(t, w, http.StatusOK, &bundle)
+	if len(bundle.Questions) != 3 || !bundle.Questions[0].InTest || bundle.Questions[0].Points != 2 ||
+		bundle.Questions[1].InTest || len(bundle.Pools) != 1 {
+		t.Fatalf("bundle %+v, want one test question, two pool candidates and the pool", bundle)
+	}
+	if len(bundle.Media) != 1 || bundle.Media[0] != "https://example.com/a.png" {
+		t.Fatalf("media %q, want the image link", bundle.Media)
+	}
+	// Пакет содержит ключи, поэтому студентам он не выдаётся
+	decode(t, call(h.ExportTestBundle, "GET", "", teacherID, studentPermissions, testVars), http.StatusForbidden, nil)
+
+	other := models.Course{Name: "Geometry", TeacherID: teacherID, CreatedAt: time.Now()}
+	if err := mem.CreateCourse(&other); err != nil {
+		t.Fatal(err)
+	}
+	courseVars := map[string]string{"id": strconv.Itoa(other.ID)}
+	var result models.BundleImportResult
+	decode(t, call(h.ImportTestBundle, "POST", exported, teacherID, teacherPermissions, courseVars), http.StatusCreated, &result)
+	if result.Test.CourseID != other.ID || result.Test.Active || len(result.Test.Questions) != 1 || len(result.QuestionIDs) != 3 {
+		t.Fatalf("import result %+v, want an inactive test with one question and three mapped IDs", result)
+	}
+	imported, err := mem.TestQuestions(result.Test.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 1 || imported[0].ID != result.QuestionIDs[bundle.Questions[0].ID] || imported[0].Points != 2 ||
+		string(compactJSON(imported[0].CorrectAnswer)) != "1" {
+		t.Fatalf("imported questions %+v, want the keyed question worth 2 points", imported)
+	}
+	pools, err := mem.TestPools(result.Test.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pools) != 1 || pools[0].Tag != "алгебра" || pools[0].Count != 1 || pools[0].Points != 3 {
+		t.Fatalf("imported pools %+v, want the algebra pool", pools)
+	}
+
+	// Настройки теста в пакете требуют course:test:write
+	timed := strings.Replace(exported, `"time_limit_seconds":null`, `"time_limit_seconds":600`, 1)
+	decode(t, call(h.ImportTestBundle, "POST", timed, teacherID, teacherPermissions, courseVars), http.StatusForbidden, nil)
+	decode(t, call(h.ImportTestBundle, "POST", timed, teacherID, adminPermissions, courseVars), http.StatusCreated, nil)
+}
+
+func TestValidateBundle(t *testing.T) {
+	question := models.BundleQuestion{ID: 1, Type: models.QuestionSingle, Text: "Q", Options: []string{"a", "b"},
+		CorrectAnswer: mustJSON(0), InTest: true}
+	tests := []struct {
+		name   string
+		change func(b *models.TestBundle)
+		err    string
+	}{
+		{"valid", func(b *models.TestBundle) {}, ""},
+		{"no version", func(b *models.TestBundle) { b.Version = 0 }, "version is required"},
+		{"newer version", func(b *models.TestBundle) { b.Version = models.TestBundleVersion + 1 }, "is not supported"},
+		{"no name", func(b *models.TestBundle) { b.Test.Name = "" }, "test.name is required"},
+		{"unknown kind", func(b *models.TestBundle) { b.Test.Kind = "exam" }, "test.kind"},
+		{"anonymous quiz", func(b *models.TestBundle) { b.Test.Anonymous = true }, "anonymous"},
+		{"bad grading policy", func(b *models.TestBundle) { b.Test.GradingPolicy = "worst" }, "test: "},
+		{"duplicate question id", func(b *models.TestBundle) { b.Questions = append(b.Questions, question) }, "questions[1]: id"},
+		{"negative points", func(b *models.TestBundle) { b.Questions[0].Points = -1 }, "questions[0]: points"},
+		{"key out of range", func(b *models.TestBundle) { b.Questions[0].CorrectAnswer = mustJSON(5) }, "questions[0]: "},
+		{"empty pool tag", func(b *models.TestBundle) { b.Pools = []models.BundlePool{{Count: 1}} }, "pools: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := models.TestBundle{Version: models.TestBundleVersion, Test: models.BundleTest{Name: "Quiz"},
+				Questions: []models.BundleQuestion{question}}
+			tt.change(&b)
+			questions, _, err := validateBundle(&b)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Значения по умолчанию: вид теста, политика оценки и балл вопроса состава
+			if b.Test.Kind != models.TestKindQuiz || b.Test.GradingPolicy != models.GradingBest || questions[0].Points != 1 {
+				t.Fatalf("defaults: kind %q policy %q points %g", b.Test.Kind, b.Test.GradingPolicy, questions[0].Points)
+			}
+		})
+	}
+}
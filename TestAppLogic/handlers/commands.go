@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testapplogic/models"
+	"testapplogic/store"
+)
+
+// errCommandForbidden возвращается командой, если у пользователя нет нужных прав
+var errCommandForbidden = errors.New("forbidden")
+
+// Command описывает текстовую команду, которую бот пересылает в /api/command
+type Command struct {
+	Name        string
+	Usage       string
+	Description string
+	// Permission — разрешение из JWT, без которого команда недоступна (пусто — доступна всем)
+	Permission string
+	Run        func(h *DBHandler, r *http.Request, args []string) (string, error)
+}
+
+// commandTable — реестр команд. Чтобы добавить команду, достаточно дописать её сюда
+var commandTable []Command
+
+// Таблица заполняется в init, потому что /help сам читает commandTable
+func init() {
+	commandTable = []Command{
+		{Name: "/help", Usage: "/help", Description: "список команд", Run: cmdHelp},
+		{Name: "/mycourses", Usage: "/mycourses", Description: "мои курсы", Run: cmdMyCourses},
+		{Name: "/tests", Usage: "/tests <id курса>", Description: "открытые тесты курса", Run: cmdTests},
+		{Name: "/results", Usage: "/results <id или название теста>", Description: "мои результаты по тесту", Run: cmdResults},
+		{Name: "/join", Usage: "/join <код>", Description: "записаться на курс по коду приглашения", Run: cmdJoin},
+	}
+}
+
+// findCommand ищет команду по имени
+func findCommand(name string) (Command, bool) {
+	for _, c := range commandTable {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Command{}, false
+}
+
+// parseCommand разбивает текст сообщения на имя команды и аргументы.
+// Суффикс @имя_бота, который Telegram добавляет в группах, отбрасывается
+func parseCommand(text string) (string, []string) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	name := strings.ToLower(fields[0])
+	if i := strings.Index(name, "@"); i > 0 {
+		name = name[:i]
+	}
+	return name, fields[1:]
+}
+
+// ExecuteCommand выполняет текстовую команду от имени пользователя из JWT
+// и возвращает ответ для чата в поле message
+func (h *DBHandler) ExecuteCommand(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Command string `json:"command"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	name, args := parseCommand(input.Command)
+	if name == "" {
+		writeInvalid(w, r, invalidField("command", "command is required"))
+		return
+	}
+	var message string
+	cmd, ok := findCommand(name)
+	if !ok {
+		message = fmt.Sprintf("Неизвестная команда %s. Список команд: /help", name)
+	} else {
+		if cmd.Permission != "" && !CheckPermission(r, cmd.Permission) {
+			WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+			return
+		}
+		var err error
+		message, err = cmd.Run(h, r, args)
+		if err == errCommandForbidden {
+			WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+			return
+		} else if err != nil {
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// cmdHelp выводит команды, доступные пользователю
+func cmdHelp(h *DBHandler, r *http.Request, args []string) (string, error) {
+	var b strings.Builder
+	b.WriteString("Доступные команды:")
+	for _, c := range commandTable {
+		if c.Permission != "" && !CheckPermission(r, c.Permission) {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s — %s", c.Usage, c.Description)
+	}
+	return b.String(), nil
+}
+
+// cmdMyCourses выводит курсы, которые ведёт пользователь или на которые он записан
+func cmdMyCourses(h *DBHandler, r *http.Request, args []string) (string, error) {
+	userID, ok := GetUserID(r)
+	if !ok {
+		return "", errCommandForbidden
+	}
+	courses, err := h.Store.MemberCourses(userID)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, c := range courses {
+		if c.Role == "teacher" {
+			fmt.Fprintf(&b, "\n[%d] %s (преподаватель)", c.ID, c.Name)
+		} else {
+			fmt.Fprintf(&b, "\n[%d] %s", c.ID, c.Name)
+		}
+	}
+	if b.Len() == 0 {
+		return "Вы пока не записаны ни на один курс. Используйте /join <код>", nil
+	}
+	return "Ваши курсы:" + b.String(), nil
+}
+
+// cmdTests выводит открытые тесты курса
+func cmdTests(h *DBHandler, r *http.Request, args []string) (string, error) {
+	if len(args) != 1 {
+		return "Использование: /tests <id курса>", nil
+	}
+	courseID, err := strconv.Atoi(args[0])
+	if err != nil {
+		return "ID курса должен быть числом", nil
+	}
+	if !CheckCourseAccess(h.Store, r, courseID) && !CheckCourseMembership(h.Store, r, courseID) {
+		return "", errCommandForbidden
+	}
+	active := true
+	tests, err := allCourseTests(h.Store, store.TestFilter{CourseID: courseID, Active: &active})
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, t := range tests {
+		fmt.Fprintf(&b, "\n[%d] %s", t.ID, t.Name)
+	}
+	if b.Len() == 0 {
+		return "В этом курсе нет открытых тестов", nil
+	}
+	return "Открытые тесты:" + b.String(), nil
+}
+
+// cmdResults выводит результаты завершённых попыток пользователя по тесту
+func cmdResults(h *DBHandler, r *http.Request, args []string) (string, error) {
+	if len(args) == 0 {
+		return "Использование: /results <id или название теста>", nil
+	}
+	userID, ok := GetUserID(r)
+	if !ok {
+		return "", errCommandForbidden
+	}
+	// Тест ищем по ID или по части названия среди тестов, которые пользователь проходил
+	ref := strings.Join(args, " ")
+	var t models.Test
+	var err error
+	if id, convErr := strconv.Atoi(ref); convErr == nil {
+		t, err = h.Store.Test(id)
+	} else {
+		t, err = h.Store.AttemptedTest(userID, ref)
+	}
+	if err == store.ErrNotFound {
+		return "Тест не найден", nil
+	} else if err != nil {
+		return "", err
+	}
+	attempts, err := h.Store.GradedAttempts(userID, t.ID)
+	if err != nil {
+		return "", err
+	}
+	if len(attempts) == 0 {
+		return fmt.Sprintf("У вас нет завершённых попыток по тесту «%s»", t.Name), nil
+	}
+	var b strings.Builder
+	for i, a := range attempts {
+		g := gradedFrom(a)
+		fmt.Fprintf(&b, "\nПопытка %d: %g из %g (%g%%)", i+1, g.Score, g.MaxScore, g.Percentage)
+	}
+	final, err := loadFinalScore(h.Store, t.ID, userID)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(&b, "\nИтоговая оценка (%s): %g из %g (%g%%)", gradingPolicyNames[final.Policy], final.Score, final.MaxScore, final.Percentage)
+	return fmt.Sprintf("Результаты по тесту «%s»:", t.Name) + b.String(), nil
+}
+
+// cmdJoin записывает пользователя на курс по коду приглашения
+func cmdJoin(h *DBHandler, r *http.Request, args []string) (string, error) {
+	if len(args) != 1 {
+		return "Использование: /join <код>", nil
+	}
+	userID, ok := GetUserID(r)
+	if !ok {
+		return "", errCommandForbidden
+	}
+	courseID, err := joinCourse(h.Store, userID, args[0])
+	switch err {
+	case nil:
+	case errInviteInvalid:
+		return "Код приглашения недействителен или истёк", nil
+	case errAlreadyMember:
+		return "Вы уже записаны на этот курс", nil
+	default:
+		return "", err
+	}
+	c, err := h.Store.Course(courseID)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Вы записаны на курс «%s»", c.Name), nil
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testapplogic/models"
+)
+
+// Коды ошибок API. Коды стабильны: клиенты ветвятся по ним, а не по тексту сообщения
+const (
+	// Общие ошибки запроса
+	CodeBadRequest       = "BAD_REQUEST"
+	CodeInvalidJSON      = "INVALID_JSON"
+	CodeInvalidID        = "INVALID_ID"
+	CodeValidationFailed = "VALIDATION_FAILED"
+	CodePayloadTooLarge  = "PAYLOAD_TOO_LARGE"
+	CodeUnauthorized     = "UNAUTHORIZED"
+	CodeInvalidToken     = "INVALID_TOKEN"
+	CodeForbidden        = "FORBIDDEN"
+	CodeNotFound         = "NOT_FOUND"
+	CodeMethodNotAllowed = "METHOD_NOT_ALLOWED"
+	CodeConflict         = "CONFLICT"
+	CodeInternal         = "INTERNAL_ERROR"
+
+	// Дисциплины и участники
+	CodeNotEnrolled    = "NOT_ENROLLED"
+	CodeAlreadyMember  = "ALREADY_MEMBER"
+	CodeInviteInvalid  = "INVITE_INVALID"
+	CodeCourseOwner    = "COURSE_OWNER"
+	CodeCourseDeleted  = "COURSE_DELETED"
+	CodeQuestionInTest = "QUESTION_IN_TEST"
+	CodeNotInTest      = "QUESTION_NOT_IN_TEST"
+	CodePoolTooSmall   = "POOL_TOO_SMALL"
+
+	// Тесты и попытки
+	CodeTestInactive        = "TEST_INACTIVE"
+	CodeTestNotOpen         = "TEST_NOT_OPEN"
+	CodeTestClosed          = "TEST_CLOSED"
+	CodeAttemptActive       = "ATTEMPT_ACTIVE"
+	CodeAttemptFinished     = "ATTEMPT_FINISHED"
+	CodeAttemptNotFinished  = "ATTEMPT_NOT_FINISHED"
+	CodeAttemptExpired      = "ATTEMPT_EXPIRED"
+	CodeAttemptLimitReached = "ATTEMPT_LIMIT_REACHED"
+	CodeAttemptCooldown     = "ATTEMPT_COOLDOWN"
+	CodeAnswersIncomplete   = "ANSWERS_INCOMPLETE"
+	CodeReviewDisabled      = "REVIEW_DISABLED"
+
+	// Опросы
+	CodeNotSurvey       = "NOT_A_SURVEY"
+	CodeSurveyNotGraded = "SURVEY_NOT_GRADED"
+	CodeSurveyCompleted = "SURVEY_COMPLETED"
+)
+
+// fieldError — ошибка проверки одного поля запроса. Текст ошибки совпадает
+// с сообщением, поэтому её можно показывать и там, где поле не важно
+type fieldError struct {
+	field, message string
+}
+
+// Error реализует error
+func (e fieldError) Error() string {
+	return e.message
+}
+
+// invalidField создаёт ошибку проверки поля
+func invalidField(field, message string) error {
+	return fieldError{field: field, message: message}
+}
+
+// fieldErrors — ошибки проверки нескольких полей запроса
+type fieldErrors []models.FieldError
+
+// Error реализует error
+func (e fieldErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, f := range e {
+		messages[i] = f.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// add добавляет ошибку поля
+func (e *fieldErrors) add(field, message string) {
+	*e = append(*e, models.FieldError{Field: field, Message: message})
+}
+
+// addErr добавляет ошибки полей из err; ошибка без поля добавляется с пустым полем
+func (e *fieldErrors) addErr(err error) {
+	var fields fieldErrors
+	var field fieldError
+	switch {
+	case err == nil:
+	case errors.As(err, &fields):
+		*e = append(*e, fields...)
+	case errors.As(err, &field):
+		e.add(field.field, field.message)
+	default:
+		e.add("", err.Error())
+	}
+}
+
+// err возвращает ошибки как error или nil, если ошибок нет
+func (e fieldErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// RequestIDMiddleware присваивает запросу идентификатор: берёт X-Request-ID клиента
+// или создаёт новый, возвращает его в заголовке ответа и кладёт в контекст
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" || len(requestID) > 64 {
+			buf := make([]byte, 8)
+			rand.Read(buf)
+			requestID = hex.EncodeToString(buf)
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		ctx := context.WithValue(r.Context(), "request_id", requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// GetRequestID извлекает идентификатор запроса из контекста
+func GetRequestID(r *http.Request) string {
+	requestID, _ := r.Context().Value("request_id").(string)
+	return requestID
+}
+
+// WriteError отправляет ошибку в едином формате models.ErrorResponse
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeErrorDetails(w, r, status, code, message, nil)
+}
+
+// writeErrorDetails отправляет ошибку с подробностями
+func writeErrorDetails(w http.ResponseWriter, r *http.Request, status int, code, message string, details interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: GetRequestID(r),
+	})
+}
+
+// writeInvalid отправляет ошибку проверки входных данных: для ошибок полей —
+// VALIDATION_FAILED со списком полей в details.fields, для остальных — BAD_REQUEST
+func writeInvalid(w http.ResponseWriter, r *http.Request, err error) {
+	var fields fieldErrors
+	var field fieldError
+	switch {
+	case errors.As(err, &fields):
+	case errors.As(err, &field):
+		fields = fieldErrors{{Field: field.field, Message: field.message}}
+	default:
+		WriteError(w, r, http.StatusBadRequest, CodeBadRequest, err.Error())
+		return
+	}
+	writeErrorDetails(w, r, http.StatusBadRequest, CodeValidationFailed, fields.Error(),
+		map[string]interface{}{"fields": []models.FieldError(fields)})
+}
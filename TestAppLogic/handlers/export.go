@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"testapplogic/models"
+	"testapplogic/store"
+
+	"github.com/gorilla/mux"
+)
+
+// exportFormat читает формат выгрузки из ?format= и проверяет его до начала записи ответа
+func exportFormat(w http.ResponseWriter, r *http.Request) (string, bool) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = formatCSV
+	}
+	if format != formatCSV && format != formatXLSX {
+		writeInvalid(w, r, invalidField("format", "format must be csv or xlsx"))
+		return "", false
+	}
+	return format, true
+}
+
+// formatAnswer переводит сохранённый ответ в читаемый вид: номера вариантов
+// заменяются их текстом, пары соответствия записываются как «вариант → ответ»
+func formatAnswer(q models.Question, raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	option := func(list []string, i int) string {
+		if i >= 0 && i < len(list) {
+			return list[i]
+		}
+		return strconv.Itoa(i)
+	}
+	switch q.Type {
+	case models.QuestionSingle, models.QuestionLikert:
+		var idx int
+		if json.Unmarshal(raw, &idx) == nil {
+			return option(q.Options, idx)
+		}
+	case models.QuestionMultiple, models.QuestionOrdering:
+		var idx []int
+		if json.Unmarshal(raw, &idx) == nil {
+			parts := make([]string, len(idx))
+			for i, v := range idx {
+				parts[i] = option(q.Options, v)
+			}
+			return strings.Join(parts, "; ")
+		}
+	case models.QuestionTrueFalse:
+		var value bool
+		if json.Unmarshal(raw, &value) == nil {
+			options := q.Options
+			if len(options) != 2 {
+				options = trueFalseOptions
+			}
+			if value {
+				return options[0]
+			}
+			return options[1]
+		}
+	case models.QuestionMatching:
+		var pairs []int
+		if json.Unmarshal(raw, &pairs) == nil {
+			parts := make([]string, len(pairs))
+			for i, v := range pairs {
+				parts[i] = option(q.Options, i) + " → " + option(q.Matches, v)
+			}
+			return strings.Join(parts, "; ")
+		}
+	case models.QuestionText, models.QuestionFreeText:
+		var value string
+		if json.Unmarshal(raw, &value) == nil {
+			return value
+		}
+	}
+	return string(compactJSON(raw))
+}
+
+// ExportTestAttempts выгружает попытки теста в CSV или XLSX (?format=csv|xlsx):
+// строка на попытку с ответом и его правильностью по каждому вопросу
+func (h *DBHandler) ExportTestAttempts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid test ID")
+		return
+	}
+	format, ok := exportFormat(w, r)
+	if !ok {
+		return
+	}
+	t, err := h.Store.Test(testID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Test not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if !CheckCourseAccess(h.Store, r, t.CourseID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+		return
+	}
+	questions, err := h.Store.PresentedQuestions(testID)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	column := make(map[int]int, len(questions))
+	for i, q := range questions {
+		column[q.ID] = i
+	}
+	header := []interface{}{"attempt_id", "user_ref", "full_name", "finished", "score", "max_score", "percentage", "started_at", "completed_at"}
+	// Столбцы вопросов идут после столбцов попытки: ответ и его правильность
+	fixed := len(header)
+	for i := range questions {
+		header = append(header, fmt.Sprintf("Q%d", i+1), fmt.Sprintf("Q%d correct", i+1))
+	}
+	// Таблица создаётся при первой строке, чтобы ошибку чтения до неё можно было
+	// вернуть обычным ответом; в памяти одновременно держится только одна строка
+	var sheet sheetWriter
+	open := func() error {
+		if sheet != nil {
+			return nil
+		}
+		var err error
+		if sheet, err = newSheetWriter(w, format, fmt.Sprintf("test-%d-attempts", testID)); err != nil {
+			return err
+		}
+		return sheet.WriteRow(header...)
+	}
+	err = h.Store.EachTestAttempt(testID, func(e store.AttemptExport) error {
+		if err := open(); err != nil {
+			return err
+		}
+		a := e.Attempt
+		row := make([]interface{}, fixed+2*len(questions))
+		copy(row, []interface{}{a.ID, e.UserRef, e.FullName, a.Finished, a.Score, a.MaxScore, a.Percentage, a.CreatedAt, a.CompletedAt})
+		for _, ans := range e.Answers {
+			if i, ok := column[ans.QuestionID]; ok {
+				row[fixed+2*i] = formatAnswer(questions[i], ans.Answer)
+				if ans.IsCorrect != nil {
+					row[fixed+2*i+1] = *ans.IsCorrect
+				}
+			}
+		}
+		return sheet.WriteRow(row...)
+	})
+	if err != nil && sheet == nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if err == nil {
+		err = open()
+	}
+	if err != nil {
+		log.Printf("Export of test %d failed: %v", testID, err)
+		return
+	}
+	if err := sheet.Close(); err != nil {
+		log.Printf("Export of test %d failed: %v", testID, err)
+	}
+}
+
+// ExportGradebook выгружает журнал дисциплины в CSV или XLSX (?format=csv|xlsx).
+// Поддерживает те же параметры фильтрации и сортировки, что и GetGradebook
+func (h *DBHandler) ExportGradebook(w http.ResponseWriter, r *http.Request) {
+	courseID, ok := h.courseIDFromVars(w, r, "course:userList")
+	if !ok {
+		return
+	}
+	format, ok := exportFormat(w, r)
+	if !ok {
+		return
+	}
+	gb, ok := h.queryGradebook(w, r, courseID)
+	if !ok {
+		return
+	}
+	sheet, err := newSheetWriter(w, format, fmt.Sprintf("course-%d-gradebook", courseID))
+	if err != nil {
+		log.Printf("Export of gradebook %d failed: %v", courseID, err)
+		return
+	}
+	header := []interface{}{"user_ref", "full_name"}
+	for _, t := range gb.Tests {
+		header = append(header, t.Name, t.Name+" (attempts)")
+	}
+	header = append(header, "completed", "average")
+	if err := sheet.WriteRow(header...); err != nil {
+		log.Printf("Export of gradebook %d failed: %v", courseID, err)
+		return
+	}
+	for _, s := range gb.Students {
+		row := []interface{}{s.UserRef, s.FullName}
+		for _, c := range s.Cells {
+			row = append(row, c.Percentage, c.Attempts)
+		}
+		row = append(row, s.Completed, s.Average)
+		if err := sheet.WriteRow(row...); err != nil {
+			log.Printf("Export of gradebook %d failed: %v", courseID, err)
+			return
+		}
+	}
+	if err := sheet.Close(); err != nil {
+		log.Printf("Export of gradebook %d failed: %v", courseID, err)
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"testapplogic/models"
+	"testing"
+)
+
+func TestFormatAnswer(t *testing.T) {
+	choice := models.Question{Type: models.QuestionSingle, Options: []string{"Париж", "Лион"}}
+	tests := []struct {
+		name     string
+		question models.Question
+		answer   string
+		want     string
+	}{
+		{"no answer", choice, "", ""},
+		{"single", choice, `1`, "Лион"},
+		{"single out of range", choice, `5`, "5"},
+		{"multiple", models.Question{Type: models.QuestionMultiple, Options: []string{"2", "3", "4"}}, `[0, 2]`, "2; 4"},
+		{"ordering", models.Question{Type: models.QuestionOrdering, Options: []string{"a", "b"}}, `[1,0]`, "b; a"},
+		{"true_false default labels", models.Question{Type: models.QuestionTrueFalse}, `false`, "Неверно"},
+		{"true_false own labels", models.Question{Type: models.QuestionTrueFalse, Options: []string{"Да", "Нет"}}, `true`, "Да"},
+		{"matching", models.Question{Type: models.QuestionMatching, Options: []string{"кот", "пёс"},
+			Matches: []string{"гав", "мяу"}}, `[1,0]`, "кот → мяу; пёс → гав"},
+		{"text", models.Question{Type: models.QuestionText}, `"Москва"`, "Москва"},
+		{"numeric", models.Question{Type: models.QuestionNumeric}, ` 3.14 `, "3.14"},
+		{"malformed", choice, `{"a": 1}`, `{"a":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var raw []byte
+			if tt.answer != "" {
+				raw = []byte(tt.answer)
+			}
+			if got := formatAnswer(tt.question, raw); got != tt.want {
+				t.Fatalf("formatAnswer = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
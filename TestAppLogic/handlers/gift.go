@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"testapplogic/models"
+)
+
+// giftFormatMarker — пометка формата текста вопроса в GIFT: [html], [moodle], [markdown], [plain]
+var giftFormatMarker = regexp.MustCompile(`^\[(html|moodle|markdown|plain)\]`)
+
+// giftBlankLines разделяет вопросы GIFT
+var giftBlankLines = regexp.MustCompile(`\n[ \t]*\n`)
+
+// parseGIFT разбирает вопросы в формате GIFT. Вопросы разделяются пустой строкой,
+// строка $CATEGORY: задаёт тег для следующих вопросов, строки // — комментарии
+func parseGIFT(text string) []importedQuestion {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "//") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	var items []importedQuestion
+	category := ""
+	for _, block := range giftBlankLines.Split(strings.Join(lines, "\n"), -1) {
+		block = strings.TrimSpace(block)
+		if strings.HasPrefix(block, "$CATEGORY:") {
+			line, rest, _ := strings.Cut(block, "\n")
+			category = categoryTag(strings.TrimPrefix(line, "$CATEGORY:"))
+			block = strings.TrimSpace(rest)
+		}
+		if block == "" {
+			continue
+		}
+		item := parseGIFTQuestion(block)
+		if tag := category; tag != "" {
+			item.question.Tags = append(item.question.Tags, tag)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// parseGIFTQuestion разбирает один вопрос GIFT: ::Название:: Текст {ответы}
+func parseGIFTQuestion(block string) importedQuestion {
+	var item importedQuestion
+	if strings.HasPrefix(block, "::") {
+		end := indexUnescaped(block[2:], "::")
+		if end < 0 {
+			item.err = errors.New("question title is not closed with ::")
+			return item
+		}
+		item.title = giftUnescape(block[2 : 2+end])
+		block = strings.TrimSpace(block[4+end:])
+	}
+	open := indexUnescaped(block, "{")
+	if open < 0 {
+		item.question.Text = giftText(block)
+		item.skip = "description without answers is not a question"
+		return item
+	}
+	closeAt := indexUnescaped(block[open:], "}")
+	if closeAt < 0 {
+		item.question.Text = giftText(block)
+		item.err = errors.New("answer block is not closed with }")
+		return item
+	}
+	closeAt += open
+	// Текст после блока ответов — вопрос «пропущенное слово», ответы ставятся на место пропуска
+	text := strings.TrimSpace(block[:open])
+	if after := strings.TrimSpace(block[closeAt+1:]); after != "" {
+		text += " _____ " + after
+	}
+	text = giftText(text)
+	q, err := parseGIFTAnswers(strings.TrimSpace(block[open+1 : closeAt]))
+	q.Text = text
+	item.question, item.err = q, err
+	return item
+}
+
+// parseGIFTAnswers разбирает блок ответов GIFT и определяет по нему тип вопроса
+func parseGIFTAnswers(body string) (models.Question, error) {
+	// Общий отзыв ####... к вопросу не относится
+	if i := indexUnescaped(body, "####"); i >= 0 {
+		body = strings.TrimSpace(body[:i])
+	}
+	if body == "" {
+		return models.Question{Type: models.QuestionFreeText}, nil
+	}
+	value, _ := splitFeedback(body)
+	switch strings.ToUpper(strings.TrimSpace(value)) {
+	case "T", "TRUE":
+		return models.Question{Type: models.QuestionTrueFalse, CorrectAnswer: mustJSON(true)}, nil
+	case "F", "FALSE":
+		return models.Question{Type: models.QuestionTrueFalse, CorrectAnswer: mustJSON(false)}, nil
+	}
+	if strings.HasPrefix(body, "#") {
+		return parseGIFTNumeric(strings.TrimSpace(body[1:]))
+	}
+	answers := splitGIFTAnswers(body)
+	if len(answers) == 0 {
+		return models.Question{}, errors.New("answers must start with = or ~")
+	}
+	allRight := true
+	for _, a := range answers {
+		if a.prefix != '=' {
+			allRight = false
+		}
+	}
+	if allRight && strings.Contains(answers[0].text, "->") {
+		var pairs [][2]string
+		for _, a := range answers {
+			left, right, ok := strings.Cut(a.text, "->")
+			if !ok {
+				return models.Question{Type: models.QuestionMatching}, errors.New("every matching answer needs ->")
+			}
+			pairs = append(pairs, [2]string{giftUnescape(strings.TrimSpace(left)), giftUnescape(strings.TrimSpace(right))})
+		}
+		return matchingQuestion("", pairs)
+	}
+	if allRight {
+		var accepted []string
+		for _, a := range answers {
+			accepted = append(accepted, giftUnescape(a.text))
+		}
+		return models.Question{Type: models.QuestionText, CorrectAnswer: mustJSON(models.TextKey{Accepted: accepted})}, nil
+	}
+	choices := make([]importAnswer, len(answers))
+	for i, a := range answers {
+		choices[i] = importAnswer{text: giftUnescape(a.text), weight: a.weight}
+	}
+	return choiceQuestion("", choices, nil)
+}
+
+// giftAnswer — ответ из блока GIFT: = или ~, доля баллов и текст без отзыва
+type giftAnswer struct {
+	prefix byte
+	weight float64
+	text   string
+}
+
+// giftWeight — доля баллов ответа GIFT: %50%
+var giftWeight = regexp.MustCompile(`^%(-?[0-9.]+)%`)
+
+// splitGIFTAnswers делит блок ответов по неэкранированным = и ~
+func splitGIFTAnswers(body string) []giftAnswer {
+	var answers []giftAnswer
+	var current *giftAnswer
+	var buf strings.Builder
+	finish := func() {
+		if current == nil {
+			return
+		}
+		text, _ := splitFeedback(strings.TrimSpace(buf.String()))
+		if m := giftWeight.FindStringSubmatch(text); m != nil {
+			current.weight, _ = strconv.ParseFloat(m[1], 64)
+			text = text[len(m[0]):]
+		} else if current.prefix == '=' {
+			current.weight = 100
+		}
+		current.text = strings.TrimSpace(text)
+		answers = append(answers, *current)
+		buf.Reset()
+	}
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c == '\\' && i+1 < len(body) {
+			buf.WriteByte(c)
+			buf.WriteByte(body[i+1])
+			i++
+			continue
+		}
+		if c == '=' || c == '~' {
+			finish()
+			current = &giftAnswer{prefix: c}
+			continue
+		}
+		if current == nil && c != ' ' && c != '\n' && c != '\t' {
+			return nil
+		}
+		buf.WriteByte(c)
+	}
+	finish()
+	return answers
+}
+
+// parseGIFTNumeric разбирает числовой ответ GIFT: #3.14:0.01, #1..5 или
+// несколько ответов #=3.14:0.01 =%50%3:1 — берётся первый полностью верный
+func parseGIFTNumeric(body string) (models.Question, error) {
+	q := models.Question{Type: models.QuestionNumeric}
+	value := body
+	if strings.HasPrefix(body, "=") {
+		value = ""
+		for _, a := range splitGIFTAnswers(body) {
+			if a.weight >= 100 {
+				value = a.text
+				break
+			}
+		}
+	}
+	value, _ = splitFeedback(value)
+	value = strings.TrimSpace(value)
+	var key models.NumericKey
+	var err error
+	if lo, hi, ok := strings.Cut(value, ".."); ok {
+		var min, max float64
+		if min, err = strconv.ParseFloat(strings.TrimSpace(lo), 64); err == nil {
+			max, err = strconv.ParseFloat(strings.TrimSpace(hi), 64)
+		}
+		key.Value, key.Tolerance = (min+max)/2, (max-min)/2
+	} else {
+		v, t, _ := strings.Cut(value, ":")
+		if key.Value, err = strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && t != "" {
+			key.Tolerance, err = strconv.ParseFloat(strings.TrimSpace(t), 64)
+		}
+	}
+	if err != nil || value == "" {
+		return q, errors.New("invalid numeric answer")
+	}
+	q.CorrectAnswer = mustJSON(key)
+	return q, nil
+}
+
+// splitFeedback отделяет отзыв #... от ответа
+func splitFeedback(s string) (string, string) {
+	if i := indexUnescaped(s, "#"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// giftText убирает пометку формата и экранирование из текста вопроса
+func giftText(s string) string {
+	s = strings.TrimSpace(s)
+	if m := giftFormatMarker.FindStringSubmatch(s); m != nil {
+		s = strings.TrimSpace(s[len(m[0]):])
+		if m[1] == "html" {
+			return htmlText(giftUnescape(s))
+		}
+	}
+	return giftUnescape(s)
+}
+
+// giftUnescape снимает экранирование GIFT: \~ \= \# \{ \} \: \\ и \n
+func giftUnescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] == 'n' {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// indexUnescaped ищет sub в s, пропуская символы, экранированные обратной косой чертой
+func indexUnescaped(s, sub string) int {
+	for i := 0; i+len(sub) <= len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(s[i:], sub) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"testapplogic/models"
+	"testing"
+)
+
+func TestParseGIFTQuestion(t *testing.T) {
+	tests := []struct {
+		name  string
+		block string
+		want  wantImport
+	}{
+		{"single choice", "::Столица:: Столица Франции? {=Париж ~Лион ~Марсель}", wantImport{
+			title: "Столица", typ: models.QuestionSingle, text: "Столица Франции?",
+			options: []string{"Париж", "Лион", "Марсель"}, key: 0,
+		}},
+		{"multiple choice by weights", "Простые числа {~%50%2 ~%50%3 ~%-100%4}", wantImport{
+			typ: models.QuestionMultiple, text: "Простые числа",
+			options: []string{"2", "3", "4"}, key: []int{0, 1},
+		}},
+		{"feedback is dropped", "2 + 2 {=4#верно ~5#нет}", wantImport{
+			typ: models.QuestionSingle, text: "2 + 2", options: []string{"4", "5"}, key: 0,
+		}},
+		{"true", "Земля круглая {T}", wantImport{typ: models.QuestionTrueFalse, text: "Земля круглая", key: true}},
+		{"false", "Земля плоская {FALSE}", wantImport{typ: models.QuestionTrueFalse, text: "Земля плоская", key: false}},
+		{"numeric with tolerance", "Число пи {#3.14:0.01}", wantImport{
+			typ: models.QuestionNumeric, text: "Число пи", key: models.NumericKey{Value: 3.14, Tolerance: 0.01},
+		}},
+		{"numeric range", "От 1 до 5 {#1..5}", wantImport{
+			typ: models.QuestionNumeric, text: "От 1 до 5", key: models.NumericKey{Value: 3, Tolerance: 2},
+		}},
+		{"numeric first full answer", "Корень из 9 {#=%50%-3 =3:0}", wantImport{
+			typ: models.QuestionNumeric, text: "Корень из 9", key: models.NumericKey{Value: 3},
+		}},
+		{"short answer", "Столица России? {=Москва =Moscow}", wantImport{
+			typ: models.QuestionText, text: "Столица России?", key: models.TextKey{Accepted: []string{"Москва", "Moscow"}},
+		}},
+		{"matching", "Сопоставьте {=кот -> мяу =пёс -> гав}", wantImport{
+			typ: models.QuestionMatching, text: "Сопоставьте",
+			options: []string{"кот", "пёс"}, matches: []string{"мяу", "гав"}, key: []int{0, 1},
+		}},
+		{"missing word", "Москва {=столица ~деревня} России", wantImport{
+			typ: models.QuestionSingle, text: "Москва _____ России", options: []string{"столица", "деревня"}, key: 0,
+		}},
+		{"escaped characters", `Сколько будет 1\=1 \{?\} {=да ~нет}`, wantImport{
+			typ: models.QuestionSingle, text: "Сколько будет 1=1 {?}", options: []string{"да", "нет"}, key: 0,
+		}},
+		{"html text", "[html]<p>Выберите <b>верное</b></p> {=да ~нет}", wantImport{
+			typ: models.QuestionSingle, text: "Выберите верное", options: []string{"да", "нет"}, key: 0,
+		}},
+		{"essay", "Расскажите о себе {}", wantImport{typ: models.QuestionFreeText, text: "Расскажите о себе"}},
+		{"description is skipped", "Просто описание", wantImport{skip: true}},
+		{"unclosed title", "::Без конца Текст {T}", wantImport{err: true}},
+		{"unclosed answers", "Текст {=a ~b", wantImport{err: true}},
+		{"no correct choice", "Текст {~a ~b}", wantImport{err: true}},
+		{"bad numeric", "Текст {#abc}", wantImport{err: true}},
+		{"matching without arrow", "Текст {=a -> 1 =b}", wantImport{err: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkImported(t, parseGIFTQuestion(tt.block), tt.want)
+		})
+	}
+}
+
+func TestParseGIFTCategoriesAndComments(t *testing.T) {
+	text := "// комментарий\r\n$CATEGORY: $course$/top/Алгебра\r\n\r\nПервый {T}\r\n\r\n// ещё один\r\nВторой {F}\r\n"
+	items := parseGIFT(text)
+	if len(items) != 2 {
+		t.Fatalf("got %d questions, want 2", len(items))
+	}
+	checkImported(t, items[0], wantImport{typ: models.QuestionTrueFalse, text: "Первый", key: true, tags: []string{"Алгебра"}})
+	checkImported(t, items[1], wantImport{typ: models.QuestionTrueFalse, text: "Второй", key: false, tags: []string{"Алгебра"}})
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testapplogic/models"
+	"testapplogic/store"
+)
+
+// gradebookKey — пара (студент, тест) для группировки попыток
+type gradebookKey struct {
+	userID, testID int
+}
+
+// buildGradebook строит журнал дисциплины по тестам с проверкой ответов.
+// testIDs ограничивает набор столбцов; пустой список — все тесты дисциплины
+func buildGradebook(s store.Store, courseID int, testIDs []int) (models.Gradebook, error) {
+	gb := models.Gradebook{CourseID: courseID, Tests: []models.GradebookTest{}, Students: []models.GradebookRow{}}
+	tests, err := allCourseTests(s, store.TestFilter{CourseID: courseID, Kind: models.TestKindQuiz, IDs: testIDs})
+	if err != nil {
+		return gb, err
+	}
+	for _, t := range tests {
+		gb.Tests = append(gb.Tests, models.GradebookTest{TestID: t.ID, Name: t.Name, Active: t.Active, GradingPolicy: t.GradingPolicy})
+	}
+	members, err := s.CourseMembers(courseID, "student")
+	if err != nil {
+		return gb, err
+	}
+	for _, m := range members {
+		gb.Students = append(gb.Students, models.GradebookRow{UserID: m.UserID, UserRef: m.UserRef, FullName: m.FullName})
+	}
+
+	// Все попытки студентов курса сразу, в порядке завершения — как в loadFinalScore
+	attempts, err := s.StudentAttempts(courseID)
+	if err != nil {
+		return gb, err
+	}
+	graded := make(map[gradebookKey][]gradedAttempt)
+	counts := make(map[gradebookKey]int)
+	for _, a := range attempts {
+		key := gradebookKey{a.UserID, a.TestID}
+		counts[key]++
+		if a.Finished && a.Score != nil && a.MaxScore != nil && a.Percentage != nil {
+			graded[key] = append(graded[key], gradedFrom(a))
+		}
+	}
+
+	for i := range gb.Students {
+		s := &gb.Students[i]
+		s.Cells = make([]models.GradebookCell, 0, len(gb.Tests))
+		var sum float64
+		for _, t := range gb.Tests {
+			key := gradebookKey{s.UserID, t.TestID}
+			cell := models.GradebookCell{TestID: t.TestID, Status: models.GradeNotStarted, Attempts: counts[key]}
+			if attempts := graded[key]; len(attempts) > 0 {
+				final := applyGradingPolicy(t.GradingPolicy, attempts)
+				cell.Status = models.GradeCompleted
+				cell.AttemptID = final.AttemptID
+				cell.Score = &final.Score
+				cell.MaxScore = &final.MaxScore
+				cell.Percentage = &final.Percentage
+				s.Completed++
+				sum += final.Percentage
+			} else if cell.Attempts > 0 {
+				cell.Status = models.GradeInProgress
+			}
+			s.Cells = append(s.Cells, cell)
+		}
+		if s.Completed > 0 {
+			avg := math.Round(sum/float64(s.Completed)*100) / 100
+			s.Average = &avg
+		}
+	}
+	return gb, nil
+}
+
+// filterGradebook оставляет студентов, подходящих под поиск по имени или внешнему ID
+// и имеющих хотя бы один тест с указанным статусом
+func filterGradebook(students []models.GradebookRow, search, status string) []models.GradebookRow {
+	search = strings.ToLower(search)
+	filtered := students[:0]
+	for _, s := range students {
+		if search != "" && !strings.Contains(strings.ToLower(s.FullName), search) &&
+			!strings.Contains(strings.ToLower(s.UserRef), search) {
+			continue
+		}
+		if status != "" {
+			found := false
+			for _, c := range s.Cells {
+				if c.Status == status {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		filtered = append(filtered, s)
+	}
+	return filtered
+}
+
+// sortGradebook упорядочивает строки журнала по ключу name, average, completed или test:<id>.
+// Студенты без оценки по ключу всегда оказываются в конце
+func sortGradebook(gb *models.Gradebook, key string, desc bool) error {
+	var value func(s models.GradebookRow) *float64
+	switch {
+	case key == "" || key == "name":
+		sort.SliceStable(gb.Students, func(i, j int) bool {
+			a, b := strings.ToLower(gb.Students[i].FullName), strings.ToLower(gb.Students[j].FullName)
+			if desc {
+				return a > b
+			}
+			return a < b
+		})
+		return nil
+	case key == "average":
+		value = func(s models.GradebookRow) *float64 { return s.Average }
+	case key == "completed":
+		value = func(s models.GradebookRow) *float64 {
+			v := float64(s.Completed)
+			return &v
+		}
+	case strings.HasPrefix(key, "test:"):
+		testID, err := strconv.Atoi(strings.TrimPrefix(key, "test:"))
+		if err != nil {
+			return errors.New("invalid sort key")
+		}
+		col := -1
+		for i, t := range gb.Tests {
+			if t.TestID == testID {
+				col = i
+			}
+		}
+		if col < 0 {
+			return errors.New("sort test is not in the gradebook")
+		}
+		value = func(s models.GradebookRow) *float64 { return s.Cells[col].Percentage }
+	default:
+		return errors.New("sort must be name, average, completed or test:<id>")
+	}
+	sort.SliceStable(gb.Students, func(i, j int) bool {
+		a, b := value(gb.Students[i]), value(gb.Students[j])
+		if a == nil || b == nil {
+			return a != nil
+		}
+		if desc {
+			return *a > *b
+		}
+		return *a < *b
+	})
+	return nil
+}
+
+// GetGradebook возвращает журнал дисциплины: итоговые оценки студентов по тестам
+// с учётом правила оценки каждого теста, число попыток и статус прохождения.
+// Параметры: ?tests=1,2 — столбцы, ?search= — поиск студента, ?status= — фильтр по статусу,
+// ?sort=name|average|completed|test:<id> и ?order=asc|desc — сортировка
+func (h *DBHandler) GetGradebook(w http.ResponseWriter, r *http.Request) {
+	courseID, ok := h.courseIDFromVars(w, r, "course:userList")
+	if !ok {
+		return
+	}
+	gb, ok := h.queryGradebook(w, r, courseID)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(gb)
+}
+
+// queryGradebook строит журнал с учётом параметров запроса GetGradebook.
+// При ошибке ответ уже записан и возвращается false
+func (h *DBHandler) queryGradebook(w http.ResponseWriter, r *http.Request, courseID int) (models.Gradebook, bool) {
+	query := r.URL.Query()
+	var testIDs []int
+	if s := query.Get("tests"); s != "" {
+		for _, part := range strings.Split(s, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				writeInvalid(w, r, invalidField("tests", "Invalid test ID in tests"))
+				return models.Gradebook{}, false
+			}
+			testIDs = append(testIDs, id)
+		}
+	}
+	status := query.Get("status")
+	if status != "" && status != models.GradeNotStarted && status != models.GradeInProgress && status != models.GradeCompleted {
+		writeInvalid(w, r, invalidField("status", "status must be not_started, in_progress or completed"))
+		return models.Gradebook{}, false
+	}
+	order := query.Get("order")
+	if order != "" && order != "asc" && order != "desc" {
+		writeInvalid(w, r, invalidField("order", "order must be asc or desc"))
+		return models.Gradebook{}, false
+	}
+	gb, err := buildGradebook(h.Store, courseID, testIDs)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return gb, false
+	}
+	gb.Students = filterGradebook(gb.Students, query.Get("search"), status)
+	if err := sortGradebook(&gb, query.Get("sort"), order == "desc"); err != nil {
+		writeInvalid(w, r, invalidField("sort", err.Error()))
+		return gb, false
+	}
+	return gb, true
+}
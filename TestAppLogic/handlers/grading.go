@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"testapplogic/models"
+	"testapplogic/store"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// attemptTest загружает попытку и её неудалённый тест. Если попытки нет или тест удалён,
+// возвращается store.ErrNotFound
+func attemptTest(s store.Store, attemptID int) (models.Attempt, models.Test, error) {
+	a, err := s.Attempt(attemptID)
+	if err != nil {
+		return a, models.Test{}, err
+	}
+	t, err := s.Test(a.TestID)
+	return a, t, err
+}
+
+// completeAttempt завершает попытку: тесты оцениваются, ответы опросов просто фиксируются.
+// Для опросов возвращается nil
+func completeAttempt(s store.Store, attemptID int) (*models.AttemptResult, error) {
+	a, err := s.Attempt(attemptID)
+	if err != nil {
+		return nil, err
+	}
+	// Просроченную попытку завершает и фоновая проверка, в том числе после удаления теста
+	t, err := s.TestWithDeleted(a.TestID)
+	if err != nil {
+		return nil, err
+	}
+	if t.Kind == models.TestKindSurvey {
+		return nil, finishSurvey(s, a, t)
+	}
+	return gradeAttempt(s, a, t)
+}
+
+// gradeAttempt сверяет ответы попытки с ключами вопросов её варианта,
+// сохраняет результат и помечает попытку завершённой
+func gradeAttempt(s store.Store, a models.Attempt, t models.Test) (*models.AttemptResult, error) {
+	result := &models.AttemptResult{AttemptID: a.ID, UserID: a.UserID, TestID: a.TestID}
+	paper, err := s.AttemptPaper(a.ID)
+	if err != nil {
+		return nil, err
+	}
+	// Ответы хранятся в номерах исходных вариантов, поэтому сверяются с ключом напрямую
+	byID := make(map[int]models.Question, len(paper))
+	for _, p := range paper {
+		byID[p.Question.ID] = p.Question
+	}
+	// На каждый вопрос хранится один текущий ответ
+	answers, err := s.AttemptAnswers(a.ID)
+	if err != nil {
+		return nil, err
+	}
+	checked := make(map[int]models.Answer, len(answers))
+	correct := make(map[int]bool, len(answers))
+	for _, ans := range answers {
+		if question, ok := byID[ans.QuestionID]; ok {
+			correct[ans.QuestionID] = checkAnswer(question, ans.Answer)
+		}
+		if err := s.SetAnswerCorrect(ans.ID, correct[ans.QuestionID]); err != nil {
+			return nil, err
+		}
+		checked[ans.QuestionID] = ans
+	}
+	for _, p := range paper {
+		qr := models.QuestionResult{QuestionID: p.Question.ID, MaxPoints: p.Question.Points}
+		if ans, ok := checked[p.Question.ID]; ok {
+			qr.Answer = ans.Answer
+			qr.Correct = correct[p.Question.ID]
+		}
+		if qr.Correct {
+			qr.Points = qr.MaxPoints
+			result.Correct++
+		}
+		result.Score += qr.Points
+		result.MaxScore += qr.MaxPoints
+		result.Questions = append(result.Questions, qr)
+	}
+	result.Total = len(result.Questions)
+	result.Percentage = percentage(result.Score, result.MaxScore)
+	result.CompletedAt = time.Now()
+	if err := s.SaveAttemptResult(result); err != nil {
+		return nil, err
+	}
+	message := fmt.Sprintf("Тест «%s» проверен: %g из %g баллов (%g%%)", t.Name, result.Score, result.MaxScore, result.Percentage)
+	if err := s.Notify(result.UserID, NotificationAttemptGraded, message); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// loadAttemptResult собирает сохранённый результат завершённой попытки
+func loadAttemptResult(s store.Store, a models.Attempt) (*models.AttemptResult, error) {
+	result := &models.AttemptResult{AttemptID: a.ID, UserID: a.UserID, TestID: a.TestID}
+	g := gradedFrom(a)
+	result.Score, result.MaxScore, result.Percentage = g.Score, g.MaxScore, g.Percentage
+	if a.CompletedAt != nil {
+		result.CompletedAt = *a.CompletedAt
+	}
+	paper, err := s.AttemptPaper(a.ID)
+	if err != nil {
+		return nil, err
+	}
+	answers, err := s.AttemptAnswers(a.ID)
+	if err != nil {
+		return nil, err
+	}
+	byQuestion := make(map[int]models.Answer, len(answers))
+	for _, ans := range answers {
+		byQuestion[ans.QuestionID] = ans
+	}
+	for _, p := range paper {
+		qr := models.QuestionResult{QuestionID: p.Question.ID, MaxPoints: p.Question.Points}
+		if ans, ok := byQuestion[p.Question.ID]; ok {
+			qr.Answer = ans.Answer
+			qr.Correct = ans.IsCorrect != nil && *ans.IsCorrect
+		}
+		if qr.Correct {
+			qr.Points = qr.MaxPoints
+			result.Correct++
+		}
+		result.Questions = append(result.Questions, qr)
+	}
+	result.Total = len(result.Questions)
+	return result, nil
+}
+
+// percentage возвращает долю набранных баллов в процентах с точностью до сотых
+func percentage(score, maxScore float64) float64 {
+	if maxScore <= 0 {
+		return 0
+	}
+	return math.Round(score/maxScore*10000) / 100
+}
+
+// GetAttemptResult возвращает результат проверки завершённой попытки
+func (h *DBHandler) GetAttemptResult(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	attemptID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid attempt ID")
+		return
+	}
+	userID, ok := GetUserID(r)
+	if !ok {
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "User not authenticated")
+		return
+	}
+	a, t, err := attemptTest(h.Store, attemptID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Attempt not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if a.UserID != userID && !CheckCourseAccess(h.Store, r, t.CourseID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+		return
+	}
+	if !a.Finished {
+		WriteError(w, r, http.StatusBadRequest, CodeAttemptNotFinished, "Attempt is not finished yet")
+		return
+	}
+	if t.Kind == models.TestKindSurvey {
+		WriteError(w, r, http.StatusBadRequest, CodeSurveyNotGraded, "Survey responses are not graded")
+		return
+	}
+	result, err := loadAttemptResult(h.Store, a)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
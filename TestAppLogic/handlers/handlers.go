@@ -1,86 +1,67 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
 	"strconv"
-	"strings"
 	"testapplogic/models"
+	"testapplogic/store"
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/lib/pq"
 )
 
-// DBHandler структура для передачи подключения к БД в обработчики
+// DBHandler структура для передачи хранилища в обработчики
 type DBHandler struct {
-	DB *sql.DB
+	Store store.Store
 }
 
 // HealthCheck проверяет работоспособность сервера и подключение к БД
 func (h *DBHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	var status string
-	err := h.DB.QueryRow("SELECT 'ok'").Scan(&status)
-	if err != nil {
-		http.Error(w, "Database connection failed", http.StatusInternalServerError)
+	if err := h.Store.Ping(); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database connection failed")
 		return
 	}
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": status})
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
-// GetCourses возвращает список дисциплин, доступных пользователю
+// GetCourses возвращает страницу дисциплин, которые пользователь ведёт или на которые записан.
+// Параметры: общие параметры списков (см. listOptions; sort=id|name|created_at,
+// по умолчанию -created_at), ?teacher_id= — дисциплины преподавателя,
+// ?catalog=true — весь каталог неудалённых дисциплин, а не только свои
 func (h *DBHandler) GetCourses(w http.ResponseWriter, r *http.Request) {
 	userID, ok := GetUserID(r)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "User not authenticated")
 		return
 	}
-	// Определяем, является ли пользователь студентом (нет разрешений на управление курсами)
-	isStudent := true
-	permissions, _ := GetPermissions(r)
-	for _, p := range permissions {
-		if strings.HasPrefix(p, "course:") || strings.HasPrefix(p, "quest:") {
-			isStudent = false
-			break
-		}
+	var errs fieldErrors
+	filter := store.CourseFilter{
+		ListOptions: listOptions(r, []string{"id", "name", "created_at"}, "-created_at", &errs),
+		TeacherID:   parseIDParam(r, "teacher_id", &errs),
+	}
+	catalog := parseBoolParam(r, "catalog", &errs)
+	if err := errs.err(); err != nil {
+		writeInvalid(w, r, err)
+		return
 	}
-	var rows *sql.Rows
-	var err error
-	if isStudent {
-		// Студенты видят ВСЕ курсы
-		rows, err = h.DB.Query(`
-			SELECT id, name, description, teacher_id, created_at
-			FROM courses
-			ORDER BY created_at DESC
-		`)
-	} else {
-		// Преподаватели и админы — только свои или записанные
-		rows, err = h.DB.Query(`
-			SELECT c.id, c.name, c.description, c.teacher_id, c.created_at
-			FROM courses c
-			WHERE c.teacher_id = $1
-			OR EXISTS(SELECT 1 FROM user_courses uc WHERE uc.user_id = $1 AND uc.course_id = c.id)
-		`, userID)
+	if catalog == nil || !*catalog {
+		filter.MemberID = userID
 	}
+	courses, next, err := h.Store.Courses(filter)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
 		return
 	}
-	defer rows.Close()
-	var courses []models.Course
-	for rows.Next() {
-		var c models.Course
-		err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.TeacherID, &c.CreatedAt)
-		if err != nil {
-			http.Error(w, "Scan error", http.StatusInternalServerError)
-			return
-		}
-		courses = append(courses, c)
+	if courses == nil {
+		courses = []models.Course{}
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(courses)
+	writePage(w, r, courses, next)
 }
 
 // GetCourse возвращает информацию о дисциплине
@@ -88,24 +69,19 @@ func (h *DBHandler) GetCourse(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	courseID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid course ID", http.StatusBadRequest)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid course ID")
 		return
 	}
-	if !CheckCourseAccess(h.DB, r, courseID) {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	if !CheckCourseAccess(h.Store, r, courseID) && !CheckCourseMembership(h.Store, r, courseID) {
+		WriteError(w, r, http.StatusForbidden, CodeNotEnrolled, "You are not enrolled in this course")
 		return
 	}
-	var c models.Course
-	err = h.DB.QueryRow(`
-		SELECT id, name, description, teacher_id, created_at
-		FROM courses
-		WHERE id = $1
-	`, courseID).Scan(&c.ID, &c.Name, &c.Description, &c.TeacherID, &c.CreatedAt)
-	if err == sql.ErrNoRows {
-		http.NotFound(w, r)
+	c, err := h.Store.Course(courseID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Not found")
 		return
 	} else if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -119,143 +95,163 @@ func (h *DBHandler) CreateCourse(w http.ResponseWriter, r *http.Request) {
 		Description string `json:"description"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
 		return
 	}
-	if input.Name == "" || input.Description == "" {
-		http.Error(w, "Name and description are required", http.StatusBadRequest)
-		return
+	var invalid fieldErrors
+	if input.Name == "" {
+		invalid.add("name", "name is required")
 	}
-	userID, ok := GetUserID(r)
-	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
-		return
+	if input.Description == "" {
+		invalid.add("description", "description is required")
 	}
-	now := time.Now()
-	tx, err := h.DB.Begin()
-	if err != nil {
-		http.Error(w, "Transaction error", http.StatusInternalServerError)
+	if err := invalid.err(); err != nil {
+		writeInvalid(w, r, err)
 		return
 	}
-	defer tx.Rollback()
-	var courseID int
-	err = tx.QueryRow(`
-		INSERT INTO courses (name, description, teacher_id, created_at)
-		VALUES ($1, $2, $3, $4) RETURNING id
-	`, input.Name, input.Description, userID, now).Scan(&courseID)
-	if err != nil {
-		http.Error(w, "Failed to create course", http.StatusInternalServerError)
-		return
-	}
-	_, err = tx.Exec(`
-		INSERT INTO user_courses (user_id, course_id, role, created_at)
-		VALUES ($1, $2, 'teacher', $3)
-	`, userID, courseID, now)
-	if err != nil {
-		http.Error(w, "Failed to assign teacher role", http.StatusInternalServerError)
-		return
-	}
-	if err = tx.Commit(); err != nil {
-		http.Error(w, "Transaction commit failed", http.StatusInternalServerError)
+	userID, ok := GetUserID(r)
+	if !ok {
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "User not authenticated")
 		return
 	}
+	// Преподаватель записывается на дисциплину вместе с её созданием
 	course := models.Course{
-		ID:          courseID,
 		Name:        input.Name,
 		Description: input.Description,
 		TeacherID:   userID,
-		CreatedAt:   now,
+		CreatedAt:   time.Now(),
+	}
+	if err := h.Store.CreateCourse(&course); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to create course")
+		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(course)
 }
 
-// CreateTest создаёт новый тест в указанном курсе
+// CreateTest создаёт новый тест в указанном курсе. Настройки, отличные от значений
+// по умолчанию, требуют course:test:write, как и их последующее изменение
 func (h *DBHandler) CreateTest(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		CourseID int    `json:"course_id"`
-		Name     string `json:"name"`
+		CourseID         int        `json:"course_id"`
+		Name             string     `json:"name"`
+		Kind             string     `json:"kind"`
+		Anonymous        bool       `json:"anonymous"`
+		AllowReview      bool       `json:"allow_review"`
+		TimeLimit        *int       `json:"time_limit_seconds"`
+		OpensAt          *time.Time `json:"opens_at"`
+		ClosesAt         *time.Time `json:"closes_at"`
+		MaxAttempts      *int       `json:"max_attempts"`
+		Cooldown         *int       `json:"cooldown_seconds"`
+		GradingPolicy    string     `json:"grading_policy"`
+		ShuffleQuestions bool       `json:"shuffle_questions"`
+		ShuffleOptions   bool       `json:"shuffle_options"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
 		return
 	}
-	if input.CourseID <= 0 || input.Name == "" {
-		http.Error(w, "course_id and name are required", http.StatusBadRequest)
-		return
+	// Проверяем все поля сразу, чтобы клиент получил полный список ошибок
+	var invalid fieldErrors
+	if input.CourseID <= 0 {
+		invalid.add("course_id", "course_id is required")
+	}
+	if input.Name == "" {
+		invalid.add("name", "name is required")
+	}
+	if input.Kind == "" {
+		input.Kind = models.TestKindQuiz
 	}
-	if !CheckCourseAccess(h.DB, r, input.CourseID) {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	if input.Kind != models.TestKindQuiz && input.Kind != models.TestKindSurvey {
+		invalid.add("kind", "kind must be quiz or survey")
+	} else if input.Anonymous && input.Kind != models.TestKindSurvey {
+		// Анонимными могут быть только опросы
+		invalid.add("anonymous", "Only surveys can be anonymous")
+	}
+	invalid.addErr(validateSchedule(input.TimeLimit, input.OpensAt, input.ClosesAt))
+	if input.GradingPolicy == "" {
+		input.GradingPolicy = models.GradingBest
+	}
+	invalid.addErr(validatePolicy(input.MaxAttempts, input.Cooldown, input.GradingPolicy))
+	if err := invalid.err(); err != nil {
+		writeInvalid(w, r, err)
 		return
 	}
-	now := time.Now()
-	var testID int
-	err := h.DB.QueryRow(`
-		INSERT INTO tests (course_id, name, active, created_at)
-		VALUES ($1, $2, false, $3) RETURNING id
-	`, input.CourseID, input.Name, now).Scan(&testID)
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	if !CheckTeacherAccess(h.Store, r, input.CourseID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
 		return
 	}
 	test := models.Test{
-		ID:        testID,
-		CourseID:  input.CourseID,
-		Name:      input.Name,
-		Active:    false,
-		CreatedAt: now,
+		CourseID:         input.CourseID,
+		Name:             input.Name,
+		Kind:             input.Kind,
+		Anonymous:        input.Anonymous,
+		Active:           false,
+		AllowReview:      input.AllowReview,
+		TimeLimit:        input.TimeLimit,
+		OpensAt:          input.OpensAt,
+		ClosesAt:         input.ClosesAt,
+		MaxAttempts:      input.MaxAttempts,
+		Cooldown:         input.Cooldown,
+		GradingPolicy:    input.GradingPolicy,
+		ShuffleQuestions: input.ShuffleQuestions,
+		ShuffleOptions:   input.ShuffleOptions,
+		CreatedAt:        time.Now(),
+	}
+	if hasTestSettings(test) && !CheckPermission(r, "course:test:write") {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Test settings require course:test:write")
+		return
+	}
+	if err := h.Store.CreateTest(&test); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(test)
 }
 
-// GetCourseTests возвращает список тестов для дисциплины
+// GetCourseTests возвращает страницу тестов дисциплины.
+// Параметры: общие параметры списков (см. listOptions; sort=id|name|created_at,
+// по умолчанию created_at), ?active=true|false, ?kind=quiz|survey
 func (h *DBHandler) GetCourseTests(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	courseID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid course ID", http.StatusBadRequest)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid course ID")
 		return
 	}
-	if !CheckCourseAccess(h.DB, r, courseID) {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	if !CheckCourseAccess(h.Store, r, courseID) && !CheckCourseMembership(h.Store, r, courseID) {
+		WriteError(w, r, http.StatusForbidden, CodeNotEnrolled, "You are not enrolled in this course")
 		return
 	}
-	rows, err := h.DB.Query(`
-		SELECT id, name, course_id, active, created_at
-		FROM tests
-		WHERE course_id = $1
-	`, courseID)
+	var errs fieldErrors
+	filter := store.TestFilter{
+		ListOptions: listOptions(r, []string{"id", "name", "created_at"}, "created_at", &errs),
+		CourseID:    courseID,
+		Active:      parseBoolParam(r, "active", &errs),
+		Kind:        r.URL.Query().Get("kind"),
+	}
+	if err := errs.err(); err != nil {
+		writeInvalid(w, r, err)
+		return
+	}
+	tests, next, err := h.Store.CourseTests(filter)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
 		return
 	}
-	defer rows.Close()
-	var tests []models.Test
-	for rows.Next() {
-		var t models.Test
-		err := rows.Scan(&t.ID, &t.Name, &t.CourseID, &t.Active, &t.CreatedAt)
-		if err != nil {
-			http.Error(w, "Scan error", http.StatusInternalServerError)
-			return
+	// Статистика попыток — только для авторов дисциплины
+	if !CheckAuthorAccess(h.Store, r, courseID) {
+		for i := range tests {
+			tests[i].Stats = nil
 		}
-		// Загружаем ID вопросов
-		qRows, err := h.DB.Query("SELECT id FROM questions WHERE test_id = $1", t.ID)
-		if err != nil {
-			continue
-		}
-		for qRows.Next() {
-			var qid int
-			qRows.Scan(&qid)
-			t.Questions = append(t.Questions, qid)
-		}
-		qRows.Close()
-		tests = append(tests, t)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(tests)
+	if tests == nil {
+		tests = []models.Test{}
+	}
+	writePage(w, r, tests, next)
 }
 
 // GetTest возвращает информацию о тесте
@@ -263,31 +259,23 @@ func (h *DBHandler) GetTest(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	testID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid test ID", http.StatusBadRequest)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid test ID")
 		return
 	}
-	var t models.Test
-	err = h.DB.QueryRow(`
-		SELECT id, name, course_id, active, created_at
-		FROM tests
-		WHERE id = $1
-	`, testID).Scan(&t.ID, &t.Name, &t.CourseID, &t.Active, &t.CreatedAt)
-	if err == sql.ErrNoRows {
-		http.NotFound(w, r)
+	t, err := h.Store.Test(testID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Not found")
 		return
 	} else if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
 		return
 	}
-	// Загружаем вопросы
-	qRows, err := h.DB.Query("SELECT id FROM questions WHERE test_id = $1", testID)
-	if err == nil {
-		for qRows.Next() {
-			var qid int
-			qRows.Scan(&qid)
-			t.Questions = append(t.Questions, qid)
-		}
-		qRows.Close()
+	// Загружаем вопросы: студенту с незавершённой попыткой — его вариант
+	if userID, ok := GetUserID(r); ok && !CheckAuthorAccess(h.Store, r, t.CourseID) {
+		t.Questions, _ = h.Store.ActivePaper(userID, testID)
+	}
+	if len(t.Questions) == 0 {
+		t.Questions, _ = h.Store.TestQuestionIDs(testID)
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(t)
@@ -298,24 +286,34 @@ func (h *DBHandler) ActivateTest(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	testID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid test ID", http.StatusBadRequest)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid test ID")
 		return
 	}
-	var courseID int
-	err = h.DB.QueryRow("SELECT course_id FROM tests WHERE id = $1", testID).Scan(&courseID)
+	t, err := h.Store.Test(testID)
 	if err != nil {
-		http.Error(w, "Test not found", http.StatusNotFound)
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Test not found")
 		return
 	}
-	if !CheckCourseAccess(h.DB, r, courseID) {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	if !CheckCourseAccess(h.Store, r, t.CourseID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
 		return
 	}
-	_, err = h.DB.Exec("UPDATE tests SET active = true WHERE id = $1", testID)
+	opened, err := h.Store.SetTestActive(testID, true)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
 		return
 	}
+	// Уведомляем студентов только при фактическом открытии теста
+	if opened {
+		c, err := h.Store.Course(t.CourseID)
+		if err == nil {
+			message := fmt.Sprintf("Открыт тест «%s» в курсе «%s»", t.Name, c.Name)
+			err = h.Store.NotifyCourseStudents(t.CourseID, NotificationTestActivated, message)
+		}
+		if err != nil {
+			log.Printf("Failed to notify students of course %d: %v", t.CourseID, err)
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message": "Test activated",
@@ -328,22 +326,20 @@ func (h *DBHandler) DeactivateTest(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	testID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid test ID", http.StatusBadRequest)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid test ID")
 		return
 	}
-	var courseID int
-	err = h.DB.QueryRow("SELECT course_id FROM tests WHERE id = $1", testID).Scan(&courseID)
+	t, err := h.Store.Test(testID)
 	if err != nil {
-		http.Error(w, "Test not found", http.StatusNotFound)
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Test not found")
 		return
 	}
-	if !CheckCourseAccess(h.DB, r, courseID) {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	if !CheckCourseAccess(h.Store, r, t.CourseID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
 		return
 	}
-	_, err = h.DB.Exec("UPDATE tests SET active = false WHERE id = $1", testID)
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	if _, err = h.Store.SetTestActive(testID, false); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -353,178 +349,314 @@ func (h *DBHandler) DeactivateTest(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// CreateQuestion создаёт новый вопрос
+// CreateQuestion создаёт вопрос в банке дисциплины. Если указан test_id,
+// вопрос создаётся в банке дисциплины теста и сразу добавляется в конец теста
 func (h *DBHandler) CreateQuestion(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		TestID        int      `json:"test_id"`
-		Text          string   `json:"text"`
-		Options       []string `json:"options"`
-		CorrectAnswer int      `json:"correct_answer"`
+		TestID        int             `json:"test_id"`
+		CourseID      int             `json:"course_id"`
+		Kind          string          `json:"kind"`
+		Type          string          `json:"type"`
+		Text          string          `json:"text"`
+		Options       []string        `json:"options"`
+		Matches       []string        `json:"matches"`
+		CorrectAnswer json.RawMessage `json:"correct_answer"`
+		Tags          []string        `json:"tags"`
+		Points        float64         `json:"points"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	question := models.Question{
+		CourseID:      input.CourseID,
+		Kind:          input.Kind,
+		Type:          input.Type,
+		Text:          input.Text,
+		Options:       input.Options,
+		Matches:       input.Matches,
+		CorrectAnswer: input.CorrectAnswer,
+		Tags:          normalizeTags(input.Tags),
+	}
+	// Вопрос теста берёт дисциплину и вид из теста
+	if input.TestID > 0 {
+		t, err := h.Store.Test(input.TestID)
+		if err == store.ErrNotFound {
+			WriteError(w, r, http.StatusNotFound, CodeNotFound, "Test not found")
+			return
+		} else if err != nil {
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+			return
+		}
+		question.CourseID, question.Kind = t.CourseID, t.Kind
+	} else if question.CourseID <= 0 {
+		writeInvalid(w, r, invalidField("test_id", "test_id or course_id is required"))
 		return
 	}
-	if input.Text == "" || len(input.Options) < 2 {
-		http.Error(w, "Text and at least 2 options are required", http.StatusBadRequest)
+	if question.Kind == "" {
+		question.Kind = models.TestKindQuiz
+	}
+	if question.Kind != models.TestKindQuiz && question.Kind != models.TestKindSurvey {
+		writeInvalid(w, r, invalidField("kind", "kind must be quiz or survey"))
 		return
 	}
-	if input.CorrectAnswer < 0 || input.CorrectAnswer >= len(input.Options) {
-		http.Error(w, "Correct answer index out of range", http.StatusBadRequest)
+	if input.Points < 0 {
+		writeInvalid(w, r, invalidField("points", "points must be positive"))
 		return
 	}
-	// Проверяем, что пользователь имеет доступ к курсу этого теста
-	var courseID int
-	err := h.DB.QueryRow("SELECT course_id FROM tests WHERE id = $1", input.TestID).Scan(&courseID)
-	if err != nil {
-		http.Error(w, "Test not found", http.StatusNotFound)
+	// Проверяем, что пользователь имеет доступ к курсу
+	if !CheckCourseAccess(h.Store, r, question.CourseID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
 		return
 	}
-	if !CheckCourseAccess(h.DB, r, courseID) {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	if err := validateQuestion(&question, question.Kind); err != nil {
+		writeInvalid(w, r, err)
 		return
 	}
-	now := time.Now()
-	var questionID int
-	err = h.DB.QueryRow(`
-		INSERT INTO questions (test_id, text, options, correct_answer, created_at)
-		VALUES ($1, $2, $3, $4, $5) RETURNING id
-	`, input.TestID, input.Text, pq.Array(input.Options), input.CorrectAnswer, now).Scan(&questionID)
+	tx, err := h.Store.Begin()
 	if err != nil {
-		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction error")
 		return
 	}
-	question := models.Question{
-		ID:            questionID,
-		TestID:        input.TestID,
-		Text:          input.Text,
-		Options:       input.Options,
-		CorrectAnswer: input.CorrectAnswer,
-		CreatedAt:     now,
+	defer tx.Rollback()
+	question.CreatedAt = time.Now()
+	if err = tx.CreateQuestion(&question); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if input.TestID > 0 {
+		question.TestID = input.TestID
+		question.Points = input.Points
+		if question.Points == 0 {
+			question.Points = 1
+		}
+		question.Position, err = tx.LinkQuestion(input.TestID, question.ID, 0, question.Points)
+		if err != nil {
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+			return
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction commit failed")
+		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(question)
 }
 
-// GetQuestion возвращает информацию о вопросе
+// GetQuestion возвращает информацию о вопросе: полную для авторов курса и без ключа для остальных
 func (h *DBHandler) GetQuestion(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	questionID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid question ID", http.StatusBadRequest)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid question ID")
 		return
 	}
-	var q models.Question
-	err = h.DB.QueryRow(`
-		SELECT id, test_id, text, options, correct_answer, created_at
-		FROM questions
-		WHERE id = $1
-	`, questionID).Scan(&q.ID, &q.TestID, &q.Text, pq.Array(&q.Options), &q.CorrectAnswer, &q.CreatedAt)
-	if err == sql.ErrNoRows {
-		http.NotFound(w, r)
+	q, err := h.Store.Question(questionID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Not found")
 		return
 	} else if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(q)
+	// Авторы курса видят вопрос целиком, вместе с правильным ответом
+	if CheckAuthorAccess(h.Store, r, q.CourseID) {
+		json.NewEncoder(w).Encode(q)
+		return
+	}
+	// Во время попытки вопрос показывается так, как он выпал в варианте
+	userID, _ := GetUserID(r)
+	if p, err := h.Store.ActivePaperQuestion(userID, questionID); err == nil {
+		json.NewEncoder(w).Encode(presentQuestion(p))
+		return
+	}
+	// Удалённый вопрос видят только авторы и те, кому он уже выпал в попытке
+	if q.DeletedAt != nil {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Not found")
+		return
+	}
+	// Остальным отдаём вопрос без ключа, если у них есть право на чтение или попытка по тесту с этим вопросом
+	if !CheckQuestionAccess(h.Store, r, questionID) && !HasQuestionAttempt(h.Store, r, questionID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+		return
+	}
+	json.NewEncoder(w).Encode(studentQuestion(q, r.URL.Query().Get("shuffle") == "true", userID))
 }
 
-// UpdateQuestion обновляет вопрос
+// UpdateQuestion сохраняет изменения вопроса как новую версию.
+// Уже данные ответы остаются привязаны к версии, на которую отвечали
 func (h *DBHandler) UpdateQuestion(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	questionID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid question ID", http.StatusBadRequest)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid question ID")
 		return
 	}
 	var input struct {
-		Text          string   `json:"text"`
-		Options       []string `json:"options"`
-		CorrectAnswer int      `json:"correct_answer"`
+		Type          string          `json:"type"`
+		Text          string          `json:"text"`
+		Options       []string        `json:"options"`
+		Matches       []string        `json:"matches"`
+		CorrectAnswer json.RawMessage `json:"correct_answer"`
+		Tags          []string        `json:"tags"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
 		return
 	}
-	if input.Text == "" || len(input.Options) < 2 {
-		http.Error(w, "Text and at least 2 options are required", http.StatusBadRequest)
+	question := models.Question{
+		ID:            questionID,
+		Type:          input.Type,
+		Text:          input.Text,
+		Options:       input.Options,
+		Matches:       input.Matches,
+		CorrectAnswer: input.CorrectAnswer,
+		Tags:          normalizeTags(input.Tags),
+	}
+	tx, err := h.Store.Begin()
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction start failed")
 		return
 	}
-	if input.CorrectAnswer < 0 || input.CorrectAnswer >= len(input.Options) {
-		http.Error(w, "Correct answer index out of range", http.StatusBadRequest)
+	defer tx.Rollback()
+	// Проверяем доступ через курс и блокируем вопрос, чтобы номера версий не пересеклись
+	current, err := tx.LockQuestion(questionID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Question not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
 		return
 	}
-	// Проверяем доступ через курс
-	var courseID int
-	err = h.DB.QueryRow(`
-		SELECT c.id
-		FROM questions q
-		JOIN tests t ON q.test_id = t.id
-		JOIN courses c ON t.course_id = c.id
-		WHERE q.id = $1
-	`, questionID).Scan(&courseID)
-	if err != nil {
-		http.Error(w, "Question not found", http.StatusNotFound)
+	if !CheckCourseAccess(h.Store, r, current.CourseID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
 		return
 	}
-	if !CheckCourseAccess(h.DB, r, courseID) {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	// Если тип не передан, он остаётся прежним
+	if question.Type == "" {
+		question.Type = current.Type
+	}
+	if err := validateQuestion(&question, current.Kind); err != nil {
+		writeInvalid(w, r, err)
 		return
 	}
-	_, err = h.DB.Exec(`
-		UPDATE questions
-		SET text = $1, options = $2, correct_answer = $3, created_at = CURRENT_TIMESTAMP
-		WHERE id = $4
-	`, input.Text, input.Options, input.CorrectAnswer, questionID)
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	q := question
+	if err := tx.UpdateQuestion(&q); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction commit failed")
 		return
 	}
-	// Возвращаем обновлённый вопрос
-	var q models.Question
-	h.DB.QueryRow(`
-		SELECT id, test_id, text, options, correct_answer, created_at
-		FROM questions WHERE id = $1
-	`, questionID).Scan(&q.ID, &q.TestID, &q.Text, pq.Array(&q.Options), &q.CorrectAnswer, &q.CreatedAt)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(q)
 }
 
-// DeleteQuestion удаляет вопрос (на самом деле — физически, так как нет is_deleted)
+// DeleteQuestion помечает вопрос удалённым: он пропадает из банка и из тестов,
+// но ответы студентов и история версий сохраняются
 func (h *DBHandler) DeleteQuestion(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	questionID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid question ID", http.StatusBadRequest)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid question ID")
 		return
 	}
 	// Проверяем доступ
-	var courseID int
-	err = h.DB.QueryRow(`
-		SELECT c.id
-		FROM questions q
-		JOIN tests t ON q.test_id = t.id
-		JOIN courses c ON t.course_id = c.id
-		WHERE q.id = $1
-	`, questionID).Scan(&courseID)
+	q, err := h.Store.Question(questionID)
+	if err == nil && q.DeletedAt != nil {
+		err = store.ErrNotFound
+	}
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Question not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if !CheckCourseAccess(h.Store, r, q.CourseID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+		return
+	}
+	// Связи с тестами оставляем, чтобы восстановленный вопрос вернулся на свои места
+	err = h.Store.DeleteQuestion(questionID, time.Now())
+	if err != nil && err != store.ErrNotFound {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Question deleted"})
+}
+
+// RestoreQuestion восстанавливает удалённый вопрос вместе с его местами в тестах
+func (h *DBHandler) RestoreQuestion(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	questionID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Question not found", http.StatusNotFound)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid question ID")
+		return
+	}
+	deleted, err := h.Store.Question(questionID)
+	if err == nil && deleted.DeletedAt == nil {
+		err = store.ErrNotFound
+	}
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Deleted question not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if !CheckCourseAccess(h.Store, r, deleted.CourseID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+		return
+	}
+	q, err := h.Store.RestoreQuestion(questionID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Deleted question not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(q)
+}
+
+// GetQuestionVersions возвращает историю версий вопроса от первой к последней.
+// Доступна авторам курса, в том числе для удалённых вопросов
+func (h *DBHandler) GetQuestionVersions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	questionID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid question ID")
+		return
+	}
+	q, err := h.Store.Question(questionID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Question not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
 		return
 	}
-	if !CheckCourseAccess(h.DB, r, courseID) {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	if !CheckAuthorAccess(h.Store, r, q.CourseID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
 		return
 	}
-	_, err = h.DB.Exec("DELETE FROM questions WHERE id = $1", questionID)
+	versions, err := h.Store.QuestionVersions(questionID)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
 		return
 	}
+	if versions == nil {
+		versions = []models.QuestionVersion{}
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Question deleted"})
+	json.NewEncoder(w).Encode(versions)
 }
 
 // CreateAttempt создаёт новую попытку прохождения теста
@@ -532,49 +664,112 @@ func (h *DBHandler) CreateAttempt(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	testID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid test ID", http.StatusBadRequest)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid test ID")
 		return
 	}
 	// Проверяем, что тест активен
-	var active bool
-	err = h.DB.QueryRow("SELECT active FROM tests WHERE id = $1", testID).Scan(&active)
-	if err != nil {
-		http.Error(w, "Test not found", http.StatusNotFound)
+	t, err := h.Store.Test(testID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Test not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if !t.Active {
+		WriteError(w, r, http.StatusBadRequest, CodeTestInactive, "Test is not active")
 		return
 	}
-	if !active {
-		http.Error(w, "Test is not active", http.StatusBadRequest)
+	// Проверяем окно доступности теста
+	now := time.Now()
+	if t.OpensAt != nil && now.Before(*t.OpensAt) {
+		WriteError(w, r, http.StatusBadRequest, CodeTestNotOpen, "Test is not open yet")
+		return
+	}
+	if t.ClosesAt != nil && !now.Before(*t.ClosesAt) {
+		WriteError(w, r, http.StatusBadRequest, CodeTestClosed, "Test is closed")
 		return
 	}
 	userID, ok := GetUserID(r)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "User not authenticated")
 		return
 	}
-	// Проверяем, нет ли уже активной попытки
-	var exists bool
-	h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM attempts WHERE user_id = $1 AND test_id = $2 AND finished = false)", userID, testID).Scan(&exists)
-	if exists {
-		http.Error(w, "You already have an active attempt", http.StatusBadRequest)
+	// Попытка создаётся вместе со своим вариантом: набор вопросов и порядок вариантов фиксируются.
+	// Проверки ниже выполняются в той же транзакции под блокировкой пары (тест, пользователь),
+	// иначе два одновременных запроса могли бы оба их пройти
+	tx, err := h.Store.Begin()
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction error")
 		return
 	}
-	now := time.Now()
-	var attemptID int
-	err = h.DB.QueryRow(`
-		INSERT INTO attempts (user_id, test_id, finished, created_at)
-		VALUES ($1, $2, false, $3) RETURNING id
-	`, userID, testID, now).Scan(&attemptID)
+	defer tx.Rollback()
+	if err = tx.LockUserTest(testID, userID); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	// Проверяем, нет ли уже активной попытки
+	exists, err := tx.HasActiveAttempt(userID, testID)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
 		return
 	}
+	if exists {
+		WriteError(w, r, http.StatusBadRequest, CodeAttemptActive, "You already have an active attempt")
+		return
+	}
+	// Опрос проходят один раз
+	if t.Kind == models.TestKindSurvey {
+		done, err := tx.HasSurveyResponse(testID, userID)
+		if err != nil {
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+			return
+		}
+		if done {
+			WriteError(w, r, http.StatusBadRequest, CodeSurveyCompleted, "You have already completed this survey")
+			return
+		}
+	}
+	// Проверяем ограничения на пересдачу
+	if t.MaxAttempts != nil || t.Cooldown != nil {
+		used, lastFinished, err := tx.AttemptUsage(userID, testID)
+		if err != nil {
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+			return
+		}
+		if t.MaxAttempts != nil && used >= *t.MaxAttempts {
+			WriteError(w, r, http.StatusForbidden, CodeAttemptLimitReached, "Attempt limit reached")
+			return
+		}
+		if next := nextAttemptAt(lastFinished, t.Cooldown); next != nil && now.Before(*next) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(next.Sub(now).Seconds()))))
+			writeErrorDetails(w, r, http.StatusTooManyRequests, CodeAttemptCooldown, "Next attempt is available at "+next.Format(time.RFC3339),
+				map[string]interface{}{"available_at": next})
+			return
+		}
+	}
 	attempt := models.Attempt{
-		ID:        attemptID,
 		UserID:    userID,
 		TestID:    testID,
-		Finished:  false,
+		ExpiresAt: attemptExpiry(now, t.TimeLimit, t.ClosesAt),
 		CreatedAt: now,
 	}
+	if err = tx.CreateAttempt(&attempt); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	attempt.Questions, err = buildAttemptPaper(tx, attempt.ID, t)
+	if errors.As(err, new(poolTooSmallError)) {
+		WriteError(w, r, http.StatusConflict, CodePoolTooSmall, err.Error())
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction commit failed")
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(attempt)
@@ -585,53 +780,39 @@ func (h *DBHandler) GetAttempt(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	attemptID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid attempt ID", http.StatusBadRequest)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid attempt ID")
 		return
 	}
 	userID, ok := GetUserID(r)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "User not authenticated")
 		return
 	}
 	// Проверяем, принадлежит ли попытка пользователю или он преподаватель курса
-	var ownerID, testID, courseID int
-	err = h.DB.QueryRow(`
-		SELECT a.user_id, a.test_id, t.course_id
-		FROM attempts a
-		JOIN tests t ON a.test_id = t.id
-		WHERE a.id = $1
-	`, attemptID).Scan(&ownerID, &testID, &courseID)
-	if err != nil {
-		http.Error(w, "Attempt not found", http.StatusNotFound)
+	a, t, err := attemptTest(h.Store, attemptID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Attempt not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
 		return
 	}
-	isOwner := (ownerID == userID)
-	isTeacher := false
-	if !isOwner {
-		isTeacher = CheckCourseAccess(h.DB, r, courseID)
-	}
-	if !isOwner && !isTeacher {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	if a.UserID != userID && !CheckCourseAccess(h.Store, r, t.CourseID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
 		return
 	}
-	var a models.Attempt
-	err = h.DB.QueryRow(`
-		SELECT id, user_id, test_id, finished, created_at
-		FROM attempts WHERE id = $1
-	`, attemptID).Scan(&a.ID, &a.UserID, &a.TestID, &a.Finished, &a.CreatedAt)
+	// Загружаем вариант попытки и ответы
+	paper, err := h.Store.AttemptPaper(attemptID)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
 		return
 	}
-	// Загружаем ответы
-	rows, err := h.DB.Query("SELECT id, question_id, answer, attempt_id, created_at FROM answers WHERE attempt_id = $1", attemptID)
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var ans models.Answer
-			rows.Scan(&ans.ID, &ans.QuestionID, &ans.Answer, &ans.AttemptID, &ans.CreatedAt)
-			a.Answers = append(a.Answers, ans)
-		}
+	for _, p := range paper {
+		a.Questions = append(a.Questions, p.Question.ID)
+	}
+	if a.Answers, err = h.Store.AttemptAnswers(attemptID); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(a)
@@ -642,111 +823,147 @@ func (h *DBHandler) SubmitAnswer(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	attemptID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid attempt ID", http.StatusBadRequest)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid attempt ID")
 		return
 	}
 	var input struct {
-		QuestionID int `json:"question_id"`
-		Answer     int `json:"answer"`
+		QuestionID int             `json:"question_id"`
+		Answer     json.RawMessage `json:"answer"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
 		return
 	}
 	userID, ok := GetUserID(r)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "User not authenticated")
 		return
 	}
-	// Проверяем, что попытка принадлежит пользователю и не завершена
-	var dbUserID int
-	var finished bool
-	err = h.DB.QueryRow("SELECT user_id, finished FROM attempts WHERE id = $1", attemptID).Scan(&dbUserID, &finished)
+	// Попытка блокируется до сохранения ответа, чтобы CompleteAttempt или завершение
+	// просроченных попыток не оценили её между проверкой и записью
+	tx, err := h.Store.Begin()
 	if err != nil {
-		http.Error(w, "Attempt not found", http.StatusNotFound)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction error")
+		return
+	}
+	defer tx.Rollback()
+	// Проверяем, что попытка принадлежит пользователю и не завершена
+	a, err := tx.LockAttempt(attemptID)
+	if err == nil {
+		_, err = tx.Test(a.TestID)
+	}
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Attempt not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
 		return
 	}
-	if dbUserID != userID {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	if a.UserID != userID {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
 		return
 	}
-	if finished {
-		http.Error(w, "Attempt is already finished", http.StatusBadRequest)
+	if a.Finished {
+		WriteError(w, r, http.StatusBadRequest, CodeAttemptFinished, "Attempt is already finished")
 		return
 	}
-	// Проверяем, что вопрос существует в этом тесте
-	var testID int
-	h.DB.QueryRow("SELECT test_id FROM attempts WHERE id = $1", attemptID).Scan(&testID)
-	var exists bool
-	h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM questions WHERE id = $1 AND test_id = $2)", input.QuestionID, testID).Scan(&exists)
-	if !exists {
-		http.Error(w, "Question not found in this test", http.StatusBadRequest)
+	if attemptExpired(a.ExpiresAt, time.Now()) {
+		WriteError(w, r, http.StatusBadRequest, CodeAttemptExpired, "Attempt time is over")
 		return
 	}
-	// Сохраняем ответ
-	now := time.Now()
-	var answerID int
-	err = h.DB.QueryRow(`
-		INSERT INTO answers (attempt_id, question_id, answer, created_at)
-		VALUES ($1, $2, $3, $4) RETURNING id
-	`, attemptID, input.QuestionID, input.Answer, now).Scan(&answerID)
+	// Проверяем, что вопрос входит в вариант попытки
+	p, err := tx.PaperQuestion(attemptID, input.QuestionID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusBadRequest, CodeNotInTest, "Question not found in this test")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	// Проверяем ответ по типу вопроса; номера вариантов приходят в порядке показа
+	answer, err := canonicalAnswer(p, input.Answer)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		writeInvalid(w, r, invalidField("answer", err.Error()))
 		return
 	}
-	ans := models.Answer{
-		ID:         answerID,
-		AttemptID:  attemptID,
-		QuestionID: input.QuestionID,
-		Answer:     input.Answer,
-		CreatedAt:  now,
+	// Сохраняем ответ: новый ответ на тот же вопрос заменяет предыдущий
+	ans, err := tx.SaveAnswer(attemptID, input.QuestionID, answer, time.Now())
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction commit failed")
+		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(ans)
 }
 
-// CompleteAttempt завершает попытку
+// CompleteAttempt завершает попытку и выставляет оценку
 func (h *DBHandler) CompleteAttempt(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	attemptID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid attempt ID", http.StatusBadRequest)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid attempt ID")
 		return
 	}
 	userID, ok := GetUserID(r)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "User not authenticated")
 		return
 	}
-	var dbUserID int
-	var finished bool
-	err = h.DB.QueryRow("SELECT user_id, finished FROM attempts WHERE id = $1", attemptID).Scan(&dbUserID, &finished)
+	tx, err := h.Store.Begin()
 	if err != nil {
-		http.Error(w, "Attempt not found", http.StatusNotFound)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction error")
 		return
 	}
-	if dbUserID != userID {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	defer tx.Rollback()
+	a, err := tx.LockAttempt(attemptID)
+	if err == nil {
+		// Попытки удалённого теста не завершаются
+		_, err = tx.Test(a.TestID)
+	}
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Attempt not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if a.UserID != userID {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+		return
+	}
+	if a.Finished {
+		WriteError(w, r, http.StatusBadRequest, CodeAttemptFinished, "Attempt is already finished")
 		return
 	}
-	if finished {
-		http.Error(w, "Attempt is already finished", http.StatusBadRequest)
+	// Проверяем, ответил ли на все вопросы (если время вышло, завершаем с тем, что есть)
+	total, answered, err := tx.AttemptProgress(attemptID)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
 		return
 	}
-	// Проверяем, ответил ли на все вопросы
-	var testID int
-	h.DB.QueryRow("SELECT test_id FROM attempts WHERE id = $1", attemptID).Scan(&testID)
-	var total, answered int
-	h.DB.QueryRow("SELECT COUNT(*), (SELECT COUNT(*) FROM answers WHERE attempt_id = $1) FROM questions WHERE test_id = $2", attemptID, testID).Scan(&total, &answered)
-	if answered < total {
-		http.Error(w, "Not all questions answered", http.StatusBadRequest)
+	if answered < total && !attemptExpired(a.ExpiresAt, time.Now()) {
+		WriteError(w, r, http.StatusBadRequest, CodeAnswersIncomplete, "Not all questions answered")
 		return
 	}
-	_, err = h.DB.Exec("UPDATE attempts SET finished = true WHERE id = $1", attemptID)
+	// Проверяем ответы и сохраняем результат
+	result, err := completeAttempt(tx, attemptID)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction commit failed")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Attempt completed"})
-}
\ No newline at end of file
+	// Опросы не оцениваются
+	if result == nil {
+		json.NewEncoder(w).Encode(map[string]string{"message": "Survey submitted"})
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testapplogic/models"
+	"testapplogic/store"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Разрешения ролей так же, как их выдаёт модуль авторизации (AuthorModule/src/Permissions.hpp)
+var (
+	teacherPermissions = []string{"user:data:read",
+		"course:testList", "course:test:read", "course:userList", "course:user:add",
+		"course:user:del", "course:add",
+		"quest:list:read", "quest:read", "quest:create"}
+	adminPermissions = []string{"user:list:read", "user:fullName:write", "user:data:read", "user:roles:read",
+		"user:roles:write", "user:block:read", "user:block:write",
+		"course:info:write", "course:testList", "course:test:read", "course:test:write",
+		"course:test:add", "course:test:del", "course:userList", "course:user:add",
+		"course:user:del", "course:add", "course:del",
+		"quest:list:read", "quest:read", "quest:update", "quest:create", "quest:del",
+		"test:quest:del", "test:quest:add", "test:quest:update", "test:answer:read",
+		"answer:read", "answer:update", "answer:del"}
+	studentPermissions = []string{}
+)
+
+// call выполняет обработчик от имени пользователя с разрешениями и переменными пути
+func call(handler http.HandlerFunc, method, body string, userID int, permissions []string, vars map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/", strings.NewReader(body))
+	ctx := context.WithValue(r.Context(), "user_id", userID)
+	ctx = context.WithValue(ctx, "permissions", permissions)
+	r = mux.SetURLVars(r.WithContext(ctx), vars)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// decode разбирает JSON-ответ и проверяет код ответа
+func decode(t *testing.T, w *httptest.ResponseRecorder, status int, v interface{}) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status %d, want %d: %s", w.Code, status, w.Body.String())
+	}
+	if v != nil {
+		if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+	}
+}
+
+// seedCourse создаёт в памяти преподавателя, его дисциплину и активный тест
+func seedCourse(t *testing.T, mem *store.Memory) (teacherID int, course models.Course, test models.Test) {
+	t.Helper()
+	teacherID, err := mem.EnsureUser("teacher", "Teacher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	course = models.Course{Name: "Algebra", Description: "Course", TeacherID: teacherID, CreatedAt: time.Now()}
+	if err := mem.CreateCourse(&course); err != nil {
+		t.Fatal(err)
+	}
+	test = models.Test{CourseID: course.ID, Name: "Quiz", Kind: models.TestKindQuiz, Active: true,
+		GradingPolicy: models.GradingBest, CreatedAt: time.Now()}
+	if err := mem.CreateTest(&test); err != nil {
+		t.Fatal(err)
+	}
+	return teacherID, course, test
+}
+
+func TestQuestionVersions(t *testing.T) {
+	mem := store.NewMemory()
+	h := &DBHandler{Store: mem}
+	teacherID, _, test := seedCourse(t, mem)
+
+	var q models.Question
+	body := `{"test_id": ` + strconv.Itoa(test.ID) + `, "type": "single", "text": "2 + 2", "options": ["3", "4"], "correct_answer": 1}`
+	decode(t, call(h.CreateQuestion, "POST", body, teacherID, teacherPermissions, nil), http.StatusCreated, &q)
+	if q.Version != 1 || q.Position != 1 {
+		t.Fatalf("created question version %d position %d, want 1 and 1", q.Version, q.Position)
+	}
+	vars := map[string]string{"id": strconv.Itoa(q.ID)}
+	body = `{"text": "2 * 2", "options": ["4", "5"], "correct_answer": 0}`
+	decode(t, call(h.UpdateQuestion, "PUT", body, teacherID, teacherPermissions, vars), http.StatusOK, &q)
+	if q.Version != 2 || q.Type != models.QuestionSingle {
+		t.Fatalf("updated question version %d type %q, want 2 and single", q.Version, q.Type)
+	}
+	var versions []models.QuestionVersion
+	decode(t, call(h.GetQuestionVersions, "GET", "", teacherID, teacherPermissions, vars), http.StatusOK, &versions)
+	if len(versions) != 2 || versions[0].Text != "2 + 2" || versions[1].Text != "2 * 2" {
+		t.Fatalf("versions %+v, want the original and the edited text", versions)
+	}
+
+	// Удалённый вопрос пропадает из теста и возвращается на своё место после восстановления
+	testVars := map[string]string{"id": strconv.Itoa(test.ID)}
+	decode(t, call(h.DeleteQuestion, "DELETE", "", teacherID, teacherPermissions, vars), http.StatusOK, nil)
+	var questions []models.Question
+	decode(t, call(h.GetTestQuestions, "GET", "", teacherID, teacherPermissions, testVars), http.StatusOK, &questions)
+	if len(questions) != 0 {
+		t.Fatalf("test has %d questions after delete, want 0", len(questions))
+	}
+	decode(t, call(h.RestoreQuestion, "POST", "", teacherID, teacherPermissions, vars), http.StatusOK, nil)
+	decode(t, call(h.GetTestQuestions, "GET", "", teacherID, teacherPermissions, testVars), http.StatusOK, &questions)
+	if len(questions) != 1 || questions[0].ID != q.ID {
+		t.Fatalf("test questions %+v after restore, want question %d", questions, q.ID)
+	}
+	decode(t, call(h.RestoreQuestion, "POST", "", teacherID, teacherPermissions, vars), http.StatusNotFound, nil)
+}
+
+func TestAttemptFlow(t *testing.T) {
+	mem := store.NewMemory()
+	h := &DBHandler{Store: mem}
+	teacherID, course, test := seedCourse(t, mem)
+	testVars := map[string]string{"id": strconv.Itoa(test.ID)}
+
+	var q models.Question
+	body := `{"test_id": ` + strconv.Itoa(test.ID) + `, "type": "single", "text": "2 + 2", "options": ["3", "4"], "correct_answer": 1}`
+	decode(t, call(h.CreateQuestion, "POST", body, teacherID, teacherPermissions, nil), http.StatusCreated, &q)
+	courseVars := map[string]string{"id": strconv.Itoa(course.ID)}
+	var added struct {
+		UserID int `json:"user_id"`
+	}
+	decode(t, call(h.AddCourseMember, "POST", `{"user_ref": "student"}`, teacherID, teacherPermissions, courseVars), http.StatusCreated, &added)
+	studentID := added.UserID
+
+	var attempt models.Attempt
+	decode(t, call(h.CreateAttempt, "POST", "", studentID, studentPermissions, testVars), http.StatusCreated, &attempt)
+	if len(attempt.Questions) != 1 || attempt.Questions[0] != q.ID {
+		t.Fatalf("attempt paper %v, want [%d]", attempt.Questions, q.ID)
+	}
+	decode(t, call(h.CreateAttempt, "POST", "", studentID, studentPermissions, testVars), http.StatusBadRequest, nil)
+
+	attemptVars := map[string]string{"id": strconv.Itoa(attempt.ID)}
+	decode(t, call(h.CompleteAttempt, "POST", "", studentID, studentPermissions, attemptVars), http.StatusBadRequest, nil)
+	body = `{"question_id": ` + strconv.Itoa(q.ID) + `, "answer": 1}`
+	decode(t, call(h.SubmitAnswer, "POST", body, teacherID, teacherPermissions, attemptVars), http.StatusForbidden, nil)
+	var ans models.Answer
+	decode(t, call(h.SubmitAnswer, "POST", body, studentID, studentPermissions, attemptVars), http.StatusOK, &ans)
+	if ans.Revision != 1 {
+		t.Fatalf("answer revision %d, want 1", ans.Revision)
+	}
+
+	var result models.AttemptResult
+	decode(t, call(h.CompleteAttempt, "POST", "", studentID, studentPermissions, attemptVars), http.StatusOK, &result)
+	if result.Correct != 1 || result.Score != 1 || result.Percentage != 100 {
+		t.Fatalf("result %+v, want one correct answer and 100%%", result)
+	}
+	decode(t, call(h.SubmitAnswer, "POST", body, studentID, studentPermissions, attemptVars), http.StatusBadRequest, nil)
+	decode(t, call(h.GetAttemptResult, "GET", "", teacherID, teacherPermissions, attemptVars), http.StatusOK, &result)
+	if result.Score != 1 || len(result.Questions) != 1 || !result.Questions[0].Correct {
+		t.Fatalf("stored result %+v, want the graded answer", result)
+	}
+	var final models.FinalScore
+	decode(t, call(h.GetTestScore, "GET", "", studentID, studentPermissions, testVars), http.StatusOK, &final)
+	if final.Attempts != 1 || final.Percentage != 100 {
+		t.Fatalf("final score %+v, want one attempt with 100%%", final)
+	}
+
+	// Студент получил уведомления о записи на дисциплину и о проверке попытки
+	var notifications []models.Notification
+	decode(t, call(h.GetNotifications, "GET", "", studentID, studentPermissions, nil), http.StatusOK, &notifications)
+	if len(notifications) != 2 || notifications[1].Type != NotificationAttemptGraded {
+		t.Fatalf("notifications %+v, want enrollment and grading", notifications)
+	}
+}
+
+func TestAddCourseMember(t *testing.T) {
+	mem := store.NewMemory()
+	h := &DBHandler{Store: mem}
+	teacherID, course, _ := seedCourse(t, mem)
+	vars := map[string]string{"id": strconv.Itoa(course.ID)}
+
+	decode(t, call(h.AddCourseMember, "POST", `{"user_ref": "student"}`, teacherID, teacherPermissions, vars), http.StatusCreated, nil)
+	decode(t, call(h.AddCourseMember, "POST", `{"user_ref": "student"}`, teacherID, teacherPermissions, vars), http.StatusConflict, nil)
+	decode(t, call(h.AddCourseMember, "POST", `{"user_id": 999}`, teacherID, teacherPermissions, vars), http.StatusBadRequest, nil)
+	var members []models.CourseMember
+	decode(t, call(h.GetCourseMembers, "GET", "", teacherID, teacherPermissions, vars), http.StatusOK, &members)
+	if len(members) != 2 || members[0].Role != "teacher" || members[1].UserRef != "student" {
+		t.Fatalf("members %+v, want the teacher and the new student", members)
+	}
+}
+
+func TestRemoveCourseTeacher(t *testing.T) {
+	mem := store.NewMemory()
+	h := &DBHandler{Store: mem}
+	ownerID, course, _ := seedCourse(t, mem)
+	vars := map[string]string{"id": strconv.Itoa(course.ID)}
+
+	var first, second struct {
+		UserID int `json:"user_id"`
+	}
+	decode(t, call(h.AddCourseMember, "POST", `{"user_ref": "first", "role": "teacher"}`, ownerID, teacherPermissions, vars), http.StatusCreated, &first)
+	decode(t, call(h.AddCourseMember, "POST", `{"user_ref": "second", "role": "teacher"}`, ownerID, teacherPermissions, vars), http.StatusCreated, &second)
+	secondVars := map[string]string{"id": strconv.Itoa(course.ID), "user_id": strconv.Itoa(second.UserID)}
+
+	// Соавтор не может исключить другого преподавателя, владелец может
+	decode(t, call(h.RemoveCourseMember, "DELETE", "", first.UserID, teacherPermissions, secondVars), http.StatusForbidden, nil)
+	decode(t, call(h.RemoveCourseMember, "DELETE", "", ownerID, teacherPermissions, secondVars), http.StatusOK, nil)
+
+	// Преподаватель, записанный на чужую дисциплину студентом, ею не управляет
+	other := models.Course{Name: "Geometry", TeacherID: ownerID, CreatedAt: time.Now()}
+	if err := mem.CreateCourse(&other); err != nil {
+		t.Fatal(err)
+	}
+	otherVars := map[string]string{"id": strconv.Itoa(other.ID)}
+	decode(t, call(h.AddCourseMember, "POST", `{"user_ref": "second"}`, ownerID, teacherPermissions, otherVars), http.StatusCreated, nil)
+	decode(t, call(h.AddCourseMember, "POST", `{"user_ref": "third"}`, second.UserID, teacherPermissions, otherVars), http.StatusForbidden, nil)
+	decode(t, call(h.CreateCourseInvite, "POST", "", second.UserID, teacherPermissions, otherVars), http.StatusForbidden, nil)
+}
+
+func TestEnrolledTeacherGetsStudentView(t *testing.T) {
+	mem := store.NewMemory()
+	h := &DBHandler{Store: mem}
+	ownerID, course, test := seedCourse(t, mem)
+	testVars := map[string]string{"id": strconv.Itoa(test.ID)}
+
+	var q models.Question
+	body := `{"test_id": ` + strconv.Itoa(test.ID) + `, "type": "single", "text": "2 + 2", "options": ["3", "4"], "correct_answer": 1}`
+	decode(t, call(h.CreateQuestion, "POST", body, ownerID, teacherPermissions, nil), http.StatusCreated, &q)
+	// Коллега с ролью Teacher записан на дисциплину студентом
+	var enrolled struct {
+		UserID int `json:"user_id"`
+	}
+	courseVars := map[string]string{"id": strconv.Itoa(course.ID)}
+	decode(t, call(h.AddCourseMember, "POST", `{"user_ref": "colleague"}`, ownerID, teacherPermissions, courseVars), http.StatusCreated, &enrolled)
+	colleagueID := enrolled.UserID
+
+	var attempt models.Attempt
+	decode(t, call(h.CreateAttempt, "POST", "", colleagueID, teacherPermissions, testVars), http.StatusCreated, &attempt)
+	var shown map[string]interface{}
+	questionVars := map[string]string{"id": strconv.Itoa(q.ID)}
+	decode(t, call(h.GetQuestion, "GET", "", colleagueID, teacherPermissions, questionVars), http.StatusOK, &shown)
+	if _, ok := shown["correct_answer"]; ok {
+		t.Fatalf("enrolled teacher sees the answer key: %v", shown)
+	}
+	attemptVars := map[string]string{"id": strconv.Itoa(attempt.ID)}
+	body = `{"question_id": ` + strconv.Itoa(q.ID) + `, "answer": 1}`
+	decode(t, call(h.SubmitAnswer, "POST", body, colleagueID, teacherPermissions, attemptVars), http.StatusOK, nil)
+	decode(t, call(h.CompleteAttempt, "POST", "", colleagueID, teacherPermissions, attemptVars), http.StatusOK, nil)
+	decode(t, call(h.GetAttemptReview, "GET", "", colleagueID, teacherPermissions, attemptVars), http.StatusForbidden, nil)
+	decode(t, call(h.EnableReview, "POST", "", colleagueID, teacherPermissions, testVars), http.StatusForbidden, nil)
+	decode(t, call(h.GetAttemptReview, "GET", "", ownerID, teacherPermissions, attemptVars), http.StatusOK, nil)
+}
+
+func TestTestSettingsRequireTestWrite(t *testing.T) {
+	mem := store.NewMemory()
+	h := &DBHandler{Store: mem}
+	ownerID, course, test := seedCourse(t, mem)
+	vars := map[string]string{"id": strconv.Itoa(test.ID)}
+
+	// Преподаватель без course:test:write не меняет настройки ни одним из путей
+	writers := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{"schedule", h.UpdateTestSchedule, `{"time_limit_seconds": 600}`},
+		{"policy", h.UpdateTestPolicy, `{"max_attempts": 2}`},
+		{"randomization", h.UpdateTestRandomization, `{"shuffle_questions": true}`},
+		{"review", h.EnableReview, ""},
+		{"update", h.UpdateTest, `{"name": "Quiz"}`},
+	}
+	for _, wr := range writers {
+		t.Run(wr.name, func(t *testing.T) {
+			decode(t, call(wr.handler, "PUT", wr.body, ownerID, teacherPermissions, vars), http.StatusForbidden, nil)
+			decode(t, call(wr.handler, "PUT", wr.body, ownerID, adminPermissions, vars), http.StatusOK, nil)
+		})
+	}
+	body := `{"course_id": ` + strconv.Itoa(course.ID) + `, "name": "Timed", "time_limit_seconds": 600}`
+	decode(t, call(h.CreateTest, "POST", body, ownerID, teacherPermissions, nil), http.StatusForbidden, nil)
+	body = `{"course_id": ` + strconv.Itoa(course.ID) + `, "name": "Plain"}`
+	decode(t, call(h.CreateTest, "POST", body, ownerID, teacherPermissions, nil), http.StatusCreated, nil)
+}
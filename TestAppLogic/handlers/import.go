@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testapplogic/models"
+	"testapplogic/store"
+	"time"
+	"unicode/utf8"
+)
+
+// Форматы импорта вопросов
+const (
+	importGIFT      = "gift"
+	importMoodleXML = "moodle_xml"
+	importAiken     = "aiken"
+)
+
+// maxImportSize ограничивает размер импортируемого файла
+const maxImportSize = 10 << 20
+
+// importedQuestion — вопрос, разобранный из файла импорта.
+// Если задан skip, вопрос пропускается с этой причиной; если задан err — считается ошибочным
+type importedQuestion struct {
+	title    string
+	question models.Question
+	points   float64
+	skip     string
+	err      error
+}
+
+// importAnswer — вариант ответа с долей баллов в процентах, как в Moodle
+type importAnswer struct {
+	text   string
+	weight float64
+}
+
+// detectImportFormat определяет формат файла, если он не указан в запросе
+func detectImportFormat(data []byte) string {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\ufeff")))
+	if bytes.HasPrefix(trimmed, []byte("<?xml")) || bytes.HasPrefix(trimmed, []byte("<quiz")) {
+		return importMoodleXML
+	}
+	if aikenAnswerLine.Match(trimmed) && !bytes.Contains(trimmed, []byte("{")) {
+		return importAiken
+	}
+	return importGIFT
+}
+
+// parseImport разбирает файл в указанном формате
+func parseImport(format string, data []byte) ([]importedQuestion, error) {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	switch format {
+	case importGIFT:
+		return parseGIFT(text), nil
+	case importMoodleXML:
+		return parseMoodleXML(data)
+	case importAiken:
+		return parseAiken(text), nil
+	}
+	return nil, errors.New("format must be gift, moodle_xml or aiken")
+}
+
+var (
+	htmlTag        = regexp.MustCompile(`(?s)<[^>]*>`)
+	htmlBreak      = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>`)
+	htmlSpace      = regexp.MustCompile(`[ \t\r\f\v]+`)
+	htmlEmptyLines = regexp.MustCompile(`\n\s*\n+`)
+)
+
+// htmlText переводит HTML из Moodle в простой текст: теги убираются,
+// переносы строк и абзацы сохраняются, сущности раскодируются
+func htmlText(s string) string {
+	s = htmlBreak.ReplaceAllString(s, "\n")
+	s = htmlTag.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	s = htmlSpace.ReplaceAllString(s, " ")
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(htmlEmptyLines.ReplaceAllString(strings.Join(lines, "\n"), "\n"))
+}
+
+// importTitle возвращает название вопроса для отчёта: имя из файла или начало текста
+func importTitle(title, text string) string {
+	if title = strings.TrimSpace(title); title != "" {
+		return title
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) > 60 {
+		return string([]rune(text)[:60]) + "…"
+	}
+	return text
+}
+
+// categoryTag превращает путь категории Moodle ($course$/top/Алгебра/Матрицы) в тег —
+// название последней категории
+func categoryTag(path string) string {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		part := strings.TrimSpace(parts[i])
+		if part != "" && part != "top" && !strings.HasPrefix(part, "$") {
+			return part
+		}
+	}
+	return ""
+}
+
+// choiceQuestion строит вопрос с выбором ответа по вариантам с долями баллов.
+// Если single не задан, вопрос с единственным полностью верным вариантом
+// становится single, остальные — multiple
+func choiceQuestion(text string, answers []importAnswer, single *bool) (models.Question, error) {
+	q := models.Question{Text: text}
+	var positive []int
+	best := -1
+	for i, a := range answers {
+		q.Options = append(q.Options, a.text)
+		if a.weight > 0 {
+			positive = append(positive, i)
+		}
+		if best < 0 || a.weight > answers[best].weight {
+			best = i
+		}
+	}
+	if len(positive) == 0 {
+		return q, errors.New("no correct answer")
+	}
+	isSingle := len(positive) == 1 && answers[positive[0]].weight >= 100
+	if single != nil {
+		isSingle = *single
+	}
+	if isSingle {
+		q.Type = models.QuestionSingle
+		q.CorrectAnswer = mustJSON(best)
+	} else {
+		q.Type = models.QuestionMultiple
+		q.CorrectAnswer = mustJSON(positive)
+	}
+	return q, nil
+}
+
+// shortAnswerKey строит ключ текстового вопроса. Ответы Moodle с * превращаются
+// в регулярное выражение, где * означает любую последовательность символов
+func shortAnswerKey(accepted []string, caseSensitive bool) models.TextKey {
+	key := models.TextKey{CaseSensitive: caseSensitive}
+	var patterns []string
+	for _, a := range accepted {
+		if !strings.Contains(a, "*") {
+			key.Accepted = append(key.Accepted, a)
+			continue
+		}
+		parts := strings.Split(a, "*")
+		for i, p := range parts {
+			parts[i] = regexp.QuoteMeta(p)
+		}
+		patterns = append(patterns, strings.Join(parts, ".*"))
+	}
+	if len(patterns) > 0 {
+		key.Pattern = "^(?:" + strings.Join(patterns, "|") + ")$"
+	}
+	return key
+}
+
+// matchingQuestion строит вопрос на сопоставление из пар «вариант — ответ».
+// Пары с пустым вариантом — лишние ответы, которые только добавляются в список Matches
+func matchingQuestion(text string, pairs [][2]string) (models.Question, error) {
+	q := models.Question{Type: models.QuestionMatching, Text: text}
+	index := make(map[string]int)
+	var key []int
+	for _, p := range pairs {
+		m, ok := index[p[1]]
+		if !ok {
+			m = len(q.Matches)
+			index[p[1]] = m
+			q.Matches = append(q.Matches, p[1])
+		}
+		if p[0] != "" {
+			q.Options = append(q.Options, p[0])
+			key = append(key, m)
+		}
+	}
+	if len(q.Options) == 0 {
+		return q, errors.New("no matching pairs")
+	}
+	q.CorrectAnswer = mustJSON(key)
+	return q, nil
+}
+
+// ImportTestQuestions импортирует вопросы из GIFT, Moodle XML или Aiken в банк дисциплины
+// и добавляет их в конец теста. Тело запроса — содержимое файла; формат задаётся ?format=
+// или определяется по содержимому, ?tag= (можно несколько) добавляет теги всем вопросам.
+// Вопрос, который уже есть в банке, не дублируется: в тест добавляется существующий.
+// Все вопросы сохраняются в одной транзакции, ответ — отчёт по каждому вопросу файла
+func (h *DBHandler) ImportTestQuestions(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.testForComposition(w, r)
+	if !ok {
+		return
+	}
+	testID, courseID, kind := t.ID, t.CourseID, t.Kind
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		WriteError(w, r, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Import file is too large")
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = detectImportFormat(data)
+	}
+	items, err := parseImport(format, data)
+	if err != nil {
+		writeInvalid(w, r, err)
+		return
+	}
+	extraTags := r.URL.Query()["tag"]
+
+	tx, err := h.Store.Begin()
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction error")
+		return
+	}
+	defer tx.Rollback()
+	report := models.ImportReport{TestID: testID, Format: format, Items: []models.ImportItem{}}
+	for i, item := range items {
+		q := item.question
+		entry := models.ImportItem{Index: i + 1, Title: importTitle(item.title, q.Text), Type: q.Type}
+		switch {
+		case item.err != nil:
+			entry.Status, entry.Message = models.ImportFailed, item.err.Error()
+		case item.skip != "":
+			entry.Status, entry.Message = models.ImportSkipped, item.skip
+		case !validQuestionType(q.Type, kind):
+			entry.Status, entry.Message = models.ImportSkipped, q.Type+" questions are not supported in a "+kind
+		default:
+			q.CourseID, q.Kind = courseID, kind
+			q.Tags = normalizeTags(append(q.Tags, extraTags...))
+			// У вопросов опроса нет правильных ответов
+			if kind == models.TestKindSurvey {
+				q.CorrectAnswer = nil
+			}
+			if err := validateQuestion(&q, kind); err != nil {
+				entry.Status, entry.Message = models.ImportFailed, err.Error()
+				break
+			}
+			existing, err := tx.BankQuestionID(courseID, kind, q.Type, q.Text)
+			if err != nil && err != store.ErrNotFound {
+				WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+				return
+			}
+			points := item.points
+			if points <= 0 {
+				points = 1
+			}
+			if err == nil {
+				// Такой вопрос уже есть в банке: добавляем в тест его, а не копию
+				_, err := tx.LinkQuestion(testID, existing, 0, points)
+				if err == store.ErrQuestionLinked {
+					entry.Status, entry.QuestionID = models.ImportSkipped, existing
+					entry.Message = "question is already in the test"
+					break
+				} else if err != nil {
+					WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+					return
+				}
+				entry.Status, entry.QuestionID = models.ImportLinked, existing
+				entry.Message = "question from the course bank was added to the test"
+				break
+			}
+			q.CreatedAt = time.Now()
+			if err := tx.CreateQuestion(&q); err != nil {
+				WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+				return
+			}
+			if _, err := tx.LinkQuestion(testID, q.ID, 0, points); err != nil {
+				WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+				return
+			}
+			entry.Status, entry.QuestionID = models.ImportImported, q.ID
+		}
+		switch entry.Status {
+		case models.ImportImported:
+			report.Imported++
+		case models.ImportLinked:
+			report.Linked++
+		case models.ImportSkipped:
+			report.Skipped++
+		case models.ImportFailed:
+			report.Failed++
+		}
+		report.Items = append(report.Items, entry)
+	}
+	if err = tx.Commit(); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction commit failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+// wantImport — ожидаемый результат разбора одного вопроса файла импорта.
+// key сравнивается с CorrectAnswer после перевода в JSON
+type wantImport struct {
+	title   string
+	typ     string
+	text    string
+	options []string
+	matches []string
+	key     interface{}
+	tags    []string
+	points  float64
+	skip    bool
+	err     bool
+}
+
+// checkImported сравнивает разобранный вопрос с ожидаемым
+func checkImported(t *testing.T, got importedQuestion, want wantImport) {
+	t.Helper()
+	if (got.err != nil) != want.err {
+		t.Fatalf("err = %v, want error %v", got.err, want.err)
+	}
+	if (got.skip != "") != want.skip {
+		t.Fatalf("skip = %q, want skipped %v", got.skip, want.skip)
+	}
+	if want.err || want.skip {
+		return
+	}
+	q := got.question
+	if got.title != want.title || q.Type != want.typ || q.Text != want.text || got.points != want.points {
+		t.Fatalf("got title %q type %q text %q points %g, want %q %q %q %g",
+			got.title, q.Type, q.Text, got.points, want.title, want.typ, want.text, want.points)
+	}
+	if !reflect.DeepEqual(q.Options, want.options) || !reflect.DeepEqual(q.Matches, want.matches) {
+		t.Fatalf("got options %q matches %q, want %q %q", q.Options, q.Matches, want.options, want.matches)
+	}
+	if !reflect.DeepEqual(q.Tags, want.tags) {
+		t.Fatalf("got tags %q, want %q", q.Tags, want.tags)
+	}
+	if want.key == nil {
+		if len(q.CorrectAnswer) != 0 {
+			t.Fatalf("got key %s, want none", q.CorrectAnswer)
+		}
+		return
+	}
+	if got, want := string(compactJSON(q.CorrectAnswer)), string(mustJSON(want.key)); got != want {
+		t.Fatalf("got key %s, want %s", got, want)
+	}
+}
+
+func TestDetectImportFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"xml declaration", "<?xml version=\"1.0\"?><quiz></quiz>", importMoodleXML},
+		{"quiz root with BOM", "\ufeff  <quiz></quiz>", importMoodleXML},
+		{"aiken", "Q?\nA. yes\nB. no\nANSWER: A\n", importAiken},
+		{"gift with ANSWER: text", "ANSWER: is a word {=yes ~no}", importGIFT},
+		{"gift", "Q? {T}", importGIFT},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectImportFormat([]byte(tt.data)); got != tt.want {
+				t.Fatalf("detectImportFormat = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
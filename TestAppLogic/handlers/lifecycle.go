@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testapplogic/models"
+	"testapplogic/store"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// courseInput — редактируемые поля дисциплины
+type courseInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// UpdateCourse заменяет название и описание дисциплины (PUT: оба поля обязательны)
+func (h *DBHandler) UpdateCourse(w http.ResponseWriter, r *http.Request) {
+	h.updateCourse(w, r, false)
+}
+
+// PatchCourse меняет только переданные поля дисциплины
+func (h *DBHandler) PatchCourse(w http.ResponseWriter, r *http.Request) {
+	h.updateCourse(w, r, true)
+}
+
+// updateCourse обновляет дисциплину. При partial тело накладывается на текущие значения,
+// поэтому непереданные поля не меняются
+func (h *DBHandler) updateCourse(w http.ResponseWriter, r *http.Request, partial bool) {
+	courseID, ok := h.courseIDFromVars(w, r, "course:info:write")
+	if !ok {
+		return
+	}
+	var input courseInput
+	if partial {
+		c, err := h.Store.Course(courseID)
+		if err == store.ErrNotFound {
+			WriteError(w, r, http.StatusNotFound, CodeNotFound, "Course not found")
+			return
+		} else if err != nil {
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+			return
+		}
+		input.Name, input.Description = c.Name, c.Description
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	var invalid fieldErrors
+	if input.Name == "" {
+		invalid.add("name", "name is required")
+	}
+	if input.Description == "" {
+		invalid.add("description", "description is required")
+	}
+	if err := invalid.err(); err != nil {
+		writeInvalid(w, r, err)
+		return
+	}
+	c := models.Course{ID: courseID, Name: input.Name, Description: input.Description}
+	err := h.Store.UpdateCourse(&c)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Course not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+// DeleteCourse удаляет дисциплину мягко: она и её тесты скрываются, но участники,
+// вопросы, попытки и ответы остаются в базе до восстановления через RestoreCourse
+func (h *DBHandler) DeleteCourse(w http.ResponseWriter, r *http.Request) {
+	courseID, ok := h.courseIDFromVars(w, r, "course:del")
+	if !ok {
+		return
+	}
+	err := h.Store.DeleteCourse(courseID, time.Now())
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Course not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Course deleted",
+		"id":      courseID,
+	})
+}
+
+// RestoreCourse восстанавливает удалённую дисциплину вместе с тестами, удалёнными вместе с ней
+func (h *DBHandler) RestoreCourse(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	courseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid course ID")
+		return
+	}
+	userID, ok := GetUserID(r)
+	if !ok {
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "User not authenticated")
+		return
+	}
+	if !CheckPermission(r, "course:del") {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+		return
+	}
+	tx, err := h.Store.Begin()
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction error")
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.DeletedCourse(courseID); err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Deleted course not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	// CheckCourseAccess не пускает в удалённые дисциплины, поэтому преподаватель проверяется здесь
+	allowed, err := tx.IsCourseTeacher(userID, courseID)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if !allowed {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+		return
+	}
+	c, err := tx.RestoreCourse(courseID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Deleted course not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction commit failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+// testInput — редактируемые поля теста. Вид и анонимность задаются при создании:
+// от них зависят банк вопросов и уже собранные ответы, поэтому менять их нельзя
+type testInput struct {
+	Name             string     `json:"name"`
+	Kind             string     `json:"kind"`
+	Anonymous        *bool      `json:"anonymous"`
+	AllowReview      bool       `json:"allow_review"`
+	TimeLimit        *int       `json:"time_limit_seconds"`
+	OpensAt          *time.Time `json:"opens_at"`
+	ClosesAt         *time.Time `json:"closes_at"`
+	MaxAttempts      *int       `json:"max_attempts"`
+	Cooldown         *int       `json:"cooldown_seconds"`
+	GradingPolicy    string     `json:"grading_policy"`
+	ShuffleQuestions bool       `json:"shuffle_questions"`
+	ShuffleOptions   bool       `json:"shuffle_options"`
+}
+
+// UpdateTest заменяет настройки теста (PUT): непереданные ограничения снимаются,
+// флаги сбрасываются в false
+func (h *DBHandler) UpdateTest(w http.ResponseWriter, r *http.Request) {
+	h.updateTest(w, r, false)
+}
+
+// PatchTest меняет только переданные настройки теста; null снимает ограничение
+func (h *DBHandler) PatchTest(w http.ResponseWriter, r *http.Request) {
+	h.updateTest(w, r, true)
+}
+
+// testForLifecycle загружает неудалённый тест и проверяет разрешение permission у преподавателя
+// его дисциплины. С course:test:write через неё проходят все изменения настроек теста:
+// PUT/PATCH /tests/{id}, расписание, правила попыток, перемешивание с пулами и разбор
+func (h *DBHandler) testForLifecycle(w http.ResponseWriter, r *http.Request, permission string) (models.Test, bool) {
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid test ID")
+		return models.Test{}, false
+	}
+	t, err := h.Store.Test(testID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Test not found")
+		return t, false
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return t, false
+	}
+	if !CheckPermission(r, permission) || !CheckTeacherAccess(h.Store, r, t.CourseID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+		return t, false
+	}
+	return t, true
+}
+
+// hasTestSettings проверяет, отличаются ли настройки теста от значений по умолчанию.
+// Создать тест с такими настройками, в том числе импортом, можно только с course:test:write,
+// которое нужно и для их изменения
+func hasTestSettings(t models.Test) bool {
+	return t.AllowReview || t.TimeLimit != nil || t.OpensAt != nil || t.ClosesAt != nil ||
+		t.MaxAttempts != nil || t.Cooldown != nil ||
+		(t.GradingPolicy != "" && t.GradingPolicy != models.GradingBest) ||
+		t.ShuffleQuestions || t.ShuffleOptions
+}
+
+// updateTest обновляет настройки теста. При partial тело накладывается на текущие значения
+func (h *DBHandler) updateTest(w http.ResponseWriter, r *http.Request, partial bool) {
+	t, ok := h.testForLifecycle(w, r, "course:test:write")
+	if !ok {
+		return
+	}
+	var input testInput
+	if partial {
+		input = testInput{
+			Name:             t.Name,
+			AllowReview:      t.AllowReview,
+			TimeLimit:        t.TimeLimit,
+			OpensAt:          t.OpensAt,
+			ClosesAt:         t.ClosesAt,
+			MaxAttempts:      t.MaxAttempts,
+			Cooldown:         t.Cooldown,
+			GradingPolicy:    t.GradingPolicy,
+			ShuffleQuestions: t.ShuffleQuestions,
+			ShuffleOptions:   t.ShuffleOptions,
+		}
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if input.Kind != "" && input.Kind != t.Kind {
+		writeInvalid(w, r, invalidField("kind", "kind cannot be changed"))
+		return
+	}
+	if input.Anonymous != nil && *input.Anonymous != t.Anonymous {
+		writeInvalid(w, r, invalidField("anonymous", "anonymous cannot be changed"))
+		return
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		writeInvalid(w, r, invalidField("name", "name is required"))
+		return
+	}
+	if err := validateSchedule(input.TimeLimit, input.OpensAt, input.ClosesAt); err != nil {
+		writeInvalid(w, r, err)
+		return
+	}
+	if input.GradingPolicy == "" {
+		input.GradingPolicy = models.GradingBest
+	}
+	if err := validatePolicy(input.MaxAttempts, input.Cooldown, input.GradingPolicy); err != nil {
+		writeInvalid(w, r, err)
+		return
+	}
+	updated := models.Test{
+		ID:               t.ID,
+		Name:             input.Name,
+		AllowReview:      input.AllowReview,
+		TimeLimit:        input.TimeLimit,
+		OpensAt:          input.OpensAt,
+		ClosesAt:         input.ClosesAt,
+		MaxAttempts:      input.MaxAttempts,
+		Cooldown:         input.Cooldown,
+		GradingPolicy:    input.GradingPolicy,
+		ShuffleQuestions: input.ShuffleQuestions,
+		ShuffleOptions:   input.ShuffleOptions,
+	}
+	err := h.Store.UpdateTest(&updated)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Test not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	updated.Questions, _ = h.Store.TestQuestionIDs(updated.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeleteTest удаляет тест мягко: он пропадает из списков и перестаёт открываться,
+// а попытки и ответы сохраняются до восстановления через RestoreTest
+func (h *DBHandler) DeleteTest(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.testForLifecycle(w, r, "course:test:del")
+	if !ok {
+		return
+	}
+	err := h.Store.DeleteTest(t.ID, time.Now())
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Test not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Test deleted",
+		"id":      t.ID,
+	})
+}
+
+// RestoreTest восстанавливает удалённый тест. Тест удалённой дисциплины восстанавливается
+// вместе с ней через RestoreCourse
+func (h *DBHandler) RestoreTest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid test ID")
+		return
+	}
+	deleted, err := h.Store.TestWithDeleted(testID)
+	if err == nil && deleted.DeletedAt == nil {
+		err = store.ErrNotFound
+	}
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Deleted test not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if _, err := h.Store.Course(deleted.CourseID); err == store.ErrNotFound {
+		WriteError(w, r, http.StatusConflict, CodeCourseDeleted, "Course is deleted; restore the course first")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if !CheckPermission(r, "course:test:del") || !CheckTeacherAccess(h.Store, r, deleted.CourseID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+		return
+	}
+	t, err := h.Store.RestoreTest(testID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Deleted test not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	t.Questions, _ = h.Store.TestQuestionIDs(t.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testapplogic/models"
+	"testapplogic/store"
+	"time"
+)
+
+// listOptions разбирает общие параметры списков:
+//
+//	q            — подстрока для поиска
+//	created_from — дата создания не раньше (RFC 3339 или YYYY-MM-DD)
+//	created_to   — дата создания раньше; дата без времени включает весь день
+//	sort         — ключ из sorts, с префиксом "-" по убыванию; по умолчанию defaultSort
+//	limit        — размер страницы, не больше store.MaxLimit
+//	cursor       — курсор из X-Next-Cursor предыдущей страницы
+//
+// Ошибки добавляются в errs, чтобы вызывающий мог дописать ошибки своих фильтров
+func listOptions(r *http.Request, sorts []string, defaultSort string, errs *fieldErrors) store.ListOptions {
+	query := r.URL.Query()
+	opts := store.ListOptions{Query: strings.TrimSpace(query.Get("q")), Limit: store.DefaultLimit}
+	sortKey := query.Get("sort")
+	if sortKey == "" {
+		sortKey = defaultSort
+	}
+	opts.Desc = strings.HasPrefix(sortKey, "-")
+	opts.Sort = strings.TrimPrefix(sortKey, "-")
+	known := false
+	for _, s := range sorts {
+		known = known || s == opts.Sort
+	}
+	if !known {
+		errs.add("sort", "sort must be one of "+strings.Join(sorts, ", ")+", optionally prefixed with -")
+	}
+	if s := query.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 || limit > store.MaxLimit {
+			errs.add("limit", fmt.Sprintf("limit must be between 1 and %d", store.MaxLimit))
+		}
+		opts.Limit = limit
+	}
+	if s := query.Get("cursor"); s != "" {
+		after, err := store.ParseCursor(s)
+		if err != nil || after.Sort != opts.Sort || after.Desc != opts.Desc {
+			errs.add("cursor", "cursor is invalid or was issued for another sort order")
+		}
+		opts.After = after
+	}
+	var err error
+	if opts.CreatedFrom, err = parseListTime(query.Get("created_from"), false); err != nil {
+		errs.add("created_from", "created_from must be a date (YYYY-MM-DD) or RFC 3339 time")
+	}
+	if opts.CreatedTo, err = parseListTime(query.Get("created_to"), true); err != nil {
+		errs.add("created_to", "created_to must be a date (YYYY-MM-DD) or RFC 3339 time")
+	}
+	return opts
+}
+
+// parseListTime разбирает границу диапазона дат. Для верхней границы дата без времени
+// означает начало следующего дня, чтобы сам день попал в выборку
+func parseListTime(s string, upper bool) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return nil, err
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// parseIDParam разбирает необязательный числовой параметр запроса; 0 — параметр не задан
+func parseIDParam(r *http.Request, name string, errs *fieldErrors) int {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return 0
+	}
+	id, err := strconv.Atoi(s)
+	if err != nil || id <= 0 {
+		errs.add(name, name+" must be a positive integer")
+	}
+	return id
+}
+
+// parseBoolParam разбирает необязательный логический параметр запроса; nil — параметр не задан
+func parseBoolParam(r *http.Request, name string, errs *fieldErrors) *bool {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		errs.add(name, name+" must be true or false")
+	}
+	return &v
+}
+
+// writePage отправляет страницу списка. Тело остаётся JSON-массивом, а курсор следующей
+// страницы передаётся в X-Next-Cursor и в Link с rel="next"; на последней странице их нет
+func writePage(w http.ResponseWriter, r *http.Request, items interface{}, next *store.Cursor) {
+	if next != nil {
+		cursor := next.String()
+		query := r.URL.Query()
+		query.Set("cursor", cursor)
+		link := *r.URL
+		link.RawQuery = query.Encode()
+		w.Header().Set("X-Next-Cursor", cursor)
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", link.RequestURI()))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// allCourseTests загружает все тесты дисциплины по фильтру, проходя страницы
+// по created_at; Sort, Desc, Limit и After фильтра не учитываются
+func allCourseTests(s store.Store, f store.TestFilter) ([]models.Test, error) {
+	f.ListOptions = store.ListOptions{Query: f.Query, CreatedFrom: f.CreatedFrom, CreatedTo: f.CreatedTo,
+		Sort: "created_at", Limit: store.MaxLimit}
+	var tests []models.Test
+	for {
+		page, next, err := s.CourseTests(f)
+		if err != nil {
+			return nil, err
+		}
+		tests = append(tests, page...)
+		if next == nil {
+			return tests, nil
+		}
+		f.After = next
+	}
+}
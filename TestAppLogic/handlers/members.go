@@ -0,0 +1,486 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testapplogic/models"
+	"testapplogic/store"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	errInviteInvalid = errors.New("invite code is invalid or expired")
+	errAlreadyMember = errors.New("user is already a member of this course")
+)
+
+// inviteAlphabet содержит символы кода приглашения без легко путаемых 0/O и 1/I
+const inviteAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// enrollUser записывает пользователя на дисциплину и уведомляет его;
+// возвращает false, если он уже записан
+func enrollUser(s store.Store, userID, courseID int, role string) (bool, error) {
+	added, err := s.EnrollUser(userID, courseID, role)
+	if err != nil || !added {
+		return false, err
+	}
+	c, err := s.Course(courseID)
+	if err != nil {
+		return false, err
+	}
+	message := fmt.Sprintf("Вы записаны на курс «%s»", c.Name)
+	return true, s.Notify(userID, NotificationCourseJoined, message)
+}
+
+// validMemberRole проверяет роль участника дисциплины
+func validMemberRole(role string) bool {
+	return role == "student" || role == "teacher"
+}
+
+// canGrantRole проверяет, может ли пользователь записать участника с ролью role.
+// Студентов записывает любой, у кого есть course:user:add, а роль teacher даёт
+// авторский доступ к дисциплине, поэтому её назначают только владелец дисциплины
+// и администратор; они же исключают преподавателей. CheckAdminAccess здесь не подходит:
+// quest:create есть у каждого преподавателя, поэтому администратор определяется по user:list:read
+func (h *DBHandler) canGrantRole(r *http.Request, courseID int, role string) (bool, error) {
+	if role == "student" || CheckPermission(r, "user:list:read") {
+		return true, nil
+	}
+	userID, ok := GetUserID(r)
+	if !ok {
+		return false, nil
+	}
+	c, err := h.Store.Course(courseID)
+	if err != nil {
+		return false, err
+	}
+	return c.TeacherID == userID, nil
+}
+
+// generateInviteCode генерирует случайный код приглашения
+func generateInviteCode() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = inviteAlphabet[int(b)%len(inviteAlphabet)]
+	}
+	return string(buf), nil
+}
+
+// courseIDFromVars извлекает ID дисциплины из пути и проверяет разрешение permission
+// у преподавателя дисциплины: записанному на неё студенту управление недоступно
+func (h *DBHandler) courseIDFromVars(w http.ResponseWriter, r *http.Request, permission string) (int, bool) {
+	vars := mux.Vars(r)
+	courseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid course ID")
+		return 0, false
+	}
+	if !CheckPermission(r, permission) || !CheckTeacherAccess(h.Store, r, courseID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+		return 0, false
+	}
+	return courseID, true
+}
+
+// GetCourseMembers возвращает участников дисциплины, с фильтром по роли (?role=student|teacher)
+func (h *DBHandler) GetCourseMembers(w http.ResponseWriter, r *http.Request) {
+	courseID, ok := h.courseIDFromVars(w, r, "course:userList")
+	if !ok {
+		return
+	}
+	role := r.URL.Query().Get("role")
+	if role != "" && !validMemberRole(role) {
+		writeInvalid(w, r, invalidField("role", "Invalid role"))
+		return
+	}
+	members, err := h.Store.CourseMembers(courseID, role)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if members == nil {
+		members = []models.CourseMember{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// AddCourseMember записывает пользователя на дисциплину.
+// Пользователь задаётся через user_id или user_ref; роль по умолчанию — student
+func (h *DBHandler) AddCourseMember(w http.ResponseWriter, r *http.Request) {
+	courseID, ok := h.courseIDFromVars(w, r, "course:user:add")
+	if !ok {
+		return
+	}
+	var input struct {
+		UserID  int    `json:"user_id"`
+		UserRef string `json:"user_ref"`
+		Role    string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if input.Role == "" {
+		input.Role = "student"
+	}
+	if !validMemberRole(input.Role) {
+		writeInvalid(w, r, invalidField("role", "Invalid role"))
+		return
+	}
+	if allowed, err := h.canGrantRole(r, courseID, input.Role); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	} else if !allowed {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Only the course owner or an administrator can add teachers")
+		return
+	}
+	tx, err := h.Store.Begin()
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction error")
+		return
+	}
+	defer tx.Rollback()
+	userID := input.UserID
+	if userID > 0 {
+		exists, err := tx.UserExists(userID)
+		if err != nil {
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+			return
+		}
+		if !exists {
+			writeInvalid(w, r, invalidField("user_id", "User not found"))
+			return
+		}
+	} else {
+		ref := strings.TrimSpace(input.UserRef)
+		if ref == "" {
+			writeInvalid(w, r, invalidField("user_id", "user_id or user_ref is required"))
+			return
+		}
+		// Пользователь, ещё ни разу не входивший в систему, создаётся с именем, равным ref
+		if userID, err = tx.EnsureUser(ref, ref); err != nil {
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+			return
+		}
+	}
+	// Запись и уведомление сохраняются вместе: без уведомления участник не добавляется
+	added, err := enrollUser(tx, userID, courseID, input.Role)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if !added {
+		WriteError(w, r, http.StatusConflict, CodeAlreadyMember, "User is already a member of this course")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction commit failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":   "Member added",
+		"user_id":   userID,
+		"course_id": courseID,
+		"role":      input.Role,
+	})
+}
+
+// BulkAddCourseMembers записывает на дисциплину список пользователей по user_ref
+// и возвращает статус по каждому из них
+func (h *DBHandler) BulkAddCourseMembers(w http.ResponseWriter, r *http.Request) {
+	courseID, ok := h.courseIDFromVars(w, r, "course:user:add")
+	if !ok {
+		return
+	}
+	var input struct {
+		UserRefs []string `json:"user_refs"`
+		Role     string   `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if len(input.UserRefs) == 0 {
+		writeInvalid(w, r, invalidField("user_refs", "user_refs are required"))
+		return
+	}
+	if input.Role == "" {
+		input.Role = "student"
+	}
+	if !validMemberRole(input.Role) {
+		writeInvalid(w, r, invalidField("role", "Invalid role"))
+		return
+	}
+	if allowed, err := h.canGrantRole(r, courseID, input.Role); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	} else if !allowed {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Only the course owner or an administrator can add teachers")
+		return
+	}
+	tx, err := h.Store.Begin()
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction error")
+		return
+	}
+	defer tx.Rollback()
+	type itemResult struct {
+		UserRef string `json:"user_ref"`
+		UserID  int    `json:"user_id,omitempty"`
+		Status  string `json:"status"`
+	}
+	results := make([]itemResult, 0, len(input.UserRefs))
+	added := 0
+	for _, ref := range input.UserRefs {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			results = append(results, itemResult{UserRef: ref, Status: "skipped"})
+			continue
+		}
+		userID, err := tx.EnsureUser(ref, ref)
+		if err != nil {
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+			return
+		}
+		ok, err := enrollUser(tx, userID, courseID, input.Role)
+		if err != nil {
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+			return
+		}
+		status := "already_member"
+		if ok {
+			status = "added"
+			added++
+		}
+		results = append(results, itemResult{UserRef: ref, UserID: userID, Status: status})
+	}
+	if err = tx.Commit(); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction commit failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"course_id": courseID,
+		"added":     added,
+		"results":   results,
+	})
+}
+
+// RemoveCourseMember исключает пользователя из дисциплины
+func (h *DBHandler) RemoveCourseMember(w http.ResponseWriter, r *http.Request) {
+	courseID, ok := h.courseIDFromVars(w, r, "course:user:del")
+	if !ok {
+		return
+	}
+	userID, err := strconv.Atoi(mux.Vars(r)["user_id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid user ID")
+		return
+	}
+	// Владельца дисциплины исключить нельзя
+	c, err := h.Store.Course(courseID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Course not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if c.TeacherID == userID {
+		WriteError(w, r, http.StatusBadRequest, CodeCourseOwner, "Course owner cannot be removed")
+		return
+	}
+	// Преподавателя исключает тот же круг лиц, что может его назначить
+	teacher, err := h.Store.IsCourseTeacher(userID, courseID)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if teacher {
+		if allowed, err := h.canGrantRole(r, courseID, "teacher"); err != nil {
+			WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+			return
+		} else if !allowed {
+			WriteError(w, r, http.StatusForbidden, CodeForbidden, "Only the course owner or an administrator can remove teachers")
+			return
+		}
+	}
+	err = h.Store.RemoveCourseMember(userID, courseID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Member not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Member removed"})
+}
+
+// CreateCourseInvite создаёт код приглашения на дисциплину
+func (h *DBHandler) CreateCourseInvite(w http.ResponseWriter, r *http.Request) {
+	courseID, ok := h.courseIDFromVars(w, r, "course:user:add")
+	if !ok {
+		return
+	}
+	var input struct {
+		MaxUses   *int       `json:"max_uses"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	// Тело запроса необязательно
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			WriteError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
+			return
+		}
+	}
+	if input.MaxUses != nil && *input.MaxUses <= 0 {
+		writeInvalid(w, r, invalidField("max_uses", "max_uses must be positive"))
+		return
+	}
+	if input.ExpiresAt != nil && input.ExpiresAt.Before(time.Now()) {
+		writeInvalid(w, r, invalidField("expires_at", "expires_at must be in the future"))
+		return
+	}
+	userID, _ := GetUserID(r)
+	code, err := generateInviteCode()
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to generate invite code")
+		return
+	}
+	invite := models.CourseInvite{
+		Code:      code,
+		CourseID:  courseID,
+		CreatedBy: userID,
+		MaxUses:   input.MaxUses,
+		ExpiresAt: input.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	if err := h.Store.CreateInvite(&invite); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invite)
+}
+
+// GetCourseInvites возвращает коды приглашения дисциплины
+func (h *DBHandler) GetCourseInvites(w http.ResponseWriter, r *http.Request) {
+	courseID, ok := h.courseIDFromVars(w, r, "course:user:add")
+	if !ok {
+		return
+	}
+	invites, err := h.Store.CourseInvites(courseID)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if invites == nil {
+		invites = []models.CourseInvite{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invites)
+}
+
+// DeleteCourseInvite отзывает код приглашения
+func (h *DBHandler) DeleteCourseInvite(w http.ResponseWriter, r *http.Request) {
+	courseID, ok := h.courseIDFromVars(w, r, "course:user:add")
+	if !ok {
+		return
+	}
+	code := strings.ToUpper(mux.Vars(r)["code"])
+	err := h.Store.DeleteInvite(courseID, code)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Invite not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Invite revoked"})
+}
+
+// joinCourse записывает пользователя студентом по коду приглашения и возвращает ID дисциплины
+func joinCourse(s store.Store, userID int, code string) (int, error) {
+	tx, err := s.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	code = strings.ToUpper(strings.TrimSpace(code))
+	inv, err := tx.LockInvite(code)
+	if err == store.ErrNotFound {
+		return 0, errInviteInvalid
+	} else if err != nil {
+		return 0, err
+	}
+	if inv.ExpiresAt != nil && inv.ExpiresAt.Before(time.Now()) {
+		return 0, errInviteInvalid
+	}
+	if inv.MaxUses != nil && inv.Uses >= *inv.MaxUses {
+		return 0, errInviteInvalid
+	}
+	added, err := enrollUser(tx, userID, inv.CourseID, "student")
+	if err != nil {
+		return 0, err
+	}
+	if !added {
+		return inv.CourseID, errAlreadyMember
+	}
+	if err = tx.UseInvite(code); err != nil {
+		return 0, err
+	}
+	return inv.CourseID, tx.Commit()
+}
+
+// JoinCourse записывает текущего пользователя на дисциплину по коду приглашения
+func (h *DBHandler) JoinCourse(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if strings.TrimSpace(input.Code) == "" {
+		writeInvalid(w, r, invalidField("code", "code is required"))
+		return
+	}
+	userID, ok := GetUserID(r)
+	if !ok {
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "User not authenticated")
+		return
+	}
+	courseID, err := joinCourse(h.Store, userID, input.Code)
+	switch err {
+	case nil:
+	case errInviteInvalid:
+		WriteError(w, r, http.StatusBadRequest, CodeInviteInvalid, "Invite code is invalid or expired")
+		return
+	case errAlreadyMember:
+		WriteError(w, r, http.StatusConflict, CodeAlreadyMember, "You are already a member of this course")
+		return
+	default:
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":   "Joined course",
+		"course_id": courseID,
+	})
+}
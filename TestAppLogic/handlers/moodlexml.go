@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strconv"
+	"strings"
+	"testapplogic/models"
+)
+
+// moodleQuiz — корневой элемент Moodle XML
+type moodleQuiz struct {
+	Questions []moodleQuestion `xml:"question"`
+}
+
+// moodleText — элемент с текстом и форматом: <questiontext format="html"><text>...</text></questiontext>
+type moodleText struct {
+	Format string `xml:"format,attr"`
+	Text   string `xml:"text"`
+}
+
+// moodleQuestion — вопрос Moodle XML. Используются только поля поддерживаемых типов
+type moodleQuestion struct {
+	Type         string              `xml:"type,attr"`
+	Name         moodleText          `xml:"name"`
+	QuestionText moodleText          `xml:"questiontext"`
+	Category     moodleText          `xml:"category"`
+	DefaultGrade string              `xml:"defaultgrade"`
+	Single       string              `xml:"single"`
+	UseCase      string              `xml:"usecase"`
+	Answers      []moodleAnswer      `xml:"answer"`
+	Subquestions []moodleSubquestion `xml:"subquestion"`
+	Tags         []string            `xml:"tags>tag>text"`
+}
+
+// moodleAnswer — вариант ответа с долей баллов в процентах
+type moodleAnswer struct {
+	Fraction  string `xml:"fraction,attr"`
+	Format    string `xml:"format,attr"`
+	Text      string `xml:"text"`
+	Tolerance string `xml:"tolerance"`
+}
+
+// moodleSubquestion — пара вопроса на сопоставление
+type moodleSubquestion struct {
+	Format string `xml:"format,attr"`
+	Text   string `xml:"text"`
+	Answer string `xml:"answer>text"`
+}
+
+// plain возвращает текст элемента без HTML-разметки
+func (t moodleText) plain(defaultFormat string) string {
+	format := t.Format
+	if format == "" {
+		format = defaultFormat
+	}
+	if format == "html" {
+		return htmlText(t.Text)
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+// fraction возвращает долю баллов ответа
+func (a moodleAnswer) fraction() float64 {
+	f, _ := strconv.ParseFloat(strings.TrimSpace(a.Fraction), 64)
+	return f
+}
+
+// text возвращает текст ответа без HTML-разметки
+func (a moodleAnswer) text() string {
+	return moodleText{Format: a.Format, Text: a.Text}.plain("plain_text")
+}
+
+// parseMoodleXML разбирает экспорт банка вопросов Moodle. Категории становятся тегами
+// следующих за ними вопросов, вес вопроса берётся из defaultgrade
+func parseMoodleXML(data []byte) ([]importedQuestion, error) {
+	var quiz moodleQuiz
+	if err := xml.NewDecoder(bytes.NewReader(data)).Decode(&quiz); err != nil {
+		return nil, errors.New("invalid Moodle XML: " + err.Error())
+	}
+	var items []importedQuestion
+	category := ""
+	for _, mq := range quiz.Questions {
+		if mq.Type == "category" {
+			category = categoryTag(mq.Category.Text)
+			continue
+		}
+		item := importedQuestion{title: mq.Name.plain("plain_text")}
+		item.points, _ = strconv.ParseFloat(strings.TrimSpace(mq.DefaultGrade), 64)
+		q, err := moodleQuestionOf(mq)
+		if err == errUnsupportedMoodleType {
+			item.skip = "Moodle question type " + mq.Type + " is not supported"
+		} else {
+			item.err = err
+		}
+		q.Text = mq.QuestionText.plain("html")
+		q.Tags = append(q.Tags, mq.Tags...)
+		if category != "" {
+			q.Tags = append(q.Tags, category)
+		}
+		item.question = q
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// errUnsupportedMoodleType возвращается для типов вопросов Moodle, которых нет в системе
+var errUnsupportedMoodleType = errors.New("unsupported question type")
+
+// moodleQuestionOf переводит вопрос Moodle в вопрос системы без текста и тегов
+func moodleQuestionOf(mq moodleQuestion) (models.Question, error) {
+	switch mq.Type {
+	case "multichoice":
+		answers := make([]importAnswer, len(mq.Answers))
+		for i, a := range mq.Answers {
+			answers[i] = importAnswer{text: a.text(), weight: a.fraction()}
+		}
+		single := strings.TrimSpace(mq.Single) != "false" && strings.TrimSpace(mq.Single) != "0"
+		return choiceQuestion("", answers, &single)
+	case "truefalse":
+		for _, a := range mq.Answers {
+			if a.fraction() >= 100 {
+				value := strings.EqualFold(a.text(), "true")
+				return models.Question{Type: models.QuestionTrueFalse, CorrectAnswer: mustJSON(value)}, nil
+			}
+		}
+		return models.Question{Type: models.QuestionTrueFalse}, errors.New("no correct answer")
+	case "shortanswer":
+		var accepted []string
+		for _, a := range mq.Answers {
+			if a.fraction() >= 100 {
+				accepted = append(accepted, a.text())
+			}
+		}
+		caseSensitive := strings.TrimSpace(mq.UseCase) == "1"
+		return models.Question{Type: models.QuestionText, CorrectAnswer: mustJSON(shortAnswerKey(accepted, caseSensitive))}, nil
+	case "numerical":
+		for _, a := range mq.Answers {
+			if a.fraction() < 100 {
+				continue
+			}
+			var key models.NumericKey
+			var err error
+			if key.Value, err = strconv.ParseFloat(a.text(), 64); err != nil {
+				return models.Question{Type: models.QuestionNumeric}, errors.New("invalid numeric answer")
+			}
+			if t := strings.TrimSpace(a.Tolerance); t != "" {
+				if key.Tolerance, err = strconv.ParseFloat(t, 64); err != nil {
+					return models.Question{Type: models.QuestionNumeric}, errors.New("invalid tolerance")
+				}
+			}
+			return models.Question{Type: models.QuestionNumeric, CorrectAnswer: mustJSON(key)}, nil
+		}
+		return models.Question{Type: models.QuestionNumeric}, errors.New("no correct answer")
+	case "matching":
+		var pairs [][2]string
+		for _, s := range mq.Subquestions {
+			pairs = append(pairs, [2]string{moodleText{Format: s.Format, Text: s.Text}.plain("html"), strings.TrimSpace(s.Answer)})
+		}
+		return matchingQuestion("", pairs)
+	case "ordering":
+		// Плагин ordering перечисляет элементы в правильном порядке
+		q := models.Question{Type: models.QuestionOrdering}
+		key := make([]int, len(mq.Answers))
+		for i, a := range mq.Answers {
+			q.Options = append(q.Options, a.text())
+			key[i] = i
+		}
+		q.CorrectAnswer = mustJSON(key)
+		return q, nil
+	case "essay":
+		return models.Question{Type: models.QuestionFreeText}, nil
+	}
+	return models.Question{Type: mq.Type}, errUnsupportedMoodleType
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"testapplogic/models"
+	"testing"
+)
+
+// moodleQuizXML оборачивает вопросы в корневой элемент Moodle XML
+func moodleQuizXML(questions string) []byte {
+	return []byte(`<?xml version="1.0" encoding="UTF-8"?><quiz>` + questions + `</quiz>`)
+}
+
+func TestParseMoodleXML(t *testing.T) {
+	tests := []struct {
+		name     string
+		question string
+		want     wantImport
+	}{
+		{"multichoice single", `<question type="multichoice">
+			<name><text>Столица</text></name>
+			<questiontext format="html"><text><![CDATA[<p>Столица <b>Франции</b>?</p>]]></text></questiontext>
+			<defaultgrade>2</defaultgrade>
+			<single>true</single>
+			<answer fraction="100" format="html"><text><![CDATA[<p>Париж</p>]]></text></answer>
+			<answer fraction="0"><text>Лион</text></answer>
+		</question>`, wantImport{
+			title: "Столица", typ: models.QuestionSingle, text: "Столица Франции?",
+			options: []string{"Париж", "Лион"}, key: 0, points: 2,
+		}},
+		{"multichoice multiple", `<question type="multichoice">
+			<questiontext format="plain_text"><text>Простые</text></questiontext>
+			<single>false</single>
+			<answer fraction="50"><text>2</text></answer>
+			<answer fraction="50"><text>3</text></answer>
+			<answer fraction="-100"><text>4</text></answer>
+		</question>`, wantImport{
+			typ: models.QuestionMultiple, text: "Простые", options: []string{"2", "3", "4"}, key: []int{0, 1},
+		}},
+		{"truefalse", `<question type="truefalse">
+			<questiontext><text>Земля круглая</text></questiontext>
+			<answer fraction="100"><text>true</text></answer>
+			<answer fraction="0"><text>false</text></answer>
+		</question>`, wantImport{typ: models.QuestionTrueFalse, text: "Земля круглая", key: true}},
+		{"shortanswer with wildcard", `<question type="shortanswer">
+			<questiontext><text>Столица России</text></questiontext>
+			<usecase>1</usecase>
+			<answer fraction="100"><text>Москва</text></answer>
+			<answer fraction="100"><text>Моск*</text></answer>
+			<answer fraction="50"><text>Питер</text></answer>
+		</question>`, wantImport{
+			typ: models.QuestionText, text: "Столица России",
+			key: models.TextKey{Accepted: []string{"Москва"}, Pattern: "^(?:Моск.*)$", CaseSensitive: true},
+		}},
+		{"numerical", `<question type="numerical">
+			<questiontext><text>Число пи</text></questiontext>
+			<answer fraction="100"><text>3.14</text><tolerance>0.01</tolerance></answer>
+		</question>`, wantImport{typ: models.QuestionNumeric, text: "Число пи", key: models.NumericKey{Value: 3.14, Tolerance: 0.01}}},
+		{"matching with extra answer", `<question type="matching">
+			<questiontext><text>Сопоставьте</text></questiontext>
+			<subquestion><text>кот</text><answer><text>мяу</text></answer></subquestion>
+			<subquestion><text>пёс</text><answer><text>гав</text></answer></subquestion>
+			<subquestion><text></text><answer><text>муу</text></answer></subquestion>
+		</question>`, wantImport{
+			typ: models.QuestionMatching, text: "Сопоставьте",
+			options: []string{"кот", "пёс"}, matches: []string{"мяу", "гав", "муу"}, key: []int{0, 1},
+		}},
+		{"ordering", `<question type="ordering">
+			<questiontext><text>По возрастанию</text></questiontext>
+			<answer><text>1</text></answer>
+			<answer><text>2</text></answer>
+			<answer><text>3</text></answer>
+		</question>`, wantImport{
+			typ: models.QuestionOrdering, text: "По возрастанию", options: []string{"1", "2", "3"}, key: []int{0, 1, 2},
+		}},
+		{"essay with tags", `<question type="essay">
+			<questiontext><text>Эссе</text></questiontext>
+			<tags><tag><text>письмо</text></tag></tags>
+		</question>`, wantImport{typ: models.QuestionFreeText, text: "Эссе", tags: []string{"письмо"}}},
+		{"unsupported type", `<question type="calculated"><questiontext><text>x</text></questiontext></question>`, wantImport{skip: true}},
+		{"no correct truefalse", `<question type="truefalse">
+			<questiontext><text>?</text></questiontext>
+			<answer fraction="0"><text>true</text></answer>
+		</question>`, wantImport{err: true}},
+		{"bad numeric", `<question type="numerical">
+			<questiontext><text>?</text></questiontext>
+			<answer fraction="100"><text>abc</text></answer>
+		</question>`, wantImport{err: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := parseMoodleXML(moodleQuizXML(tt.question))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != 1 {
+				t.Fatalf("got %d questions, want 1", len(items))
+			}
+			checkImported(t, items[0], tt.want)
+		})
+	}
+}
+
+func TestParseMoodleXMLCategories(t *testing.T) {
+	items, err := parseMoodleXML(moodleQuizXML(`
+		<question type="category"><category><text>$course$/top/Алгебра/Матрицы</text></category></question>
+		<question type="essay"><questiontext><text>Первый</text></questiontext></question>
+		<question type="category"><category><text>$course$/top</text></category></question>
+		<question type="essay"><questiontext><text>Второй</text></questiontext></question>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("got %d questions, want 2", len(items))
+	}
+	checkImported(t, items[0], wantImport{typ: models.QuestionFreeText, text: "Первый", tags: []string{"Матрицы"}})
+	checkImported(t, items[1], wantImport{typ: models.QuestionFreeText, text: "Второй"})
+	if _, err := parseMoodleXML([]byte("<quiz><question>")); err == nil {
+		t.Fatal("malformed XML is accepted")
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testapplogic/models"
+	"testapplogic/store"
+
+	"github.com/gorilla/mux"
+)
+
+// Типы уведомлений
+const (
+	NotificationTestActivated = "test_activated"
+	NotificationAttemptGraded = "attempt_graded"
+	NotificationCourseJoined  = "course_joined"
+)
+
+// notificationsLimit ограничивает число уведомлений, отдаваемых за один запрос
+const notificationsLimit = 50
+
+// GetNotifications возвращает непрочитанные уведомления пользователя
+// и отмечает их как доставленные, чтобы /notifications/clear не задел пришедшие позже
+func (h *DBHandler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserID(r)
+	if !ok {
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "User not authenticated")
+		return
+	}
+	notifications, err := h.Store.DeliverNotifications(userID, notificationsLimit)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if notifications == nil {
+		notifications = []models.Notification{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notifications)
+}
+
+// ClearNotifications отмечает уведомления прочитанными.
+// Без тела запроса — все уже доставленные через GET /notifications,
+// с телом {"ids": [...]} — только перечисленные
+func (h *DBHandler) ClearNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserID(r)
+	if !ok {
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "User not authenticated")
+		return
+	}
+	var input struct {
+		IDs []int `json:"ids"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			WriteError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
+			return
+		}
+	}
+	cleared, err := h.Store.ReadNotifications(userID, input.IDs)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Notifications cleared",
+		"cleared": cleared,
+	})
+}
+
+// ReadNotification отмечает одно уведомление прочитанным
+func (h *DBHandler) ReadNotification(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	notificationID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid notification ID")
+		return
+	}
+	userID, ok := GetUserID(r)
+	if !ok {
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "User not authenticated")
+		return
+	}
+	err = h.Store.ReadNotification(userID, notificationID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Notification not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Notification read"})
+}
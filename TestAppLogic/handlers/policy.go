@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"testapplogic/models"
+	"testapplogic/store"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// validGradingPolicy проверяет название правила итоговой оценки
+func validGradingPolicy(policy string) bool {
+	switch policy {
+	case models.GradingBest, models.GradingLast, models.GradingAverage, models.GradingFirst:
+		return true
+	}
+	return false
+}
+
+// validatePolicy проверяет ограничения на пересдачу и правило итоговой оценки
+func validatePolicy(maxAttempts, cooldown *int, policy string) error {
+	if maxAttempts != nil && *maxAttempts <= 0 {
+		return invalidField("max_attempts", "max_attempts must be positive")
+	}
+	if cooldown != nil && *cooldown <= 0 {
+		return invalidField("cooldown_seconds", "cooldown_seconds must be positive")
+	}
+	if !validGradingPolicy(policy) {
+		return invalidField("grading_policy", "grading_policy must be best, last, average or first")
+	}
+	return nil
+}
+
+// gradingPolicyNames — названия правил итоговой оценки для ответов бота
+var gradingPolicyNames = map[string]string{
+	models.GradingBest:    "лучшая попытка",
+	models.GradingLast:    "последняя попытка",
+	models.GradingAverage: "среднее по попыткам",
+	models.GradingFirst:   "первая попытка",
+}
+
+// nextAttemptAt возвращает время, с которого разрешена следующая попытка,
+// или nil, если пауза между попытками не задана или попыток ещё не было
+func nextAttemptAt(lastFinished *time.Time, cooldown *int) *time.Time {
+	if lastFinished == nil || cooldown == nil {
+		return nil
+	}
+	next := lastFinished.Add(time.Duration(*cooldown) * time.Second)
+	return &next
+}
+
+// gradedAttempt — оценка одной завершённой попытки
+type gradedAttempt struct {
+	ID         int
+	Score      float64
+	MaxScore   float64
+	Percentage float64
+}
+
+// gradedFrom переводит оценённую попытку из хранилища в gradedAttempt
+func gradedFrom(a models.Attempt) gradedAttempt {
+	g := gradedAttempt{ID: a.ID}
+	if a.Score != nil {
+		g.Score = *a.Score
+	}
+	if a.MaxScore != nil {
+		g.MaxScore = *a.MaxScore
+	}
+	if a.Percentage != nil {
+		g.Percentage = *a.Percentage
+	}
+	return g
+}
+
+// applyGradingPolicy вычисляет итоговую оценку по попыткам, упорядоченным по времени завершения
+func applyGradingPolicy(policy string, attempts []gradedAttempt) models.FinalScore {
+	final := models.FinalScore{Policy: policy, Attempts: len(attempts)}
+	if len(attempts) == 0 {
+		return final
+	}
+	var chosen gradedAttempt
+	switch policy {
+	case models.GradingAverage:
+		for _, a := range attempts {
+			final.Score += a.Score
+			final.MaxScore += a.MaxScore
+			final.Percentage += a.Percentage
+		}
+		n := float64(len(attempts))
+		final.Score /= n
+		final.MaxScore /= n
+		final.Percentage = math.Round(final.Percentage/n*100) / 100
+		return final
+	case models.GradingFirst:
+		chosen = attempts[0]
+	case models.GradingLast:
+		chosen = attempts[len(attempts)-1]
+	default:
+		chosen = attempts[0]
+		for _, a := range attempts[1:] {
+			if a.Percentage > chosen.Percentage {
+				chosen = a
+			}
+		}
+	}
+	id := chosen.ID
+	final.AttemptID = &id
+	final.Score = chosen.Score
+	final.MaxScore = chosen.MaxScore
+	final.Percentage = chosen.Percentage
+	return final
+}
+
+// loadFinalScore считает итоговую оценку пользователя за тест по правилу теста
+func loadFinalScore(s store.Store, testID, userID int) (models.FinalScore, error) {
+	t, err := s.TestWithDeleted(testID)
+	if err != nil {
+		return models.FinalScore{}, err
+	}
+	graded, err := s.GradedAttempts(userID, testID)
+	if err != nil {
+		return models.FinalScore{}, err
+	}
+	attempts := make([]gradedAttempt, len(graded))
+	for i, a := range graded {
+		attempts[i] = gradedFrom(a)
+	}
+	final := applyGradingPolicy(t.GradingPolicy, attempts)
+	final.TestID = testID
+	final.UserID = userID
+	return final, nil
+}
+
+// UpdateTestPolicy задаёт число попыток, паузу между ними и правило итоговой оценки
+func (h *DBHandler) UpdateTestPolicy(w http.ResponseWriter, r *http.Request) {
+	// Права те же, что у PUT /tests/{id}, который меняет эти же поля
+	t, ok := h.testForLifecycle(w, r, "course:test:write")
+	if !ok {
+		return
+	}
+	testID := t.ID
+	var input struct {
+		MaxAttempts   *int   `json:"max_attempts"`
+		Cooldown      *int   `json:"cooldown_seconds"`
+		GradingPolicy string `json:"grading_policy"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if input.GradingPolicy == "" {
+		input.GradingPolicy = models.GradingBest
+	}
+	if err := validatePolicy(input.MaxAttempts, input.Cooldown, input.GradingPolicy); err != nil {
+		writeInvalid(w, r, err)
+		return
+	}
+	err := h.Store.SetTestPolicy(testID, input.MaxAttempts, input.Cooldown, input.GradingPolicy)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Test not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":          "Policy updated",
+		"id":               testID,
+		"max_attempts":     input.MaxAttempts,
+		"cooldown_seconds": input.Cooldown,
+		"grading_policy":   input.GradingPolicy,
+	})
+}
+
+// GetTestScore возвращает итоговую оценку за тест по правилу теста.
+// Студент видит свою оценку, преподаватель курса — оценку любого студента через ?user_id=
+func (h *DBHandler) GetTestScore(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid test ID")
+		return
+	}
+	userID, ok := GetUserID(r)
+	if !ok {
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "User not authenticated")
+		return
+	}
+	t, err := h.Store.Test(testID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Test not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if t.Kind == models.TestKindSurvey {
+		WriteError(w, r, http.StatusBadRequest, CodeSurveyNotGraded, "Survey responses are not graded")
+		return
+	}
+	if s := r.URL.Query().Get("user_id"); s != "" {
+		target, err := strconv.Atoi(s)
+		if err != nil {
+			WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid user ID")
+			return
+		}
+		if target != userID && !CheckCourseAccess(h.Store, r, t.CourseID) {
+			WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+			return
+		}
+		userID = target
+	}
+	final, err := loadFinalScore(h.Store, testID, userID)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(final)
+}
@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testapplogic/models"
+	"testapplogic/store"
+
+	"github.com/gorilla/mux"
+)
+
+// poolTooSmallError сообщает, что в банке не хватает вопросов для пула
+type poolTooSmallError struct {
+	tag         string
+	need, found int
+}
+
+func (e poolTooSmallError) Error() string {
+	return fmt.Sprintf("Question pool %q needs %d questions, but only %d are available", e.tag, e.need, e.found)
+}
+
+// shuffleableType проверяет, можно ли перемешивать варианты вопроса: у «верно/неверно»
+// и шкалы Лайкерта порядок вариантов несёт смысл
+func shuffleableType(t string) bool {
+	switch t {
+	case models.QuestionSingle, models.QuestionMultiple, models.QuestionOrdering, models.QuestionMatching:
+		return true
+	}
+	return false
+}
+
+// validatePools проверяет пулы и приводит их теги к виду, в котором хранятся теги вопросов
+func validatePools(pools []models.QuestionPool) error {
+	seen := make(map[string]bool, len(pools))
+	for i := range pools {
+		p := &pools[i]
+		p.Tag = strings.ToLower(strings.TrimSpace(p.Tag))
+		if p.Tag == "" || p.Count <= 0 {
+			return invalidField("pools", "Each pool needs a tag and a positive count")
+		}
+		if seen[p.Tag] {
+			return invalidField("pools", "Duplicate pool tag "+p.Tag)
+		}
+		seen[p.Tag] = true
+		if p.Points == 0 {
+			p.Points = 1
+		}
+		if p.Points < 0 {
+			return invalidField("pools", "points must be positive")
+		}
+	}
+	return nil
+}
+
+// checkPoolSizes проверяет, что в банке хватает вопросов на все пулы сразу. Проверка
+// делает ту же раздачу, что и buildAttemptPaper: вопрос с тегами двух пулов достаётся
+// только одному из них, иначе попытку по тесту нельзя было бы начать
+func checkPoolSizes(s store.Store, testID, courseID int, kind string, pools []models.QuestionPool) error {
+	fixed, err := s.TestQuestionIDs(testID)
+	if err != nil {
+		return err
+	}
+	candidates, err := s.PoolCandidates(courseID, kind, poolTags(pools), fixed)
+	if err != nil {
+		return err
+	}
+	_, err = drawPools(pools, candidates)
+	return err
+}
+
+// poolTags возвращает теги пулов
+func poolTags(pools []models.QuestionPool) []string {
+	tags := make([]string, len(pools))
+	for i, p := range pools {
+		tags[i] = p.Tag
+	}
+	return tags
+}
+
+// drawPools раздаёт вопросы пулам так, чтобы каждый пул получил Count разных вопросов
+// со своим тегом и ни один вопрос не достался двум пулам. Это поиск паросочетания
+// между местами в пулах и вопросами: если раздача возможна, она будет найдена, даже
+// когда жадный выбор по порядку пулов застрял бы. Вопросы рассматриваются в порядке
+// candidates, поэтому для случайного варианта их нужно перемешать заранее.
+// Возвращает вопросы каждого пула с баллами пула
+func drawPools(pools []models.QuestionPool, candidates []models.Question) ([][]models.Question, error) {
+	// eligible[i] — индексы кандидатов с тегом пула i
+	eligible := make([][]int, len(pools))
+	for i, p := range pools {
+		for c, question := range candidates {
+			for _, tag := range question.Tags {
+				if tag == p.Tag {
+					eligible[i] = append(eligible[i], c)
+					break
+				}
+			}
+		}
+	}
+	var slots []int // пул каждого места
+	for i, p := range pools {
+		for k := 0; k < p.Count; k++ {
+			slots = append(slots, i)
+		}
+	}
+	holder := make([]int, len(candidates)) // место, которому достался кандидат, или -1
+	for c := range holder {
+		holder[c] = -1
+	}
+	var assign func(slot int, seen []bool) bool
+	assign = func(slot int, seen []bool) bool {
+		for _, c := range eligible[slots[slot]] {
+			if seen[c] {
+				continue
+			}
+			seen[c] = true
+			if holder[c] < 0 || assign(holder[c], seen) {
+				holder[c] = slot
+				return true
+			}
+		}
+		return false
+	}
+	for slot, pool := range slots {
+		if !assign(slot, make([]bool, len(candidates))) {
+			p := pools[pool]
+			filled := 0
+			for _, other := range holder {
+				if other >= 0 && slots[other] == pool {
+					filled++
+				}
+			}
+			return nil, poolTooSmallError{tag: p.Tag, need: p.Count, found: filled}
+		}
+	}
+	drawn := make([][]models.Question, len(pools))
+	for c, slot := range holder {
+		if slot < 0 {
+			continue
+		}
+		pool := slots[slot]
+		question := candidates[c]
+		question.Points = pools[pool].Points
+		drawn[pool] = append(drawn[pool], question)
+	}
+	return drawn, nil
+}
+
+// buildAttemptPaper составляет и сохраняет вариант попытки: постоянные вопросы теста
+// и случайные вопросы из каждого пула. Вопрос не попадает в вариант дважды.
+// Возвращает ID вопросов в порядке показа
+func buildAttemptPaper(s store.Store, attemptID int, t models.Test) ([]int, error) {
+	questions, err := s.TestQuestions(t.ID)
+	if err != nil {
+		return nil, err
+	}
+	chosen := make([]int, 0, len(questions))
+	for _, question := range questions {
+		chosen = append(chosen, question.ID)
+	}
+	pools, err := s.TestPools(t.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(pools) > 0 {
+		candidates, err := s.PoolCandidates(t.CourseID, t.Kind, poolTags(pools), chosen)
+		if err != nil {
+			return nil, err
+		}
+		rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+		drawn, err := drawPools(pools, candidates)
+		if err != nil {
+			return nil, err
+		}
+		for _, pool := range drawn {
+			questions = append(questions, pool...)
+		}
+	}
+	if t.ShuffleQuestions {
+		rand.Shuffle(len(questions), func(i, j int) { questions[i], questions[j] = questions[j], questions[i] })
+	}
+	paper := make([]store.PaperQuestion, len(questions))
+	ids := make([]int, len(questions))
+	for i, question := range questions {
+		paper[i].Question = question
+		if t.ShuffleOptions && shuffleableType(question.Type) {
+			paper[i].Order = rand.Perm(len(question.Options))
+		}
+		ids[i] = question.ID
+	}
+	if err := s.SavePaper(attemptID, paper); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// presentQuestion возвращает вопрос варианта без ключа и с вариантами в порядке показа.
+// OptionIDs содержит исходные номера показанных вариантов
+func presentQuestion(p store.PaperQuestion) models.StudentQuestion {
+	sq := studentQuestion(p.Question, false, 0)
+	if p.Order == nil {
+		return sq
+	}
+	sq.Options = make([]string, len(p.Order))
+	for i, idx := range p.Order {
+		sq.Options[i] = p.Question.Options[idx]
+	}
+	sq.OptionIDs = p.Order
+	return sq
+}
+
+// canonicalAnswer проверяет ответ, данный по вариантам в порядке показа,
+// и переводит его в номера исходных вариантов, в которых хранится ключ вопроса
+func canonicalAnswer(p store.PaperQuestion, raw json.RawMessage) (json.RawMessage, error) {
+	answer, err := normalizeAnswer(p.Question, raw)
+	if err != nil || p.Order == nil {
+		return answer, err
+	}
+	switch p.Question.Type {
+	case models.QuestionSingle:
+		var idx int
+		json.Unmarshal(answer, &idx)
+		return mustJSON(p.Order[idx]), nil
+	case models.QuestionMultiple, models.QuestionOrdering:
+		var idx []int
+		json.Unmarshal(answer, &idx)
+		for i, v := range idx {
+			idx[i] = p.Order[v]
+		}
+		// Выбор нескольких вариантов хранится отсортированным, порядок — как есть
+		if p.Question.Type == models.QuestionMultiple {
+			sort.Ints(idx)
+		}
+		return mustJSON(idx), nil
+	case models.QuestionMatching:
+		var pairs []int
+		json.Unmarshal(answer, &pairs)
+		canonical := make([]int, len(pairs))
+		for i, v := range pairs {
+			canonical[p.Order[i]] = v
+		}
+		return mustJSON(canonical), nil
+	}
+	return answer, nil
+}
+
+// GetAttemptQuestions возвращает вопросы варианта попытки в порядке показа, без ключей
+func (h *DBHandler) GetAttemptQuestions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	attemptID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid attempt ID")
+		return
+	}
+	userID, ok := GetUserID(r)
+	if !ok {
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "User not authenticated")
+		return
+	}
+	a, t, err := attemptTest(h.Store, attemptID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Attempt not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if a.UserID != userID && !CheckCourseAccess(h.Store, r, t.CourseID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+		return
+	}
+	paper, err := h.Store.AttemptPaper(attemptID)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	questions := make([]models.StudentQuestion, 0, len(paper))
+	for _, p := range paper {
+		questions = append(questions, presentQuestion(p))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(questions)
+}
+
+// testRandomization — настройки случайного составления вариантов теста
+type testRandomization struct {
+	TestID           int                   `json:"test_id"`
+	ShuffleQuestions bool                  `json:"shuffle_questions"`
+	ShuffleOptions   bool                  `json:"shuffle_options"`
+	Pools            []models.QuestionPool `json:"pools"`
+}
+
+// GetTestRandomization возвращает пулы вопросов и настройки перемешивания теста
+func (h *DBHandler) GetTestRandomization(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.testForComposition(w, r)
+	if !ok {
+		return
+	}
+	settings := testRandomization{TestID: t.ID, ShuffleQuestions: t.ShuffleQuestions, ShuffleOptions: t.ShuffleOptions}
+	pools, err := h.Store.TestPools(t.ID)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if pools == nil {
+		pools = []models.QuestionPool{}
+	}
+	settings.Pools = pools
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateTestRandomization заменяет пулы вопросов и настройки перемешивания теста.
+// Права те же, что у PUT /tests/{id}. Уже начатые попытки сохраняют свои варианты
+func (h *DBHandler) UpdateTestRandomization(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.testForLifecycle(w, r, "course:test:write")
+	if !ok {
+		return
+	}
+	testID := t.ID
+	var input testRandomization
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if err := validatePools(input.Pools); err != nil {
+		writeInvalid(w, r, err)
+		return
+	}
+	tx, err := h.Store.Begin()
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction error")
+		return
+	}
+	defer tx.Rollback()
+	if err := checkPoolSizes(tx, testID, t.CourseID, t.Kind, input.Pools); errors.As(err, new(poolTooSmallError)) {
+		WriteError(w, r, http.StatusBadRequest, CodePoolTooSmall, err.Error())
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if err := tx.SetTestShuffle(testID, input.ShuffleQuestions, input.ShuffleOptions); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if err := tx.SetTestPools(testID, input.Pools); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Transaction commit failed")
+		return
+	}
+	input.TestID = testID
+	if input.Pools == nil {
+		input.Pools = []models.QuestionPool{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(input)
+}
@@ -0,0 +1,978 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"testapplogic/models"
+	"time"
+)
+
+// Пространства имён и типы ресурсов пакета IMS QTI 2.1
+const (
+	qtiNamespace      = "http://www.imsglobal.org/xsd/imsqti_v2p1"
+	qtiCPNamespace    = "http://www.imsglobal.org/xsd/imscp_v1p1"
+	qtiTestResource   = "imsqti_test_xmlv2p1"
+	qtiItemResource   = "imsqti_item_xmlv2p1"
+	qtiMatchCorrect   = "http://www.imsglobal.org/question/qti_v2p1/rptemplates/match_correct"
+	qtiManifestFile   = "imsmanifest.xml"
+	qtiResponse       = "RESPONSE"
+	qtiDefaultTitle   = "QTI import"
+	qtiWeightID       = "WEIGHT"
+	qtiTrueIdentifier = "true"
+)
+
+// qtiManifest — imsmanifest.xml пакета содержимого IMS CP
+type qtiManifest struct {
+	XMLName       xml.Name      `xml:"manifest"`
+	XMLNS         string        `xml:"xmlns,attr,omitempty"`
+	Identifier    string        `xml:"identifier,attr"`
+	Schema        string        `xml:"metadata>schema"`
+	SchemaVersion string        `xml:"metadata>schemaversion"`
+	Organizations struct{}      `xml:"organizations"`
+	Resources     []qtiResource `xml:"resources>resource"`
+}
+
+// qtiResource — ресурс манифеста: тест или вопрос
+type qtiResource struct {
+	Identifier   string          `xml:"identifier,attr"`
+	Type         string          `xml:"type,attr"`
+	Href         string          `xml:"href,attr"`
+	Files        []qtiFile       `xml:"file"`
+	Dependencies []qtiDependency `xml:"dependency"`
+}
+
+// qtiFile — файл ресурса
+type qtiFile struct {
+	Href string `xml:"href,attr"`
+}
+
+// qtiDependency — ссылка ресурса теста на ресурс вопроса
+type qtiDependency struct {
+	IdentifierRef string `xml:"identifierref,attr"`
+}
+
+// qtiTest — assessmentTest
+type qtiTest struct {
+	XMLName    xml.Name       `xml:"assessmentTest"`
+	XMLNS      string         `xml:"xmlns,attr,omitempty"`
+	Identifier string         `xml:"identifier,attr"`
+	Title      string         `xml:"title,attr"`
+	TimeLimits *qtiTimeLimits `xml:"timeLimits"`
+	Parts      []qtiTestPart  `xml:"testPart"`
+}
+
+// qtiTimeLimits — ограничение времени в секундах
+type qtiTimeLimits struct {
+	MaxTime float64 `xml:"maxTime,attr"`
+}
+
+// qtiTestPart — часть теста
+type qtiTestPart struct {
+	Identifier     string         `xml:"identifier,attr"`
+	NavigationMode string         `xml:"navigationMode,attr"`
+	SubmissionMode string         `xml:"submissionMode,attr"`
+	TimeLimits     *qtiTimeLimits `xml:"timeLimits"`
+	Sections       []qtiSection   `xml:"assessmentSection"`
+}
+
+// qtiSection — раздел теста. Раздел с selection соответствует пулу вопросов
+type qtiSection struct {
+	Identifier string        `xml:"identifier,attr"`
+	Title      string        `xml:"title,attr"`
+	Visible    bool          `xml:"visible,attr"`
+	Selection  *qtiSelection `xml:"selection"`
+	Ordering   *qtiOrdering  `xml:"ordering"`
+	Sections   []qtiSection  `xml:"assessmentSection"`
+	Items      []qtiItemRef  `xml:"assessmentItemRef"`
+}
+
+// qtiSelection — случайный выбор select вопросов раздела
+type qtiSelection struct {
+	Select int `xml:"select,attr"`
+}
+
+// qtiOrdering — перемешивание вопросов раздела
+type qtiOrdering struct {
+	Shuffle bool `xml:"shuffle,attr"`
+}
+
+// qtiItemRef — ссылка раздела на вопрос с весом
+type qtiItemRef struct {
+	Identifier string      `xml:"identifier,attr"`
+	Href       string      `xml:"href,attr"`
+	Weights    []qtiWeight `xml:"weight"`
+}
+
+// qtiWeight — вес вопроса в тесте
+type qtiWeight struct {
+	Identifier string  `xml:"identifier,attr"`
+	Value      float64 `xml:"value,attr"`
+}
+
+// qtiItem — assessmentItem. Тело и обработка ответа хранятся как XML:
+// при импорте они разбираются отдельно, потому что другие системы размечают их по-разному
+type qtiItem struct {
+	XMLName       xml.Name                 `xml:"assessmentItem"`
+	XMLNS         string                   `xml:"xmlns,attr,omitempty"`
+	Identifier    string                   `xml:"identifier,attr"`
+	Title         string                   `xml:"title,attr"`
+	Adaptive      bool                     `xml:"adaptive,attr"`
+	TimeDependent bool                     `xml:"timeDependent,attr"`
+	Responses     []qtiResponseDeclaration `xml:"responseDeclaration"`
+	Outcomes      []qtiOutcomeDeclaration  `xml:"outcomeDeclaration"`
+	Body          qtiMarkup                `xml:"itemBody"`
+	Processing    *qtiMarkup               `xml:"responseProcessing"`
+}
+
+// qtiResponseDeclaration — объявление ответа с правильным значением
+type qtiResponseDeclaration struct {
+	Identifier  string      `xml:"identifier,attr"`
+	Cardinality string      `xml:"cardinality,attr"`
+	BaseType    string      `xml:"baseType,attr"`
+	Correct     []string    `xml:"correctResponse>value"`
+	Mapping     *qtiMapping `xml:"mapping"`
+}
+
+// qtiMapping — баллы за отдельные значения ответа
+type qtiMapping struct {
+	DefaultValue float64       `xml:"defaultValue,attr"`
+	Entries      []qtiMapEntry `xml:"mapEntry"`
+}
+
+// qtiMapEntry — значение ответа и его баллы
+type qtiMapEntry struct {
+	MapKey        string  `xml:"mapKey,attr"`
+	MappedValue   float64 `xml:"mappedValue,attr"`
+	CaseSensitive bool    `xml:"caseSensitive,attr"`
+}
+
+// qtiOutcomeDeclaration — объявление результата вопроса
+type qtiOutcomeDeclaration struct {
+	Identifier  string `xml:"identifier,attr"`
+	Cardinality string `xml:"cardinality,attr"`
+	BaseType    string `xml:"baseType,attr"`
+}
+
+// qtiMarkup — элемент с произвольной разметкой внутри
+type qtiMarkup struct {
+	Template string `xml:"template,attr,omitempty"`
+	Inner    string `xml:",innerxml"`
+}
+
+// qtiInteraction — взаимодействие любого поддерживаемого вида; вид задаётся именем элемента
+type qtiInteraction struct {
+	XMLName         xml.Name
+	Response        string        `xml:"responseIdentifier,attr"`
+	Class           string        `xml:"class,attr,omitempty"`
+	Shuffle         *bool         `xml:"shuffle,attr"`
+	MaxChoices      *int          `xml:"maxChoices,attr"`
+	MaxAssociations *int          `xml:"maxAssociations,attr"`
+	Prompt          *qtiMarkup    `xml:"prompt"`
+	Choices         []qtiChoice   `xml:"simpleChoice"`
+	MatchSets       []qtiMatchSet `xml:"simpleMatchSet"`
+}
+
+// qtiChoice — вариант ответа
+type qtiChoice struct {
+	Identifier string `xml:"identifier,attr"`
+	MatchMax   *int   `xml:"matchMax,attr"`
+	Inner      string `xml:",innerxml"`
+}
+
+// qtiMatchSet — один из двух списков вопроса на сопоставление
+type qtiMatchSet struct {
+	Choices []qtiChoice `xml:"simpleAssociableChoice"`
+}
+
+// qtiInteractions — взаимодействия, которые переводятся в вопросы системы
+var qtiInteractions = map[string]bool{
+	"choiceInteraction":       true,
+	"orderInteraction":        true,
+	"matchInteraction":        true,
+	"textEntryInteraction":    true,
+	"extendedTextInteraction": true,
+}
+
+// qtiEscape экранирует текст для XML
+func qtiEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// qtiHTML переводит текст вопроса в разметку QTI с сохранением переносов строк
+func qtiHTML(s string) string {
+	return strings.ReplaceAll(qtiEscape(s), "&#xA;", "<br/>")
+}
+
+// qtiItemID возвращает идентификатор вопроса в пакете
+func qtiItemID(id int) string {
+	return fmt.Sprintf("item-%d", id)
+}
+
+// qtiScoreCondition строит обработку ответа: 1 балл, если выполнено условие cond, иначе 0
+func qtiScoreCondition(cond string) *qtiMarkup {
+	score := func(v int) string {
+		return fmt.Sprintf(`<setOutcomeValue identifier="SCORE"><baseValue baseType="float">%d</baseValue></setOutcomeValue>`, v)
+	}
+	return &qtiMarkup{Inner: "<responseCondition><responseIf>" + cond + score(1) +
+		"</responseIf><responseElse>" + score(0) + "</responseElse></responseCondition>"}
+}
+
+// marshalQTI сериализует документ пакета с XML-заголовком
+func marshalQTI(v interface{}) ([]byte, error) {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// writeQTIPackage записывает тест в виде пакета IMS QTI 2.1: манифест, assessmentTest
+// и по файлу assessmentItem на вопрос. Вопросы состава лежат в основном разделе с весами,
+// каждый пул — отдельный раздел с selection. Расписание, попытки, политика оценки,
+// анонимность и теги, не относящиеся к пулам, в QTI не переносятся
+func writeQTIPackage(w io.Writer, testID int, b models.TestBundle) error {
+	testHref := fmt.Sprintf("test-%d.xml", testID)
+	manifest := qtiManifest{
+		XMLNS:         qtiCPNamespace,
+		Identifier:    fmt.Sprintf("manifest-test-%d", testID),
+		Schema:        "QTIv2.1 Package",
+		SchemaVersion: "1.0.0",
+	}
+	testRes := qtiResource{Identifier: fmt.Sprintf("test-%d", testID), Type: qtiTestResource, Href: testHref,
+		Files: []qtiFile{{Href: testHref}}}
+	var itemRes []qtiResource
+	files := make(map[string][]byte)
+	var names []string
+	add := func(name string, v interface{}) error {
+		data, err := marshalQTI(v)
+		if err != nil {
+			return err
+		}
+		files[name] = data
+		names = append(names, name)
+		return nil
+	}
+
+	main := qtiSection{Identifier: "main", Title: b.Test.Name, Visible: true,
+		Ordering: &qtiOrdering{Shuffle: b.Test.ShuffleQuestions}}
+	pools := make([]qtiSection, len(b.Pools))
+	for i, p := range b.Pools {
+		pools[i] = qtiSection{Identifier: fmt.Sprintf("pool-%d", i+1), Title: p.Tag, Visible: true,
+			Selection: &qtiSelection{Select: p.Count}}
+	}
+	for _, bq := range b.Questions {
+		item, err := qtiItemOf(bq, b.Test.ShuffleOptions)
+		if err != nil {
+			return fmt.Errorf("question %d: %w", bq.ID, err)
+		}
+		href := "items/" + item.Identifier + ".xml"
+		if err := add(href, item); err != nil {
+			return err
+		}
+		itemRes = append(itemRes, qtiResource{Identifier: item.Identifier, Type: qtiItemResource, Href: href,
+			Files: []qtiFile{{Href: href}}})
+		testRes.Dependencies = append(testRes.Dependencies, qtiDependency{IdentifierRef: item.Identifier})
+		if bq.InTest {
+			main.Items = append(main.Items, qtiItemRef{Identifier: item.Identifier, Href: href,
+				Weights: []qtiWeight{{Identifier: qtiWeightID, Value: bq.Points}}})
+			continue
+		}
+		for i, p := range b.Pools {
+			for _, tag := range bq.Tags {
+				if tag == p.Tag {
+					pools[i].Items = append(pools[i].Items, qtiItemRef{Identifier: pools[i].Identifier + "-" + item.Identifier,
+						Href: href, Weights: []qtiWeight{{Identifier: qtiWeightID, Value: p.Points}}})
+				}
+			}
+		}
+	}
+
+	test := qtiTest{XMLNS: qtiNamespace, Identifier: testRes.Identifier, Title: b.Test.Name}
+	if b.Test.TimeLimit != nil {
+		test.TimeLimits = &qtiTimeLimits{MaxTime: float64(*b.Test.TimeLimit)}
+	}
+	test.Parts = []qtiTestPart{{Identifier: "part-1", NavigationMode: "nonlinear", SubmissionMode: "simultaneous",
+		Sections: append([]qtiSection{main}, pools...)}}
+	if err := add(testHref, test); err != nil {
+		return err
+	}
+	manifest.Resources = append([]qtiResource{testRes}, itemRes...)
+	data, err := marshalQTI(manifest)
+	if err != nil {
+		return err
+	}
+	files[qtiManifestFile] = data
+
+	zw := zip.NewWriter(w)
+	// Манифест кладётся первым, как принято в пакетах IMS CP
+	for _, name := range append([]string{qtiManifestFile}, names...) {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// qtiItemOf переводит вопрос пакета в assessmentItem
+func qtiItemOf(bq models.BundleQuestion, shuffle bool) (qtiItem, error) {
+	item := qtiItem{
+		XMLNS:      qtiNamespace,
+		Identifier: qtiItemID(bq.ID),
+		Title:      importTitle("", bq.Text),
+		Outcomes:   []qtiOutcomeDeclaration{{Identifier: "SCORE", Cardinality: "single", BaseType: "float"}},
+		Processing: &qtiMarkup{Template: qtiMatchCorrect},
+	}
+	keyed := len(bq.CorrectAnswer) > 0 && string(bq.CorrectAnswer) != "null"
+	resp := qtiResponseDeclaration{Identifier: qtiResponse, Cardinality: "single", BaseType: "identifier"}
+	it := qtiInteraction{Response: qtiResponse, Prompt: &qtiMarkup{Inner: qtiHTML(bq.Text)}}
+	ids := make([]string, len(bq.Options))
+	for i := range bq.Options {
+		ids[i] = fmt.Sprintf("choice_%d", i)
+	}
+	choices := func() []qtiChoice {
+		result := make([]qtiChoice, len(bq.Options))
+		for i, o := range bq.Options {
+			result[i] = qtiChoice{Identifier: ids[i], Inner: qtiEscape(o)}
+		}
+		return result
+	}
+	var err error
+	body := ""
+	switch bq.Type {
+	case models.QuestionSingle, models.QuestionMultiple, models.QuestionTrueFalse, models.QuestionLikert:
+		it.XMLName.Local = "choiceInteraction"
+		it.Shuffle = &shuffle
+		maxChoices := 1
+		switch bq.Type {
+		case models.QuestionMultiple:
+			maxChoices = 0
+			resp.Cardinality = "multiple"
+		case models.QuestionTrueFalse:
+			// Варианты «верно/неверно» не перемешиваются и опознаются при импорте по идентификаторам
+			if len(ids) != 2 {
+				return item, errors.New("true_false question must have exactly 2 options")
+			}
+			ids = []string{qtiTrueIdentifier, "false"}
+			it.Shuffle = new(bool)
+			it.Class = models.QuestionTrueFalse
+		case models.QuestionLikert:
+			it.Shuffle = new(bool)
+			it.Class = models.QuestionLikert
+		}
+		it.MaxChoices = &maxChoices
+		it.Choices = choices()
+		if keyed {
+			resp.Correct, err = qtiChoiceKey(bq, ids)
+		}
+	case models.QuestionOrdering:
+		it.XMLName.Local = "orderInteraction"
+		it.Shuffle = new(bool)
+		*it.Shuffle = true
+		it.Choices = choices()
+		resp.Cardinality = "ordered"
+		if keyed {
+			var order []int
+			if err = json.Unmarshal(bq.CorrectAnswer, &order); err == nil {
+				for _, o := range order {
+					if o < 0 || o >= len(ids) {
+						return item, errors.New("correct answer index out of range")
+					}
+					resp.Correct = append(resp.Correct, ids[o])
+				}
+			}
+		}
+	case models.QuestionMatching:
+		it.XMLName.Local = "matchInteraction"
+		it.Shuffle = &shuffle
+		maxAssociations := len(bq.Options)
+		it.MaxAssociations = &maxAssociations
+		one, many := 1, len(bq.Options)
+		var left, right qtiMatchSet
+		for i, o := range bq.Options {
+			left.Choices = append(left.Choices, qtiChoice{Identifier: fmt.Sprintf("opt_%d", i), MatchMax: &one, Inner: qtiEscape(o)})
+		}
+		for j, m := range bq.Matches {
+			right.Choices = append(right.Choices, qtiChoice{Identifier: fmt.Sprintf("match_%d", j), MatchMax: &many, Inner: qtiEscape(m)})
+		}
+		it.MatchSets = []qtiMatchSet{left, right}
+		resp.Cardinality, resp.BaseType = "multiple", "directedPair"
+		if keyed {
+			var pairs []int
+			if err = json.Unmarshal(bq.CorrectAnswer, &pairs); err == nil {
+				for i, m := range pairs {
+					resp.Correct = append(resp.Correct, fmt.Sprintf("opt_%d match_%d", i, m))
+				}
+			}
+		}
+	case models.QuestionNumeric, models.QuestionText:
+		// textEntryInteraction — строчный элемент, поэтому текст вопроса стоит перед ним в теле
+		it.XMLName.Local = "textEntryInteraction"
+		it.Prompt = nil
+		resp.BaseType = "string"
+		if bq.Type == models.QuestionNumeric {
+			resp.BaseType = "float"
+		}
+		if keyed {
+			if bq.Type == models.QuestionNumeric {
+				err = qtiNumericKey(bq, &resp, &item)
+			} else {
+				err = qtiTextKey(bq, &resp, &item)
+			}
+		}
+		body = "<div>" + qtiHTML(bq.Text) + "</div>"
+	case models.QuestionFreeText:
+		it.XMLName.Local = "extendedTextInteraction"
+		resp.BaseType = "string"
+	default:
+		return item, errors.New("unsupported question type " + bq.Type)
+	}
+	if err != nil {
+		return item, errors.New("invalid correct_answer: " + err.Error())
+	}
+	data, err := xml.Marshal(it)
+	if err != nil {
+		return item, err
+	}
+	if it.XMLName.Local == "textEntryInteraction" {
+		body += "<p>" + string(data) + "</p>"
+	} else {
+		body += string(data)
+	}
+	item.Body.Inner = body
+	item.Responses = []qtiResponseDeclaration{resp}
+	if !keyed {
+		item.Processing = nil
+	}
+	return item, nil
+}
+
+// qtiChoiceKey переводит ключ вопроса с выбором в идентификаторы вариантов
+func qtiChoiceKey(bq models.BundleQuestion, ids []string) ([]string, error) {
+	switch bq.Type {
+	case models.QuestionTrueFalse:
+		var value bool
+		if err := json.Unmarshal(bq.CorrectAnswer, &value); err != nil {
+			return nil, err
+		}
+		if value {
+			return []string{ids[0]}, nil
+		}
+		return []string{ids[1]}, nil
+	case models.QuestionSingle:
+		var idx int
+		if err := json.Unmarshal(bq.CorrectAnswer, &idx); err != nil {
+			return nil, err
+		}
+		if idx < 0 || idx >= len(ids) {
+			return nil, errors.New("index out of range")
+		}
+		return []string{ids[idx]}, nil
+	}
+	var idx []int
+	if err := json.Unmarshal(bq.CorrectAnswer, &idx); err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, i := range idx {
+		if i < 0 || i >= len(ids) {
+			return nil, errors.New("index out of range")
+		}
+		result = append(result, ids[i])
+	}
+	return result, nil
+}
+
+// qtiNumericKey записывает ключ числового вопроса: правильное значение
+// и сравнение с абсолютной погрешностью
+func qtiNumericKey(bq models.BundleQuestion, resp *qtiResponseDeclaration, item *qtiItem) error {
+	var key models.NumericKey
+	if err := json.Unmarshal(bq.CorrectAnswer, &key); err != nil {
+		return err
+	}
+	resp.Correct = []string{strconv.FormatFloat(key.Value, 'g', -1, 64)}
+	t := strconv.FormatFloat(key.Tolerance, 'g', -1, 64)
+	item.Processing = qtiScoreCondition(`<equal toleranceMode="absolute" tolerance="` + t + ` ` + t +
+		`"><variable identifier="RESPONSE"/><correct identifier="RESPONSE"/></equal>`)
+	return nil
+}
+
+// qtiTextKey записывает ключ текстового вопроса: допустимые ответы в mapping
+// и обработку ответа через stringMatch и patternMatch
+func qtiTextKey(bq models.BundleQuestion, resp *qtiResponseDeclaration, item *qtiItem) error {
+	var key models.TextKey
+	if err := json.Unmarshal(bq.CorrectAnswer, &key); err != nil {
+		return err
+	}
+	var cond strings.Builder
+	cond.WriteString("<or>")
+	if len(key.Accepted) > 0 {
+		resp.Correct = []string{key.Accepted[0]}
+		resp.Mapping = &qtiMapping{}
+	}
+	for _, a := range key.Accepted {
+		resp.Mapping.Entries = append(resp.Mapping.Entries, qtiMapEntry{MapKey: a, MappedValue: 1, CaseSensitive: key.CaseSensitive})
+		fmt.Fprintf(&cond, `<stringMatch caseSensitive="%t"><variable identifier="RESPONSE"/><baseValue baseType="string">%s</baseValue></stringMatch>`,
+			key.CaseSensitive, qtiEscape(a))
+	}
+	if key.Pattern != "" {
+		fmt.Fprintf(&cond, `<patternMatch pattern="%s"><variable identifier="RESPONSE"/></patternMatch>`, qtiEscape(key.Pattern))
+	}
+	cond.WriteString("</or>")
+	item.Processing = qtiScoreCondition(cond.String())
+	return nil
+}
+
+// readQTIPackage читает пакет IMS QTI 2.1 и переводит его в пакет теста.
+// Поддерживаются пакеты writeQTIPackage и пакеты других систем с теми же видами
+// взаимодействий; пакет без assessmentTest становится тестом из всех вопросов манифеста
+func readQTIPackage(data []byte) (models.TestBundle, error) {
+	bundle := models.TestBundle{
+		Version:    models.TestBundleVersion,
+		ExportedAt: time.Now(),
+		Test:       models.BundleTest{Name: qtiDefaultTitle},
+		Questions:  []models.BundleQuestion{},
+		Pools:      []models.BundlePool{},
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return bundle, errors.New("not a zip archive")
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[path.Clean(f.Name)] = f
+	}
+	read := func(name string, v interface{}) error {
+		f, ok := files[path.Clean(name)]
+		if !ok {
+			return errors.New(name + " is missing")
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		defer rc.Close()
+		dec := xml.NewDecoder(io.LimitReader(rc, maxBundleSize))
+		dec.Entity = xml.HTMLEntity
+		if err := dec.Decode(v); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	}
+	var manifest qtiManifest
+	if err := read(qtiManifestFile, &manifest); err != nil {
+		return bundle, err
+	}
+
+	// Вопросы загружаются по мере появления в тесте; повторная ссылка на тот же файл
+	// только добавляет тег пула
+	index := make(map[string]int)
+	loadItem := func(href string) (int, error) {
+		href = path.Clean(href)
+		if i, ok := index[href]; ok {
+			return i, nil
+		}
+		var item qtiItem
+		if err := read(href, &item); err != nil {
+			return 0, err
+		}
+		bq, shuffle, err := qtiQuestionOf(item)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", href, err)
+		}
+		bundle.Test.ShuffleOptions = bundle.Test.ShuffleOptions || shuffle
+		index[href] = len(bundle.Questions)
+		bundle.Questions = append(bundle.Questions, bq)
+		return len(bundle.Questions) - 1, nil
+	}
+
+	var test *qtiResource
+	for i, res := range manifest.Resources {
+		if strings.HasPrefix(res.Type, "imsqti_test_xmlv2p") {
+			test = &manifest.Resources[i]
+			break
+		}
+	}
+	if test == nil {
+		for _, res := range manifest.Resources {
+			if !strings.HasPrefix(res.Type, "imsqti_item_xmlv2p") {
+				continue
+			}
+			i, err := loadItem(res.Href)
+			if err != nil {
+				return bundle, err
+			}
+			bundle.Questions[i].InTest, bundle.Questions[i].Points = true, 1
+		}
+	} else {
+		var qt qtiTest
+		if err := read(test.Href, &qt); err != nil {
+			return bundle, err
+		}
+		if strings.TrimSpace(qt.Title) != "" {
+			bundle.Test.Name = strings.TrimSpace(qt.Title)
+		}
+		limits := qt.TimeLimits
+		base := path.Dir(test.Href)
+		var walk func(sections []qtiSection, pool *models.BundlePool) error
+		walk = func(sections []qtiSection, pool *models.BundlePool) error {
+			for _, s := range sections {
+				current := pool
+				if pool == nil && s.Selection != nil && s.Selection.Select > 0 {
+					tag := strings.TrimSpace(s.Title)
+					if tag == "" {
+						tag = s.Identifier
+					}
+					current = &models.BundlePool{Tag: strings.ToLower(tag), Count: s.Selection.Select}
+				} else if pool == nil && s.Ordering != nil && s.Ordering.Shuffle {
+					bundle.Test.ShuffleQuestions = true
+				}
+				for _, ref := range s.Items {
+					i, err := loadItem(path.Join(base, ref.Href))
+					if err != nil {
+						return err
+					}
+					weight := 1.0
+					if len(ref.Weights) > 0 && ref.Weights[0].Value > 0 {
+						weight = ref.Weights[0].Value
+					}
+					bq := &bundle.Questions[i]
+					if current == nil {
+						bq.InTest, bq.Points = true, weight
+						continue
+					}
+					bq.Tags = append(bq.Tags, current.Tag)
+					if current.Points == 0 {
+						current.Points = weight
+					}
+				}
+				if err := walk(s.Sections, current); err != nil {
+					return err
+				}
+				if current != nil && pool == nil {
+					bundle.Pools = append(bundle.Pools, *current)
+				}
+			}
+			return nil
+		}
+		for _, part := range qt.Parts {
+			if limits == nil {
+				limits = part.TimeLimits
+			}
+			if err := walk(part.Sections, nil); err != nil {
+				return bundle, err
+			}
+		}
+		if limits != nil && limits.MaxTime > 0 {
+			seconds := int(limits.MaxTime)
+			bundle.Test.TimeLimit = &seconds
+		}
+	}
+
+	// Тест без единого ключа — опрос
+	bundle.Test.Kind = models.TestKindSurvey
+	for _, bq := range bundle.Questions {
+		if len(bq.CorrectAnswer) > 0 {
+			bundle.Test.Kind = models.TestKindQuiz
+		}
+	}
+	if len(bundle.Questions) == 0 {
+		bundle.Test.Kind = models.TestKindQuiz
+	}
+	qtiAssignIDs(bundle.Questions)
+	return bundle, nil
+}
+
+// qtiAssignIDs восстанавливает исходные ID вопросов из идентификаторов item-N;
+// вопросам с другими или повторяющимися идентификаторами выдаются свободные номера
+func qtiAssignIDs(questions []models.BundleQuestion) {
+	used := make(map[int]bool, len(questions))
+	max := 0
+	for i := range questions {
+		if id := questions[i].ID; id > 0 && !used[id] {
+			used[id] = true
+			if id > max {
+				max = id
+			}
+		} else {
+			questions[i].ID = 0
+		}
+	}
+	for i := range questions {
+		if questions[i].ID == 0 {
+			max++
+			questions[i].ID = max
+		}
+	}
+}
+
+// qtiQuestionOf переводит assessmentItem в вопрос пакета. Второе значение — перемешивает ли
+// вопрос варианты: в системе это настройка теста, а не вопроса
+func qtiQuestionOf(item qtiItem) (models.BundleQuestion, bool, error) {
+	bq := models.BundleQuestion{Tags: []string{}}
+	if id, err := strconv.Atoi(strings.TrimPrefix(item.Identifier, "item-")); err == nil && strings.HasPrefix(item.Identifier, "item-") {
+		bq.ID = id
+	}
+	text, it, err := qtiBody(item.Body.Inner)
+	if err != nil {
+		return bq, false, err
+	}
+	if it == nil {
+		return bq, false, errors.New("item has no supported interaction")
+	}
+	bq.Text = text
+	var resp qtiResponseDeclaration
+	for _, r := range item.Responses {
+		if r.Identifier == it.Response {
+			resp = r
+		}
+	}
+	var rules qtiRules
+	if item.Processing != nil {
+		rules = qtiScanProcessing(item.Processing.Inner)
+	}
+	options := func(choices []qtiChoice) ([]string, map[string]int) {
+		texts := make([]string, len(choices))
+		ids := make(map[string]int, len(choices))
+		for i, c := range choices {
+			texts[i] = htmlText(c.Inner)
+			ids[c.Identifier] = i
+		}
+		return texts, ids
+	}
+	// Порядок вопроса на упорядочивание перемешивается всегда
+	shuffle := it.Shuffle != nil && *it.Shuffle && it.XMLName.Local != "orderInteraction"
+
+	switch it.XMLName.Local {
+	case "choiceInteraction":
+		var ids map[string]int
+		bq.Options, ids = options(it.Choices)
+		switch {
+		case it.Class == models.QuestionLikert:
+			bq.Type = models.QuestionLikert
+		case len(it.Choices) == 2 && strings.EqualFold(it.Choices[0].Identifier, qtiTrueIdentifier) &&
+			strings.EqualFold(it.Choices[1].Identifier, "false"):
+			bq.Type = models.QuestionTrueFalse
+		case it.MaxChoices != nil && *it.MaxChoices == 1:
+			bq.Type = models.QuestionSingle
+		default:
+			bq.Type = models.QuestionMultiple
+		}
+		var key []int
+		for _, v := range resp.Correct {
+			i, ok := ids[strings.TrimSpace(v)]
+			if !ok {
+				return bq, false, errors.New("correct response " + v + " is not a choice")
+			}
+			key = append(key, i)
+		}
+		if len(key) == 0 {
+			break
+		}
+		switch bq.Type {
+		case models.QuestionTrueFalse:
+			// Подписи вариантов у вопросов «верно/неверно» стандартные, см. validateQuestion
+			bq.Options = nil
+			bq.CorrectAnswer = mustJSON(key[0] == 0)
+		case models.QuestionSingle:
+			bq.CorrectAnswer = mustJSON(key[0])
+		default:
+			bq.CorrectAnswer = mustJSON(key)
+		}
+	case "orderInteraction":
+		var ids map[string]int
+		bq.Type = models.QuestionOrdering
+		bq.Options, ids = options(it.Choices)
+		var order []int
+		for _, v := range resp.Correct {
+			i, ok := ids[strings.TrimSpace(v)]
+			if !ok {
+				return bq, false, errors.New("correct response " + v + " is not a choice")
+			}
+			order = append(order, i)
+		}
+		if len(order) > 0 {
+			bq.CorrectAnswer = mustJSON(order)
+		}
+	case "matchInteraction":
+		if len(it.MatchSets) != 2 {
+			return bq, false, errors.New("matchInteraction needs two match sets")
+		}
+		var left, right map[string]int
+		bq.Type = models.QuestionMatching
+		bq.Options, left = options(it.MatchSets[0].Choices)
+		bq.Matches, right = options(it.MatchSets[1].Choices)
+		if len(resp.Correct) == 0 {
+			break
+		}
+		key := make([]int, len(bq.Options))
+		for i := range key {
+			key[i] = -1
+		}
+		for _, v := range resp.Correct {
+			fields := strings.Fields(v)
+			if len(fields) != 2 {
+				return bq, false, errors.New("invalid directed pair " + v)
+			}
+			// Пара может быть записана в любом направлении
+			o, ok := left[fields[0]]
+			m, ok2 := right[fields[1]]
+			if !ok || !ok2 {
+				o, ok = left[fields[1]]
+				m, ok2 = right[fields[0]]
+			}
+			if !ok || !ok2 {
+				return bq, false, errors.New("invalid directed pair " + v)
+			}
+			key[o] = m
+		}
+		for _, m := range key {
+			if m < 0 {
+				return bq, false, errors.New("every option needs a correct match")
+			}
+		}
+		bq.CorrectAnswer = mustJSON(key)
+	case "textEntryInteraction":
+		if resp.BaseType == "float" || resp.BaseType == "integer" {
+			bq.Type = models.QuestionNumeric
+			if len(resp.Correct) == 0 {
+				break
+			}
+			var key models.NumericKey
+			if key.Value, err = strconv.ParseFloat(strings.TrimSpace(resp.Correct[0]), 64); err != nil {
+				return bq, false, errors.New("invalid numeric correct response")
+			}
+			key.Tolerance = rules.tolerance
+			bq.CorrectAnswer = mustJSON(key)
+			break
+		}
+		key := models.TextKey{Pattern: rules.pattern, CaseSensitive: rules.caseSensitive}
+		seen := make(map[string]bool)
+		accept := func(a string) {
+			if a = strings.TrimSpace(a); a != "" && !seen[a] {
+				seen[a] = true
+				key.Accepted = append(key.Accepted, a)
+			}
+		}
+		for _, v := range resp.Correct {
+			accept(v)
+		}
+		if resp.Mapping != nil {
+			for _, e := range resp.Mapping.Entries {
+				if e.MappedValue > 0 {
+					accept(e.MapKey)
+					key.CaseSensitive = key.CaseSensitive || e.CaseSensitive
+				}
+			}
+		}
+		for _, a := range rules.accepted {
+			accept(a)
+		}
+		// Текстовое поле без ключа — свободный ответ опроса
+		if len(key.Accepted) == 0 && key.Pattern == "" {
+			bq.Type = models.QuestionFreeText
+			break
+		}
+		bq.Type = models.QuestionText
+		bq.CorrectAnswer = mustJSON(key)
+	case "extendedTextInteraction":
+		bq.Type = models.QuestionFreeText
+	}
+	return bq, shuffle, nil
+}
+
+// qtiBody разбирает тело вопроса: находит первое поддерживаемое взаимодействие и собирает
+// текст вопроса из разметки вокруг него и его prompt
+func qtiBody(inner string) (string, *qtiInteraction, error) {
+	dec := xml.NewDecoder(strings.NewReader(inner))
+	dec.Entity = xml.HTMLEntity
+	for {
+		start := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return htmlText(inner), nil, nil
+		} else if err != nil {
+			return "", nil, errors.New("invalid item body: " + err.Error())
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || !qtiInteractions[se.Name.Local] {
+			continue
+		}
+		var it qtiInteraction
+		if err := dec.DecodeElement(&it, &se); err != nil {
+			return "", nil, errors.New("invalid " + se.Name.Local + ": " + err.Error())
+		}
+		text := inner[:start]
+		if it.Prompt != nil {
+			text += "<br/>" + it.Prompt.Inner
+		}
+		text += "<br/>" + inner[dec.InputOffset():]
+		return htmlText(text), &it, nil
+	}
+}
+
+// qtiRules — сведения о ключе из responseProcessing: погрешность числового ответа,
+// допустимые строки и регулярное выражение текстового
+type qtiRules struct {
+	tolerance     float64
+	accepted      []string
+	pattern       string
+	caseSensitive bool
+}
+
+// qtiScanProcessing ищет в responseProcessing условия, которые строит writeQTIPackage:
+// equal с погрешностью, stringMatch и patternMatch. Остальная логика обработки не разбирается
+func qtiScanProcessing(inner string) qtiRules {
+	var rules qtiRules
+	dec := xml.NewDecoder(strings.NewReader(inner))
+	dec.Entity = xml.HTMLEntity
+	inMatch := false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return rules
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			attrs := make(map[string]string, len(t.Attr))
+			for _, a := range t.Attr {
+				attrs[a.Name.Local] = a.Value
+			}
+			switch t.Name.Local {
+			case "equal":
+				if fields := strings.Fields(attrs["tolerance"]); attrs["toleranceMode"] == "absolute" && len(fields) > 0 {
+					rules.tolerance, _ = strconv.ParseFloat(fields[0], 64)
+				}
+			case "stringMatch":
+				inMatch = true
+				rules.caseSensitive = rules.caseSensitive || attrs["caseSensitive"] == "true"
+			case "patternMatch":
+				rules.pattern = attrs["pattern"]
+			case "baseValue":
+				if inMatch {
+					var value string
+					if dec.DecodeElement(&value, &t) == nil {
+						rules.accepted = append(rules.accepted, value)
+					}
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local == "stringMatch" {
+				inMatch = false
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testapplogic/models"
+	"testing"
+)
+
+func TestQTIRoundTrip(t *testing.T) {
+	limit := 900
+	bundle := models.TestBundle{
+		Version: models.TestBundleVersion,
+		Test: models.BundleTest{Name: "Итоговый тест", Kind: models.TestKindQuiz, TimeLimit: &limit,
+			ShuffleQuestions: true, ShuffleOptions: true},
+		Questions: []models.BundleQuestion{
+			{ID: 1, Type: models.QuestionSingle, Text: "2 < 3?\nВыберите", Options: []string{"да", "нет & нет"},
+				CorrectAnswer: mustJSON(0), InTest: true, Points: 2},
+			{ID: 2, Type: models.QuestionMultiple, Text: "Простые", Options: []string{"2", "3", "4"},
+				CorrectAnswer: mustJSON([]int{0, 1}), InTest: true, Points: 1},
+			{ID: 3, Type: models.QuestionTrueFalse, Text: "Земля круглая", Options: []string{"Верно", "Неверно"},
+				CorrectAnswer: mustJSON(false), InTest: true, Points: 1},
+			{ID: 4, Type: models.QuestionOrdering, Text: "По возрастанию", Options: []string{"1", "2", "3"},
+				CorrectAnswer: mustJSON([]int{2, 0, 1}), InTest: true, Points: 1},
+			{ID: 5, Type: models.QuestionMatching, Text: "Сопоставьте", Options: []string{"кот", "пёс"},
+				Matches: []string{"гав", "мяу", "муу"}, CorrectAnswer: mustJSON([]int{1, 0}), InTest: true, Points: 1},
+			{ID: 6, Type: models.QuestionNumeric, Text: "Число пи",
+				CorrectAnswer: mustJSON(models.NumericKey{Value: 3.14, Tolerance: 0.01}), InTest: true, Points: 1.5},
+			{ID: 7, Type: models.QuestionText, Text: "Столица России",
+				CorrectAnswer: mustJSON(models.TextKey{Accepted: []string{"Москва", "Moscow"}, Pattern: "моск.*"}), InTest: true, Points: 1},
+			{ID: 8, Type: models.QuestionFreeText, Text: "Комментарий", InTest: true, Points: 1},
+			{ID: 10, Type: models.QuestionSingle, Text: "Из пула", Options: []string{"a", "b"},
+				CorrectAnswer: mustJSON(1), Tags: []string{"алгебра"}},
+		},
+		Pools: []models.BundlePool{{Tag: "алгебра", Count: 1, Points: 3}},
+	}
+	var buf bytes.Buffer
+	if err := writeQTIPackage(&buf, 42, bundle); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readQTIPackage(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Test.Name != bundle.Test.Name || got.Test.Kind != models.TestKindQuiz || got.Test.TimeLimit == nil ||
+		*got.Test.TimeLimit != limit || !got.Test.ShuffleQuestions || !got.Test.ShuffleOptions {
+		t.Fatalf("test settings %+v, want them kept", got.Test)
+	}
+	if !reflect.DeepEqual(got.Pools, bundle.Pools) {
+		t.Fatalf("pools %+v, want %+v", got.Pools, bundle.Pools)
+	}
+	if len(got.Questions) != len(bundle.Questions) {
+		t.Fatalf("got %d questions, want %d", len(got.Questions), len(bundle.Questions))
+	}
+	for i, want := range bundle.Questions {
+		q := got.Questions[i]
+		// Подписи вопроса «верно/неверно» стандартные и в пакет не переносятся
+		if want.Type == models.QuestionTrueFalse {
+			want.Options = nil
+		}
+		if want.Tags == nil {
+			want.Tags = []string{}
+		}
+		if q.ID != want.ID || q.Type != want.Type || q.Text != want.Text || q.InTest != want.InTest || q.Points != want.Points {
+			t.Errorf("question %d: got %+v, want %+v", want.ID, q, want)
+			continue
+		}
+		if !reflect.DeepEqual(q.Options, want.Options) || !reflect.DeepEqual(q.Matches, want.Matches) ||
+			!reflect.DeepEqual(q.Tags, want.Tags) {
+			t.Errorf("question %d: got options %q matches %q tags %q, want %q %q %q",
+				want.ID, q.Options, q.Matches, q.Tags, want.Options, want.Matches, want.Tags)
+		}
+		if !bytes.Equal(compactJSON(q.CorrectAnswer), compactJSON(want.CorrectAnswer)) {
+			t.Errorf("question %d: got key %s, want %s", want.ID, q.CorrectAnswer, want.CorrectAnswer)
+		}
+	}
+}
+
+// qtiZip собирает ZIP-архив из файлов с заданным содержимым
+func qtiZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadQTIPackage(t *testing.T) {
+	const manifest = `<manifest xmlns="http://www.imsglobal.org/xsd/imscp_v1p1"><resources>
+		<resource identifier="q1" type="imsqti_item_xmlv2p1" href="q1.xml"/></resources></manifest>`
+	item := func(body, responses string) string {
+		return `<assessmentItem xmlns="http://www.imsglobal.org/xsd/imsqti_v2p1" identifier="q1" title="Q">` +
+			responses + `<itemBody>` + body + `</itemBody></assessmentItem>`
+	}
+	const choice = `<choiceInteraction responseIdentifier="RESPONSE" maxChoices="1"><prompt>Вопрос</prompt>
+		<simpleChoice identifier="A">да</simpleChoice><simpleChoice identifier="B">нет</simpleChoice></choiceInteraction>`
+	tests := []struct {
+		name  string
+		data  []byte
+		want  []models.BundleQuestion
+		isErr bool
+	}{
+		{"not a zip", []byte("<quiz/>"), nil, true},
+		{"no manifest", qtiZip(t, map[string]string{"q1.xml": item(choice, "")}), nil, true},
+		{"missing item file", qtiZip(t, map[string]string{"imsmanifest.xml": manifest}), nil, true},
+		{"no supported interaction", qtiZip(t, map[string]string{"imsmanifest.xml": manifest,
+			"q1.xml": item(`<p>Текст</p><uploadInteraction responseIdentifier="RESPONSE"/>`, "")}), nil, true},
+		{"key is not a choice", qtiZip(t, map[string]string{"imsmanifest.xml": manifest,
+			"q1.xml": item(choice, `<responseDeclaration identifier="RESPONSE" cardinality="single" baseType="identifier">
+				<correctResponse><value>C</value></correctResponse></responseDeclaration>`)}), nil, true},
+		{"items without a test", qtiZip(t, map[string]string{"imsmanifest.xml": manifest,
+			"q1.xml": item(choice, `<responseDeclaration identifier="RESPONSE" cardinality="single" baseType="identifier">
+				<correctResponse><value>B</value></correctResponse></responseDeclaration>`)}), []models.BundleQuestion{{
+			ID: 1, Type: models.QuestionSingle, Text: "Вопрос", Options: []string{"да", "нет"},
+			CorrectAnswer: mustJSON(1), Tags: []string{}, InTest: true, Points: 1,
+		}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readQTIPackage(tt.data)
+			if (err != nil) != tt.isErr {
+				t.Fatalf("err = %v, want error %v", err, tt.isErr)
+			}
+			if tt.isErr {
+				return
+			}
+			gotJSON, _ := json.Marshal(got.Questions)
+			wantJSON, _ := json.Marshal(tt.want)
+			if !bytes.Equal(gotJSON, wantJSON) {
+				t.Fatalf("questions %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
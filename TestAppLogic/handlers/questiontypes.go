@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"testapplogic/models"
+)
+
+// maxTextAnswerLength ограничивает длину текстового ответа в байтах
+const maxTextAnswerLength = 4000
+
+// trueFalseOptions — варианты по умолчанию для вопросов «верно/неверно»
+var trueFalseOptions = []string{"Верно", "Неверно"}
+
+// validQuestionType проверяет, что тип вопроса поддерживается в тесте данного вида
+func validQuestionType(t, kind string) bool {
+	if kind == models.TestKindSurvey {
+		switch t {
+		case models.QuestionSingle, models.QuestionMultiple, models.QuestionNumeric,
+			models.QuestionLikert, models.QuestionFreeText:
+			return true
+		}
+		return false
+	}
+	switch t {
+	case models.QuestionSingle, models.QuestionMultiple, models.QuestionTrueFalse,
+		models.QuestionNumeric, models.QuestionText, models.QuestionOrdering, models.QuestionMatching:
+		return true
+	}
+	return false
+}
+
+// validateQuestion проверяет вопрос по правилам его типа и приводит ключ к канонической форме.
+// kind — вид теста: у вопросов опроса ключа быть не должно
+func validateQuestion(q *models.Question, kind string) error {
+	if q.Type == "" {
+		q.Type = models.QuestionSingle
+	}
+	if !validQuestionType(q.Type, kind) {
+		return invalidField("type", "Unknown question type")
+	}
+	if strings.TrimSpace(q.Text) == "" {
+		return invalidField("text", "Text is required")
+	}
+	if kind == models.TestKindSurvey {
+		return validateSurveyQuestion(q)
+	}
+	if len(q.CorrectAnswer) == 0 || string(q.CorrectAnswer) == "null" {
+		return invalidField("correct_answer", "correct_answer is required")
+	}
+	switch q.Type {
+	case models.QuestionSingle:
+		if len(q.Options) < 2 {
+			return invalidField("options", "Text and at least 2 options are required")
+		}
+		var idx int
+		if err := json.Unmarshal(q.CorrectAnswer, &idx); err != nil {
+			return invalidField("correct_answer", "correct_answer must be an option index")
+		}
+		if idx < 0 || idx >= len(q.Options) {
+			return invalidField("correct_answer", "Correct answer index out of range")
+		}
+		q.CorrectAnswer = mustJSON(idx)
+	case models.QuestionMultiple:
+		if len(q.Options) < 2 {
+			return invalidField("options", "Text and at least 2 options are required")
+		}
+		var idx []int
+		if err := json.Unmarshal(q.CorrectAnswer, &idx); err != nil || len(idx) == 0 {
+			return invalidField("correct_answer", "correct_answer must be a non-empty list of option indexes")
+		}
+		idx, ok := uniqueIndexes(idx, len(q.Options))
+		if !ok {
+			return invalidField("correct_answer", "Correct answer index out of range")
+		}
+		q.CorrectAnswer = mustJSON(idx)
+	case models.QuestionTrueFalse:
+		// Ответ хранится как true/false, а бот присылает номер варианта, где 0 — «Верно».
+		// Свои подписи могли бы стоять в другом порядке, поэтому варианты всегда стандартные
+		if len(q.Options) != 0 && !equalStrings(q.Options, trueFalseOptions) {
+			return invalidField("options", "true_false question options are fixed; omit options")
+		}
+		q.Options = trueFalseOptions
+		var value bool
+		if err := json.Unmarshal(q.CorrectAnswer, &value); err != nil {
+			return invalidField("correct_answer", "correct_answer must be true or false")
+		}
+		q.CorrectAnswer = mustJSON(value)
+	case models.QuestionNumeric:
+		var input struct {
+			Value     *float64 `json:"value"`
+			Tolerance float64  `json:"tolerance"`
+		}
+		if err := decodeStrict(q.CorrectAnswer, &input); err != nil || input.Value == nil {
+			return invalidField("correct_answer", "correct_answer must be {\"value\": number, \"tolerance\": number}")
+		}
+		key := models.NumericKey{Value: *input.Value, Tolerance: input.Tolerance}
+		if key.Tolerance < 0 {
+			return invalidField("correct_answer", "tolerance must not be negative")
+		}
+		q.Options = []string{}
+		q.CorrectAnswer = mustJSON(key)
+	case models.QuestionText:
+		var key models.TextKey
+		if err := decodeStrict(q.CorrectAnswer, &key); err != nil {
+			return invalidField("correct_answer", "correct_answer must be {\"accepted\": [...], \"pattern\": \"...\"}")
+		}
+		accepted := key.Accepted[:0]
+		for _, a := range key.Accepted {
+			if a = strings.TrimSpace(a); a != "" {
+				accepted = append(accepted, a)
+			}
+		}
+		key.Accepted = accepted
+		if len(key.Accepted) == 0 && key.Pattern == "" {
+			return invalidField("correct_answer", "text question needs accepted answers or a pattern")
+		}
+		if key.Pattern != "" {
+			if _, err := regexp.Compile(key.Pattern); err != nil {
+				return invalidField("correct_answer", "pattern is not a valid regular expression")
+			}
+		}
+		q.Options = []string{}
+		q.CorrectAnswer = mustJSON(key)
+	case models.QuestionOrdering:
+		if len(q.Options) < 2 {
+			return invalidField("options", "Text and at least 2 options are required")
+		}
+		var order []int
+		if err := json.Unmarshal(q.CorrectAnswer, &order); err != nil || !isPermutation(order, len(q.Options)) {
+			return invalidField("correct_answer", "correct_answer must be a permutation of option indexes")
+		}
+		q.CorrectAnswer = mustJSON(order)
+	case models.QuestionMatching:
+		if len(q.Options) < 2 || len(q.Matches) < 2 {
+			return invalidField("options", "matching question needs at least 2 options and 2 matches")
+		}
+		var pairs []int
+		if err := json.Unmarshal(q.CorrectAnswer, &pairs); err != nil || len(pairs) != len(q.Options) {
+			return invalidField("correct_answer", "correct_answer must contain a match index for every option")
+		}
+		for _, p := range pairs {
+			if p < 0 || p >= len(q.Matches) {
+				return invalidField("correct_answer", "Correct answer index out of range")
+			}
+		}
+		q.CorrectAnswer = mustJSON(pairs)
+	}
+	if q.Type != models.QuestionMatching {
+		q.Matches = []string{}
+	}
+	return nil
+}
+
+// validateSurveyQuestion проверяет вопрос опроса: варианты есть у всех типов,
+// кроме числового и свободного ответа, а ключ всегда пустой
+func validateSurveyQuestion(q *models.Question) error {
+	if len(q.CorrectAnswer) > 0 && string(q.CorrectAnswer) != "null" {
+		return invalidField("correct_answer", "survey questions must not have correct_answer")
+	}
+	q.CorrectAnswer = nil
+	q.Matches = []string{}
+	switch q.Type {
+	case models.QuestionNumeric, models.QuestionFreeText:
+		q.Options = []string{}
+	default:
+		if len(q.Options) < 2 {
+			return invalidField("options", "Text and at least 2 options are required")
+		}
+	}
+	return nil
+}
+
+// normalizeAnswer проверяет ответ студента по типу вопроса и возвращает его каноническую форму
+func normalizeAnswer(q models.Question, raw json.RawMessage) (json.RawMessage, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, errors.New("answer is required")
+	}
+	switch q.Type {
+	case models.QuestionSingle, models.QuestionLikert:
+		var idx int
+		if err := json.Unmarshal(raw, &idx); err != nil || idx < 0 || idx >= len(q.Options) {
+			return nil, errors.New("answer must be an option index")
+		}
+		return mustJSON(idx), nil
+	case models.QuestionMultiple:
+		var idx []int
+		if err := json.Unmarshal(raw, &idx); err != nil {
+			return nil, errors.New("answer must be a list of option indexes")
+		}
+		idx, ok := uniqueIndexes(idx, len(q.Options))
+		if !ok {
+			return nil, errors.New("answer index out of range")
+		}
+		return mustJSON(idx), nil
+	case models.QuestionTrueFalse:
+		// Бот присылает номер варианта: 0 — первый вариант («Верно»), 1 — второй
+		var value bool
+		if err := json.Unmarshal(raw, &value); err != nil {
+			var idx int
+			if err := json.Unmarshal(raw, &idx); err != nil || (idx != 0 && idx != 1) {
+				return nil, errors.New("answer must be true, false, 0 or 1")
+			}
+			value = idx == 0
+		}
+		return mustJSON(value), nil
+	case models.QuestionNumeric:
+		var value float64
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, errors.New("answer must be a number")
+		}
+		return mustJSON(value), nil
+	case models.QuestionText, models.QuestionFreeText:
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, errors.New("answer must be a string")
+		}
+		value = strings.TrimSpace(value)
+		if len(value) > maxTextAnswerLength {
+			return nil, errors.New("answer is too long")
+		}
+		return mustJSON(value), nil
+	case models.QuestionOrdering:
+		var order []int
+		if err := json.Unmarshal(raw, &order); err != nil || !isPermutation(order, len(q.Options)) {
+			return nil, errors.New("answer must be a permutation of option indexes")
+		}
+		return mustJSON(order), nil
+	case models.QuestionMatching:
+		var pairs []int
+		if err := json.Unmarshal(raw, &pairs); err != nil || len(pairs) != len(q.Options) {
+			return nil, errors.New("answer must contain a match index for every option")
+		}
+		for _, p := range pairs {
+			if p < 0 || p >= len(q.Matches) {
+				return nil, errors.New("answer index out of range")
+			}
+		}
+		return mustJSON(pairs), nil
+	}
+	return nil, errors.New("Unknown question type")
+}
+
+// checkAnswer сравнивает нормализованный ответ с ключом вопроса
+func checkAnswer(q models.Question, answer json.RawMessage) bool {
+	if len(answer) == 0 || string(answer) == "null" || len(q.CorrectAnswer) == 0 {
+		return false
+	}
+	switch q.Type {
+	case models.QuestionNumeric:
+		var key models.NumericKey
+		var value float64
+		if json.Unmarshal(q.CorrectAnswer, &key) != nil || json.Unmarshal(answer, &value) != nil {
+			return false
+		}
+		return math.Abs(value-key.Value) <= key.Tolerance+1e-9
+	case models.QuestionText:
+		var key models.TextKey
+		var value string
+		if json.Unmarshal(q.CorrectAnswer, &key) != nil || json.Unmarshal(answer, &value) != nil {
+			return false
+		}
+		return matchText(key, value)
+	}
+	// Для остальных типов ключ и ответ хранятся в одной канонической форме
+	return bytes.Equal(compactJSON(q.CorrectAnswer), compactJSON(answer))
+}
+
+// matchText проверяет текстовый ответ по списку допустимых ответов и регулярному выражению
+func matchText(key models.TextKey, value string) bool {
+	value = strings.TrimSpace(value)
+	for _, a := range key.Accepted {
+		if key.CaseSensitive && a == value || !key.CaseSensitive && strings.EqualFold(a, value) {
+			return true
+		}
+	}
+	if key.Pattern == "" {
+		return false
+	}
+	// Шаблон должен совпасть со всем ответом, а не с его частью: иначе ключ 4 примет и 42
+	pattern := "^(?:" + key.Pattern + ")$"
+	if !key.CaseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	return err == nil && re.MatchString(value)
+}
+
+// equalStrings сравнивает два списка строк
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// uniqueIndexes сортирует индексы, убирает повторы и проверяет диапазон
+func uniqueIndexes(idx []int, n int) ([]int, bool) {
+	sort.Ints(idx)
+	out := make([]int, 0, len(idx))
+	for i, v := range idx {
+		if v < 0 || v >= n {
+			return nil, false
+		}
+		if i == 0 || v != idx[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out, true
+}
+
+// isPermutation проверяет, что order — перестановка чисел 0..n-1
+func isPermutation(order []int, n int) bool {
+	if len(order) != n {
+		return false
+	}
+	seen := make([]bool, n)
+	for _, v := range order {
+		if v < 0 || v >= n || seen[v] {
+			return false
+		}
+		seen[v] = true
+	}
+	return true
+}
+
+// decodeStrict декодирует JSON-объект, запрещая неизвестные поля
+func decodeStrict(raw json.RawMessage, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// mustJSON сериализует значение, которое заведомо сериализуется без ошибок
+func mustJSON(v interface{}) json.RawMessage {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+// compactJSON убирает пробелы из JSON, чтобы сравнивать значения побайтно
+func compactJSON(raw json.RawMessage) []byte {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return raw
+	}
+	return buf.Bytes()
+}
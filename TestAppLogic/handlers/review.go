@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"testapplogic/models"
+	"testapplogic/store"
+
+	"github.com/gorilla/mux"
+)
+
+// studentQuestion строит представление вопроса без правильного ответа.
+// При shuffle варианты перемешиваются детерминированно для пары (пользователь, вопрос),
+// а исходные индексы возвращаются в OptionIDs
+func studentQuestion(q models.Question, shuffle bool, userID int) models.StudentQuestion {
+	sq := models.StudentQuestion{
+		ID:      q.ID,
+		TestID:  q.TestID,
+		Type:    q.Type,
+		Text:    q.Text,
+		Options: q.Options,
+		Matches: q.Matches,
+	}
+	// Порядок вариантов «верно/неверно» не перемешиваем
+	if !shuffle || q.Type == models.QuestionTrueFalse {
+		return sq
+	}
+	rng := rand.New(rand.NewSource(int64(userID)<<32 | int64(q.ID)))
+	order := rng.Perm(len(q.Options))
+	sq.Options = make([]string, len(order))
+	for i, idx := range order {
+		sq.Options[i] = q.Options[idx]
+	}
+	sq.OptionIDs = order
+	return sq
+}
+
+// EnableReview разрешает студентам просматривать правильные ответы после завершения попытки
+func (h *DBHandler) EnableReview(w http.ResponseWriter, r *http.Request) {
+	h.setReview(w, r, true)
+}
+
+// DisableReview запрещает студентам просматривать правильные ответы
+func (h *DBHandler) DisableReview(w http.ResponseWriter, r *http.Request) {
+	h.setReview(w, r, false)
+}
+
+// setReview переключает режим разбора для теста; это настройка теста, поэтому
+// права те же, что у PUT /tests/{id}
+func (h *DBHandler) setReview(w http.ResponseWriter, r *http.Request, allow bool) {
+	t, ok := h.testForLifecycle(w, r, "course:test:write")
+	if !ok {
+		return
+	}
+	testID := t.ID
+	if err := h.Store.SetTestReview(testID, allow); err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	message := "Review disabled"
+	if allow {
+		message = "Review enabled"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": message,
+		"id":      testID,
+	})
+}
+
+// GetAttemptReview возвращает разбор завершённой попытки с правильными ответами.
+// Студенту он доступен только если преподаватель включил разбор для теста
+func (h *DBHandler) GetAttemptReview(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	attemptID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid attempt ID")
+		return
+	}
+	userID, ok := GetUserID(r)
+	if !ok {
+		WriteError(w, r, http.StatusUnauthorized, CodeUnauthorized, "User not authenticated")
+		return
+	}
+	a, t, err := attemptTest(h.Store, attemptID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Attempt not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	isAuthor := CheckAuthorAccess(h.Store, r, t.CourseID)
+	if a.UserID != userID && !isAuthor {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+		return
+	}
+	if !a.Finished {
+		WriteError(w, r, http.StatusBadRequest, CodeAttemptNotFinished, "Attempt is not finished yet")
+		return
+	}
+	if t.Kind == models.TestKindSurvey {
+		WriteError(w, r, http.StatusBadRequest, CodeSurveyNotGraded, "Survey responses have no answer key")
+		return
+	}
+	if !t.AllowReview && !isAuthor {
+		WriteError(w, r, http.StatusForbidden, CodeReviewDisabled, "Review is not allowed for this test")
+		return
+	}
+	g := gradedFrom(a)
+	review := models.AttemptReview{AttemptID: attemptID, TestID: a.TestID, Score: g.Score, MaxScore: g.MaxScore, Percentage: g.Percentage}
+	paper, err := h.Store.AttemptPaper(attemptID)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	answers, err := h.Store.AttemptAnswers(attemptID)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	byQuestion := make(map[int]models.Answer, len(answers))
+	for _, ans := range answers {
+		byQuestion[ans.QuestionID] = ans
+	}
+	for _, p := range paper {
+		q := p.Question
+		rq := models.ReviewQuestion{
+			QuestionID:    q.ID,
+			Type:          q.Type,
+			Text:          q.Text,
+			Options:       q.Options,
+			Matches:       q.Matches,
+			CorrectAnswer: q.CorrectAnswer,
+			MaxPoints:     q.Points,
+		}
+		if ans, ok := byQuestion[q.ID]; ok {
+			rq.Answer = ans.Answer
+			rq.Correct = ans.IsCorrect != nil && *ans.IsCorrect
+		}
+		if rq.Correct {
+			rq.Points = rq.MaxPoints
+		}
+		review.Questions = append(review.Questions, rq)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
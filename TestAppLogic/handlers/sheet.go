@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Форматы выгрузки таблиц
+const (
+	formatCSV  = "csv"
+	formatXLSX = "xlsx"
+)
+
+// sheetWriter построчно записывает таблицу прямо в ответ, не собирая её в памяти.
+// Ячейки — string, int, float64, *float64, bool, time.Time, *time.Time или nil
+type sheetWriter interface {
+	WriteRow(cells ...interface{}) error
+	Close() error
+}
+
+// newSheetWriter выставляет заголовки ответа и создаёт запись таблицы в нужном формате.
+// filename указывается без расширения
+func newSheetWriter(w http.ResponseWriter, format, filename string) (sheetWriter, error) {
+	switch format {
+	case "", formatCSV:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, filename))
+		// BOM нужен, чтобы Excel открыл UTF-8 с кириллицей без искажений
+		if _, err := io.WriteString(w, "\ufeff"); err != nil {
+			return nil, err
+		}
+		return &csvSheet{w: csv.NewWriter(w), flusher: flusherOf(w)}, nil
+	case formatXLSX:
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.xlsx"`, filename))
+		return newXLSXSheet(w)
+	}
+	return nil, errors.New("format must be csv or xlsx")
+}
+
+// flusherOf возвращает http.Flusher ответа, если он поддерживается
+func flusherOf(w io.Writer) http.Flusher {
+	f, _ := w.(http.Flusher)
+	return f
+}
+
+// sheetFlushRows — через сколько строк буфер отправляется клиенту
+const sheetFlushRows = 500
+
+// csvSheet пишет таблицу в CSV
+type csvSheet struct {
+	w       *csv.Writer
+	flusher http.Flusher
+	rows    int
+}
+
+// WriteRow реализует sheetWriter
+func (s *csvSheet) WriteRow(cells ...interface{}) error {
+	record := make([]string, len(cells))
+	for i, c := range cells {
+		record[i] = cellText(c)
+		if text, ok := c.(string); ok {
+			record[i] = csvSafe(text)
+		}
+	}
+	if err := s.w.Write(record); err != nil {
+		return err
+	}
+	s.rows++
+	if s.rows%sheetFlushRows == 0 {
+		s.w.Flush()
+		if s.flusher != nil {
+			s.flusher.Flush()
+		}
+	}
+	return s.w.Error()
+}
+
+// csvSafe экранирует текст, который Excel выполнил бы как формулу: ячейка,
+// начинающаяся с =, +, -, @, табуляции или перевода строки, получает префикс '.
+// Числа сюда не попадают, поэтому отрицательные значения остаются числами
+func csvSafe(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+// Close реализует sheetWriter
+func (s *csvSheet) Close() error {
+	s.w.Flush()
+	return s.w.Error()
+}
+
+// cellText форматирует ячейку как текст
+func cellText(c interface{}) string {
+	switch v := c.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case *float64:
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return v.Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprint(c)
+}
+
+// Служебные части XLSX-файла с единственным листом
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`
+	xlsxSheetHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetFooter = `</sheetData></worksheet>`
+)
+
+// xlsxSheet пишет таблицу в XLSX. ZIP-архив пишется последовательно,
+// поэтому лист можно отдавать клиенту по мере чтения строк из базы
+type xlsxSheet struct {
+	zip     *zip.Writer
+	sheet   *bufio.Writer
+	flusher http.Flusher
+	rows    int
+}
+
+// newXLSXSheet записывает служебные части книги и открывает лист для записи строк
+func newXLSXSheet(w io.Writer) (*xlsxSheet, error) {
+	zw := zip.NewWriter(w)
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, p := range parts {
+		f, err := zw.Create(p.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, p.body); err != nil {
+			return nil, err
+		}
+	}
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	s := &xlsxSheet{zip: zw, sheet: bufio.NewWriter(f), flusher: flusherOf(w)}
+	_, err = s.sheet.WriteString(xlsxSheetHeader)
+	return s, err
+}
+
+// WriteRow реализует sheetWriter
+func (s *xlsxSheet) WriteRow(cells ...interface{}) error {
+	s.rows++
+	fmt.Fprintf(s.sheet, `<row r="%d">`, s.rows)
+	for i, c := range cells {
+		ref := xlsxColumn(i) + strconv.Itoa(s.rows)
+		switch v := c.(type) {
+		case nil:
+			continue
+		case int:
+			fmt.Fprintf(s.sheet, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case float64:
+			fmt.Fprintf(s.sheet, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+		case *float64:
+			if v != nil {
+				fmt.Fprintf(s.sheet, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(*v, 'f', -1, 64))
+			}
+		case bool:
+			b := 0
+			if v {
+				b = 1
+			}
+			fmt.Fprintf(s.sheet, `<c r="%s" t="b"><v>%d</v></c>`, ref, b)
+		default:
+			text := cellText(c)
+			if text == "" {
+				continue
+			}
+			fmt.Fprintf(s.sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			if err := xml.EscapeText(s.sheet, []byte(text)); err != nil {
+				return err
+			}
+			s.sheet.WriteString(`</t></is></c>`)
+		}
+	}
+	_, err := s.sheet.WriteString(`</row>`)
+	if err == nil && s.rows%sheetFlushRows == 0 {
+		if err = s.sheet.Flush(); err == nil {
+			err = s.zip.Flush()
+		}
+		if err == nil && s.flusher != nil {
+			s.flusher.Flush()
+		}
+	}
+	return err
+}
+
+// Close реализует sheetWriter
+func (s *xlsxSheet) Close() error {
+	if _, err := s.sheet.WriteString(xlsxSheetFooter); err != nil {
+		return err
+	}
+	if err := s.sheet.Flush(); err != nil {
+		return err
+	}
+	return s.zip.Close()
+}
+
+// xlsxColumn возвращает буквенное обозначение столбца: 0 — A, 25 — Z, 26 — AA
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
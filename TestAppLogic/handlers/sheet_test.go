@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSVSheet(t *testing.T) {
+	w := httptest.NewRecorder()
+	sheet, err := newSheetWriter(w, formatCSV, "attempts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	score := 7.5
+	at := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	sheet.WriteRow("Студент", "Балл", "Сдано", "Время")
+	sheet.WriteRow("=HYPERLINK(\"x\")", &score, true, &at)
+	sheet.WriteRow("Иванов, И.", -2, nil, (*time.Time)(nil))
+	if err := sheet.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="attempts.csv"` {
+		t.Fatalf("Content-Disposition %q", got)
+	}
+	want := "\ufeffСтудент,Балл,Сдано,Время\n" +
+		"\"'=HYPERLINK(\"\"x\"\")\",7.5,true,2024-03-01 09:30:00\n" +
+		"\"Иванов, И.\",-2,,\n"
+	if got := w.Body.String(); got != want {
+		t.Fatalf("CSV\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestCSVSafe(t *testing.T) {
+	tests := []struct{ text, want string }{
+		{"", ""},
+		{"Иванов", "Иванов"},
+		{"=1+1", "'=1+1"},
+		{"+7 999", "'+7 999"},
+		{"-5", "'-5"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tтаб", "'\tтаб"},
+		{"a=b", "a=b"},
+	}
+	for _, tt := range tests {
+		if got := csvSafe(tt.text); got != tt.want {
+			t.Errorf("csvSafe(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	tests := []struct {
+		i    int
+		want string
+	}{
+		{0, "A"}, {25, "Z"}, {26, "AA"}, {51, "AZ"}, {52, "BA"}, {701, "ZZ"}, {702, "AAA"},
+	}
+	for _, tt := range tests {
+		if got := xlsxColumn(tt.i); got != tt.want {
+			t.Errorf("xlsxColumn(%d) = %q, want %q", tt.i, got, tt.want)
+		}
+	}
+}
+
+func TestXLSXSheet(t *testing.T) {
+	var buf bytes.Buffer
+	sheet, err := newXLSXSheet(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet.WriteRow("Имя", "Балл")
+	sheet.WriteRow("A & B", 3, nil, 1.5, false)
+	if err := sheet.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(data)
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels"} {
+		if _, ok := parts[name]; !ok {
+			t.Fatalf("workbook has no %s", name)
+		}
+	}
+	rows := `<row r="1"><c r="A1" t="inlineStr"><is><t xml:space="preserve">Имя</t></is></c>` +
+		`<c r="B1" t="inlineStr"><is><t xml:space="preserve">Балл</t></is></c></row>` +
+		`<row r="2"><c r="A2" t="inlineStr"><is><t xml:space="preserve">A &amp; B</t></is></c>` +
+		`<c r="B2"><v>3</v></c><c r="D2"><v>1.5</v></c><c r="E2" t="b"><v>0</v></c></row>`
+	if got := parts["xl/worksheets/sheet1.xml"]; !strings.Contains(got, "<sheetData>"+rows+"</sheetData>") {
+		t.Fatalf("sheet\n%s\nwant rows\n%s", got, rows)
+	}
+}
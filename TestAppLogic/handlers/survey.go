@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"testapplogic/models"
+	"testapplogic/store"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// finishSurvey завершает попытку опроса и фиксирует участника.
+// В анонимном опросе попытка отвязывается от пользователя, а все отметки времени
+// огрубляются до дня, так что по времени ответы с участником не сопоставить.
+// Остаётся утечка через порядок: ID попыток и ответов выдаются последовательно,
+// и при доступе к БД их можно соотнести с порядком участников, если опрос за день
+// прошли немногие
+func finishSurvey(s store.Store, a models.Attempt, t models.Test) error {
+	now := time.Now()
+	participatedAt := now
+	if t.Anonymous {
+		participatedAt = now.Truncate(24 * time.Hour)
+	}
+	if err := s.AddSurveyParticipant(t.ID, a.UserID, participatedAt); err != nil {
+		return err
+	}
+	if t.Anonymous {
+		return s.FinishAnonymousAttempt(a.ID)
+	}
+	return s.FinishAttempt(a.ID, now)
+}
+
+// GetSurveyResults возвращает сводные результаты опроса: распределения по вариантам,
+// средние значения для шкал и чисел и списки свободных ответов
+func (h *DBHandler) GetSurveyResults(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid test ID")
+		return
+	}
+	t, err := h.Store.Test(testID)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Test not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	if !CheckCourseAccess(h.Store, r, t.CourseID) {
+		WriteError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
+		return
+	}
+	if t.Kind != models.TestKindSurvey {
+		WriteError(w, r, http.StatusBadRequest, CodeNotSurvey, "Test is not a survey")
+		return
+	}
+	questions, err := h.Store.PresentedQuestions(testID)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	// Ответы всех завершённых попыток
+	attempts, err := h.Store.FinishedAttempts(testID)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	results := models.SurveyResults{TestID: testID, Anonymous: t.Anonymous, Responses: len(attempts)}
+	answers := make(map[int][]json.RawMessage)
+	for _, a := range attempts {
+		for _, ans := range a.Answers {
+			answers[ans.QuestionID] = append(answers[ans.QuestionID], ans.Answer)
+		}
+	}
+	results.Questions = make([]models.SurveyQuestion, 0, len(questions))
+	for _, q := range questions {
+		results.Questions = append(results.Questions, summarizeSurveyQuestion(q, answers[q.ID]))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// summarizeSurveyQuestion считает сводку ответов на вопрос опроса
+func summarizeSurveyQuestion(q models.Question, answers []json.RawMessage) models.SurveyQuestion {
+	sq := models.SurveyQuestion{
+		QuestionID: q.ID,
+		Type:       q.Type,
+		Text:       q.Text,
+		Responses:  len(answers),
+	}
+	counts := make([]int, len(q.Options))
+	var sum float64
+	var numbers int
+	for _, raw := range answers {
+		switch q.Type {
+		case models.QuestionSingle, models.QuestionLikert:
+			var idx int
+			if json.Unmarshal(raw, &idx) == nil && idx >= 0 && idx < len(counts) {
+				counts[idx]++
+				// Значение шкалы Лайкерта считается с единицы
+				sum += float64(idx + 1)
+				numbers++
+			}
+		case models.QuestionMultiple:
+			var idx []int
+			if json.Unmarshal(raw, &idx) == nil {
+				for _, i := range idx {
+					if i >= 0 && i < len(counts) {
+						counts[i]++
+					}
+				}
+			}
+		case models.QuestionNumeric:
+			var value float64
+			if json.Unmarshal(raw, &value) == nil {
+				sum += value
+				numbers++
+			}
+		case models.QuestionFreeText:
+			var text string
+			if json.Unmarshal(raw, &text) == nil && text != "" {
+				sq.Texts = append(sq.Texts, text)
+			}
+		}
+	}
+	for i, option := range q.Options {
+		sq.Distribution = append(sq.Distribution, models.OptionCount{
+			Option:     option,
+			Count:      counts[i],
+			Percentage: percentage(float64(counts[i]), float64(len(answers))),
+		})
+	}
+	if (q.Type == models.QuestionLikert || q.Type == models.QuestionNumeric) && numbers > 0 {
+		avg := sum / float64(numbers)
+		sq.Average = &avg
+	}
+	// Порядок свободных ответов не должен выдавать порядок прохождения
+	sort.Strings(sq.Texts)
+	return sq
+}
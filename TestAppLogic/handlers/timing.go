@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"testapplogic/store"
+	"time"
+)
+
+// validateSchedule проверяет ограничение по времени и окно доступности теста
+func validateSchedule(timeLimit *int, opensAt, closesAt *time.Time) error {
+	if timeLimit != nil && *timeLimit <= 0 {
+		return invalidField("time_limit_seconds", "time_limit_seconds must be positive")
+	}
+	if opensAt != nil && closesAt != nil && !closesAt.After(*opensAt) {
+		return invalidField("closes_at", "closes_at must be after opens_at")
+	}
+	return nil
+}
+
+// attemptExpiry вычисляет срок окончания попытки: время начала плюс ограничение,
+// но не позже закрытия теста. nil — попытка не ограничена по времени
+func attemptExpiry(start time.Time, timeLimit *int, closesAt *time.Time) *time.Time {
+	var expiresAt *time.Time
+	if timeLimit != nil {
+		t := start.Add(time.Duration(*timeLimit) * time.Second)
+		expiresAt = &t
+	}
+	if closesAt != nil && (expiresAt == nil || closesAt.Before(*expiresAt)) {
+		t := *closesAt
+		expiresAt = &t
+	}
+	return expiresAt
+}
+
+// attemptExpired проверяет, истекло ли время попытки
+func attemptExpired(expiresAt *time.Time, now time.Time) bool {
+	return expiresAt != nil && !now.Before(*expiresAt)
+}
+
+// UpdateTestSchedule задаёт ограничение по времени и окно доступности теста.
+// Поля, переданные как null или не переданные, снимают соответствующее ограничение
+func (h *DBHandler) UpdateTestSchedule(w http.ResponseWriter, r *http.Request) {
+	// Права те же, что у PUT /tests/{id}, который меняет эти же поля
+	t, ok := h.testForLifecycle(w, r, "course:test:write")
+	if !ok {
+		return
+	}
+	testID := t.ID
+	var input struct {
+		TimeLimit *int       `json:"time_limit_seconds"`
+		OpensAt   *time.Time `json:"opens_at"`
+		ClosesAt  *time.Time `json:"closes_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if err := validateSchedule(input.TimeLimit, input.OpensAt, input.ClosesAt); err != nil {
+		writeInvalid(w, r, err)
+		return
+	}
+	err := h.Store.SetTestSchedule(testID, input.TimeLimit, input.OpensAt, input.ClosesAt)
+	if err == store.ErrNotFound {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Test not found")
+		return
+	} else if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Database error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":            "Schedule updated",
+		"id":                 testID,
+		"time_limit_seconds": input.TimeLimit,
+		"opens_at":           input.OpensAt,
+		"closes_at":          input.ClosesAt,
+	})
+}
+
+// StartAttemptSweeper запускает фоновую проверку просроченных попыток:
+// раз в interval они завершаются и оцениваются. Останавливается при отмене ctx
+func StartAttemptSweeper(ctx context.Context, s store.Store, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n, err := sweepExpiredAttempts(s, time.Now())
+				if err != nil {
+					log.Printf("Attempt sweeper error: %v", err)
+				} else if n > 0 {
+					log.Printf("Attempt sweeper completed %d expired attempts", n)
+				}
+			}
+		}
+	}()
+}
+
+// sweepExpiredAttempts завершает все просроченные попытки и возвращает их число.
+// Каждая попытка обрабатывается в своей транзакции; ExpiredAttempt не даёт двум
+// репликам сервиса или параллельному CompleteAttempt обработать одну попытку дважды.
+// Попытка, которую не удалось оценить, записывается в лог и пропускается до конца
+// прохода, чтобы не задерживать остальные; следующий проход попробует её снова
+func sweepExpiredAttempts(s store.Store, now time.Time) (int, error) {
+	completed := 0
+	failed := []int{}
+	for {
+		attemptID, err := sweepOneAttempt(s, now, failed)
+		if attemptID == 0 && err != nil {
+			return completed, err
+		}
+		if attemptID == 0 {
+			return completed, nil
+		}
+		if err != nil {
+			log.Printf("Attempt sweeper: failed to complete attempt %d: %v", attemptID, err)
+			failed = append(failed, attemptID)
+			continue
+		}
+		completed++
+	}
+}
+
+// sweepOneAttempt завершает одну просроченную попытку, кроме попыток из skip, и возвращает
+// её ID; 0 — таких попыток больше нет. Ошибка при ненулевом ID относится к самой попытке
+func sweepOneAttempt(s store.Store, now time.Time, skip []int) (int, error) {
+	tx, err := s.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	attemptID, err := tx.ExpiredAttempt(now, skip)
+	if attemptID == 0 || err != nil {
+		return 0, err
+	}
+	if _, err := completeAttempt(tx, attemptID); err != nil {
+		return attemptID, err
+	}
+	return attemptID, tx.Commit()
+}
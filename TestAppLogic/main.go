@@ -1,13 +1,14 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"log"
 	"net/http"
 	"os"
 	"testapplogic/config"
 	"testapplogic/db"
 	"testapplogic/handlers"
+	"testapplogic/store"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
@@ -30,49 +31,116 @@ func main() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer database.Close()
+	// Подкоманда migrate управляет схемой и не запускает сервер
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(database, os.Args[2:])
+		return
+	}
+	// Приводим схему к версии сборки; при расхождении с применёнными миграциями не стартуем
+	if _, err := db.MigrateUp(database); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
 	// Инициализируем JWT-секрет
 	handlers.InitAuth(cfg.JWTSecret)
+	// Хранилище поверх PostgreSQL, общее для всех обработчиков
+	st := store.NewPostgres(database)
+	h := &handlers.DBHandler{Store: st}
+	// Фоновое завершение попыток с истёкшим временем
+	handlers.StartAttemptSweeper(context.Background(), st, cfg.SweepInterval)
 	// Создаём роутер
 	router := mux.NewRouter()
+	// Идентификатор запроса для логов и ответов с ошибкой
+	router.Use(handlers.RequestIDMiddleware)
 	// Логирование всех входящих запросов
 	router.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			log.Printf("%s %s %s", r.Method, r.RequestURI, r.RemoteAddr)
+			log.Printf("%s %s %s %s", r.Method, r.RequestURI, r.RemoteAddr, handlers.GetRequestID(r))
 			next.ServeHTTP(w, r)
 		})
 	})
 	// Общие маршруты API
 	api := router.PathPrefix("/api").Subrouter()
 	// Публичный маршрут для проверки работоспособности
-	api.HandleFunc("/health", (&handlers.DBHandler{DB: database}).HealthCheck).Methods("GET")
+	api.HandleFunc("/health", h.HealthCheck).Methods("GET")
 	// Маршруты, требующие авторизации
 	auth := api.PathPrefix("").Subrouter()
-	auth.Use(handlers.AuthMiddleware(database))
+	auth.Use(handlers.AuthMiddleware(st))
 	// Курсы
-	auth.HandleFunc("/courses", (&handlers.DBHandler{DB: database}).GetCourses).Methods("GET")
-	auth.HandleFunc("/courses/{id}", (&handlers.DBHandler{DB: database}).GetCourse).Methods("GET")
-	auth.HandleFunc("/courses", (&handlers.DBHandler{DB: database}).CreateCourse).Methods("POST")
+	auth.HandleFunc("/courses", h.GetCourses).Methods("GET")
+	auth.HandleFunc("/courses/{id}", h.GetCourse).Methods("GET")
+	auth.HandleFunc("/courses/{id}", h.UpdateCourse).Methods("PUT")
+	auth.HandleFunc("/courses/{id}", h.PatchCourse).Methods("PATCH")
+	auth.HandleFunc("/courses/{id}", h.DeleteCourse).Methods("DELETE")
+	auth.HandleFunc("/courses/{id}/restore", h.RestoreCourse).Methods("POST")
+	auth.HandleFunc("/courses", h.CreateCourse).Methods("POST")
+	auth.HandleFunc("/courses/join", h.JoinCourse).Methods("POST")
+	// Участники курсов
+	auth.HandleFunc("/courses/{id}/members", h.GetCourseMembers).Methods("GET")
+	auth.HandleFunc("/courses/{id}/members", h.AddCourseMember).Methods("POST")
+	auth.HandleFunc("/courses/{id}/members/bulk", h.BulkAddCourseMembers).Methods("POST")
+	auth.HandleFunc("/courses/{id}/members/{user_id}", h.RemoveCourseMember).Methods("DELETE")
+	auth.HandleFunc("/courses/{id}/gradebook", h.GetGradebook).Methods("GET")
+	auth.HandleFunc("/courses/{id}/gradebook/export", h.ExportGradebook).Methods("GET")
+	auth.HandleFunc("/courses/{id}/questions", h.SearchCourseQuestions).Methods("GET")
+	auth.HandleFunc("/courses/{id}/invites", h.GetCourseInvites).Methods("GET")
+	auth.HandleFunc("/courses/{id}/invites", h.CreateCourseInvite).Methods("POST")
+	auth.HandleFunc("/courses/{id}/invites/{code}", h.DeleteCourseInvite).Methods("DELETE")
 	// Тесты
-	auth.HandleFunc("/tests", (&handlers.DBHandler{DB: database}).CreateTest).Methods("POST")
-	auth.HandleFunc("/courses/{id}/tests", (&handlers.DBHandler{DB: database}).GetCourseTests).Methods("GET")
-	auth.HandleFunc("/tests/{id}", (&handlers.DBHandler{DB: database}).GetTest).Methods("GET")
-	auth.HandleFunc("/tests/{id}/activate", (&handlers.DBHandler{DB: database}).ActivateTest).Methods("POST")
-	auth.HandleFunc("/tests/{id}/deactivate", (&handlers.DBHandler{DB: database}).DeactivateTest).Methods("POST")
+	auth.HandleFunc("/tests", h.CreateTest).Methods("POST")
+	auth.HandleFunc("/courses/{id}/tests", h.GetCourseTests).Methods("GET")
+	auth.HandleFunc("/courses/{id}/tests/import", h.ImportTestBundle).Methods("POST")
+	auth.HandleFunc("/tests/{id}", h.GetTest).Methods("GET")
+	auth.HandleFunc("/tests/{id}", h.UpdateTest).Methods("PUT")
+	auth.HandleFunc("/tests/{id}", h.PatchTest).Methods("PATCH")
+	auth.HandleFunc("/tests/{id}", h.DeleteTest).Methods("DELETE")
+	auth.HandleFunc("/tests/{id}/restore", h.RestoreTest).Methods("POST")
+	auth.HandleFunc("/tests/{id}/activate", h.ActivateTest).Methods("POST")
+	auth.HandleFunc("/tests/{id}/deactivate", h.DeactivateTest).Methods("POST")
+	auth.HandleFunc("/tests/{id}/settings", h.UpdateTestSchedule).Methods("PUT")
+	auth.HandleFunc("/tests/{id}/policy", h.UpdateTestPolicy).Methods("PUT")
+	auth.HandleFunc("/tests/{id}/randomization", h.GetTestRandomization).Methods("GET")
+	auth.HandleFunc("/tests/{id}/randomization", h.UpdateTestRandomization).Methods("PUT")
+	auth.HandleFunc("/tests/{id}/score", h.GetTestScore).Methods("GET")
+	auth.HandleFunc("/tests/{id}/attempts/export", h.ExportTestAttempts).Methods("GET")
+	auth.HandleFunc("/tests/{id}/analytics", h.GetTestAnalytics).Methods("GET")
+	auth.HandleFunc("/tests/{id}/export", h.ExportTestBundle).Methods("GET")
+	auth.HandleFunc("/tests/{id}/review/enable", h.EnableReview).Methods("POST")
+	auth.HandleFunc("/tests/{id}/review/disable", h.DisableReview).Methods("POST")
+	auth.HandleFunc("/tests/{id}/survey/results", h.GetSurveyResults).Methods("GET")
 	// Вопросы
-	auth.HandleFunc("/questions", (&handlers.DBHandler{DB: database}).CreateQuestion).Methods("POST")
-	auth.HandleFunc("/questions/{id}", (&handlers.DBHandler{DB: database}).GetQuestion).Methods("GET")
-	auth.HandleFunc("/questions/{id}", (&handlers.DBHandler{DB: database}).UpdateQuestion).Methods("PUT")
-	auth.HandleFunc("/questions/{id}", (&handlers.DBHandler{DB: database}).DeleteQuestion).Methods("DELETE")
+	auth.HandleFunc("/questions", h.CreateQuestion).Methods("POST")
+	auth.HandleFunc("/tests/{id}/questions", h.GetTestQuestions).Methods("GET")
+	auth.HandleFunc("/tests/{id}/questions", h.AddTestQuestion).Methods("POST")
+	auth.HandleFunc("/tests/{id}/questions", h.SetTestQuestions).Methods("PUT")
+	auth.HandleFunc("/tests/{id}/questions/import", h.ImportTestQuestions).Methods("POST")
+	auth.HandleFunc("/tests/{id}/questions/{question_id}", h.RemoveTestQuestion).Methods("DELETE")
+	auth.HandleFunc("/questions/{id}", h.GetQuestion).Methods("GET")
+	auth.HandleFunc("/questions/{id}", h.UpdateQuestion).Methods("PUT")
+	auth.HandleFunc("/questions/{id}", h.DeleteQuestion).Methods("DELETE")
+	auth.HandleFunc("/questions/{id}/restore", h.RestoreQuestion).Methods("POST")
+	auth.HandleFunc("/questions/{id}/versions", h.GetQuestionVersions).Methods("GET")
 	// Попытки
-	auth.HandleFunc("/tests/{id}/attempts", (&handlers.DBHandler{DB: database}).CreateAttempt).Methods("POST")
-	auth.HandleFunc("/attempts/{id}", (&handlers.DBHandler{DB: database}).GetAttempt).Methods("GET")
-	auth.HandleFunc("/attempts/{id}/answers", (&handlers.DBHandler{DB: database}).SubmitAnswer).Methods("POST")
-	auth.HandleFunc("/attempts/{id}/complete", (&handlers.DBHandler{DB: database}).CompleteAttempt).Methods("POST")
+	auth.HandleFunc("/tests/{id}/attempts", h.CreateAttempt).Methods("POST")
+	auth.HandleFunc("/attempts/{id}", h.GetAttempt).Methods("GET")
+	auth.HandleFunc("/attempts/{id}/questions", h.GetAttemptQuestions).Methods("GET")
+	auth.HandleFunc("/attempts/{id}/answers", h.SubmitAnswer).Methods("POST")
+	auth.HandleFunc("/attempts/{id}/answers/history", h.GetAnswerHistory).Methods("GET")
+	auth.HandleFunc("/attempts/{id}/complete", h.CompleteAttempt).Methods("POST")
+	auth.HandleFunc("/attempts/{id}/result", h.GetAttemptResult).Methods("GET")
+	auth.HandleFunc("/attempts/{id}/review", h.GetAttemptReview).Methods("GET")
+	// Уведомления
+	auth.HandleFunc("/notifications", h.GetNotifications).Methods("GET")
+	auth.HandleFunc("/notifications/clear", h.ClearNotifications).Methods("POST")
+	auth.HandleFunc("/notifications/{id}/read", h.ReadNotification).Methods("POST")
+	// Текстовые команды бота
+	auth.HandleFunc("/command", h.ExecuteCommand).Methods("POST")
 	// Обработка 404 ошибки
-	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Not found"})
-	})
+	router.NotFoundHandler = handlers.RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.WriteError(w, r, http.StatusNotFound, handlers.CodeNotFound, "Not found")
+	}))
+	router.MethodNotAllowedHandler = handlers.RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.WriteError(w, r, http.StatusMethodNotAllowed, handlers.CodeMethodNotAllowed, "Method not allowed")
+	}))
 	// Запуск сервера
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // User представляет пользователя в системе
 type User struct {
@@ -20,41 +23,488 @@ type Course struct {
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+// CourseMember представляет участника дисциплины
+type CourseMember struct {
+	UserID    int       `json:"user_id"`
+	UserRef   string    `json:"user_ref"`
+	FullName  string    `json:"full_name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CourseInvite представляет код приглашения для самостоятельной записи на дисциплину
+type CourseInvite struct {
+	Code      string     `json:"code"`
+	CourseID  int        `json:"course_id"`
+	CreatedBy int        `json:"created_by"`
+	MaxUses   *int       `json:"max_uses,omitempty"`
+	Uses      int        `json:"uses"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
 // Test представляет тест
 type Test struct {
-	ID        int       `json:"id"`
-	CourseID  int       `json:"course_id"`
-	Name      string    `json:"name"`
-	Active    bool      `json:"active"`
-	CreatedAt time.Time `json:"created_at"`
-	Questions []int     `json:"questions,omitempty"`
+	ID          int        `json:"id"`
+	CourseID    int        `json:"course_id"`
+	Name        string     `json:"name"`
+	Kind        string     `json:"kind"`
+	Anonymous   bool       `json:"anonymous"`
+	Active      bool       `json:"active"`
+	AllowReview bool       `json:"allow_review"`
+	TimeLimit   *int       `json:"time_limit_seconds,omitempty"`
+	OpensAt     *time.Time `json:"opens_at,omitempty"`
+	ClosesAt    *time.Time `json:"closes_at,omitempty"`
+	// MaxAttempts и Cooldown ограничивают пересдачи; nil — без ограничений
+	MaxAttempts   *int   `json:"max_attempts,omitempty"`
+	Cooldown      *int   `json:"cooldown_seconds,omitempty"`
+	GradingPolicy string `json:"grading_policy"`
+	// ShuffleQuestions и ShuffleOptions перемешивают вопросы и варианты в каждой попытке
+	ShuffleQuestions bool       `json:"shuffle_questions"`
+	ShuffleOptions   bool       `json:"shuffle_options"`
+	CreatedAt        time.Time  `json:"created_at"`
+	DeletedAt        *time.Time `json:"deleted_at,omitempty"`
+	Questions        []int      `json:"questions,omitempty"`
+	// QuestionCount и TotalPoints — число вопросов и наибольший балл варианта с учётом
+	// выборок из пулов; заполняются в списке тестов дисциплины
+	QuestionCount int     `json:"question_count,omitempty"`
+	TotalPoints   float64 `json:"total_points,omitempty"`
+	// Stats — статистика попыток; отдаётся только авторам дисциплины
+	Stats *TestStats `json:"stats,omitempty"`
+}
+
+// TestStats представляет статистику попыток теста
+type TestStats struct {
+	Attempts         int `json:"attempts"`
+	FinishedAttempts int `json:"finished_attempts"`
+	Participants     int `json:"participants"`
+	// AvgPercentage — средний процент по завершённым попыткам; nil, если их нет
+	AvgPercentage *float64 `json:"avg_percentage"`
 }
 
-// Question представляет вопрос
+// QuestionPool описывает случайную выборку вопросов банка в тест:
+// в каждую попытку попадает Count вопросов с тегом Tag
+type QuestionPool struct {
+	ID     int     `json:"id"`
+	TestID int     `json:"test_id"`
+	Tag    string  `json:"tag"`
+	Count  int     `json:"count"`
+	Points float64 `json:"points"`
+}
+
+// Правила выставления итоговой оценки по нескольким попыткам
+const (
+	GradingBest    = "best"    // лучшая попытка
+	GradingLast    = "last"    // последняя попытка
+	GradingAverage = "average" // среднее по всем попыткам
+	GradingFirst   = "first"   // первая попытка
+)
+
+// FinalScore представляет итоговую оценку студента за тест по правилу теста
+type FinalScore struct {
+	TestID     int     `json:"test_id"`
+	UserID     int     `json:"user_id"`
+	Policy     string  `json:"grading_policy"`
+	Attempts   int     `json:"attempts"`
+	AttemptID  *int    `json:"attempt_id,omitempty"`
+	Score      float64 `json:"score"`
+	MaxScore   float64 `json:"max_score"`
+	Percentage float64 `json:"percentage"`
+}
+
+// Виды тестов
+const (
+	TestKindQuiz   = "quiz"   // тест с проверкой ответов
+	TestKindSurvey = "survey" // опрос без правильных ответов
+)
+
+// Типы вопросов
+const (
+	QuestionSingle    = "single"     // один правильный вариант
+	QuestionMultiple  = "multiple"   // несколько правильных вариантов
+	QuestionTrueFalse = "true_false" // верно/неверно
+	QuestionNumeric   = "numeric"    // число с допустимой погрешностью
+	QuestionText      = "text"       // короткий текстовый ответ
+	QuestionOrdering  = "ordering"   // упорядочивание вариантов
+	QuestionMatching  = "matching"   // сопоставление двух списков
+	QuestionLikert    = "likert"     // шкала Лайкерта (только в опросах)
+	QuestionFreeText  = "free_text"  // свободный ответ (только в опросах)
+)
+
+// Question представляет вопрос.
+// Формат CorrectAnswer зависит от типа:
+//   - single: индекс варианта (2)
+//   - multiple: индексы правильных вариантов ([0, 2])
+//   - true_false: true или false
+//   - numeric: {"value": 3.14, "tolerance": 0.01}
+//   - text: {"accepted": ["Москва"], "pattern": "моск.*", "case_sensitive": false};
+//     pattern должен совпасть со всем ответом целиком, а не с его частью
+//   - ordering: индексы вариантов в правильном порядке ([2, 0, 1])
+//   - matching: для каждого варианта из options индекс пары из matches ([1, 0, 2])
+//
+// У вопросов опроса ключа нет, и CorrectAnswer равен null.
+// Вопрос хранится в банке дисциплины и может входить в несколько тестов того же вида
 type Question struct {
-	ID            int       `json:"id"`
-	TestID        int       `json:"test_id"`
-	Text          string    `json:"text"`
-	Options       []string  `json:"options"`
-	CorrectAnswer int       `json:"correct_answer"`
-	CreatedAt     time.Time `json:"created_at"`
+	ID            int             `json:"id"`
+	CourseID      int             `json:"course_id"`
+	Kind          string          `json:"kind"`
+	Type          string          `json:"type"`
+	Text          string          `json:"text"`
+	Options       []string        `json:"options"`
+	Matches       []string        `json:"matches,omitempty"`
+	CorrectAnswer json.RawMessage `json:"correct_answer"`
+	Tags          []string        `json:"tags"`
+	CreatedAt     time.Time       `json:"created_at"`
+	// Version — номер версии; каждое изменение вопроса создаёт новую версию
+	Version   int        `json:"version"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Поля ниже заполняются, когда вопрос загружен в составе теста
+	TestID   int     `json:"test_id,omitempty"`
+	Position int     `json:"position,omitempty"`
+	Points   float64 `json:"points,omitempty"`
+}
+
+// QuestionVersion представляет сохранённую версию вопроса. Попытки ссылаются на версию,
+// которую видел студент, поэтому правка вопроса не меняет проверку прошлых ответов
+type QuestionVersion struct {
+	QuestionID    int             `json:"question_id"`
+	Version       int             `json:"version"`
+	Type          string          `json:"type"`
+	Text          string          `json:"text"`
+	Options       []string        `json:"options"`
+	Matches       []string        `json:"matches,omitempty"`
+	CorrectAnswer json.RawMessage `json:"correct_answer"`
+	Tags          []string        `json:"tags"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// NumericKey представляет ключ числового вопроса
+type NumericKey struct {
+	Value     float64 `json:"value"`
+	Tolerance float64 `json:"tolerance"`
+}
+
+// TextKey представляет ключ текстового вопроса
+type TextKey struct {
+	Accepted      []string `json:"accepted,omitempty"`
+	Pattern       string   `json:"pattern,omitempty"`
+	CaseSensitive bool     `json:"case_sensitive,omitempty"`
+}
+
+// StudentQuestion представляет вопрос без правильного ответа, как его видит проходящий тест.
+// OptionIDs содержит исходные индексы вариантов, если они перемешаны
+type StudentQuestion struct {
+	ID        int      `json:"id"`
+	TestID    int      `json:"test_id,omitempty"`
+	Type      string   `json:"type"`
+	Text      string   `json:"text"`
+	Options   []string `json:"options"`
+	Matches   []string `json:"matches,omitempty"`
+	OptionIDs []int    `json:"option_ids,omitempty"`
 }
 
 // Attempt представляет попытку прохождения теста
 type Attempt struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	TestID      int        `json:"test_id"`
+	Finished    bool       `json:"finished"`
+	Score       *float64   `json:"score,omitempty"`
+	MaxScore    *float64   `json:"max_score,omitempty"`
+	Percentage  *float64   `json:"percentage,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Questions   []int      `json:"questions,omitempty"` // вопросы варианта в порядке показа
+	Answers     []Answer   `json:"answers,omitempty"`
+}
+
+// Answer представляет ответ на вопрос.
+// Формат Answer совпадает с форматом CorrectAnswer вопроса, кроме numeric (число)
+// и text (строка); для true_false допускается также индекс варианта
+type Answer struct {
+	ID         int             `json:"id"`
+	AttemptID  int             `json:"attempt_id"`
+	QuestionID int             `json:"question_id"`
+	Answer     json.RawMessage `json:"answer"`
+	IsCorrect  *bool           `json:"is_correct,omitempty"`
+	// Revision увеличивается при каждом изменении ответа
+	Revision  int       `json:"revision"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AnswerRevision представляет одну версию ответа в истории его изменений
+type AnswerRevision struct {
+	AnswerID   int             `json:"answer_id"`
+	QuestionID int             `json:"question_id"`
+	Revision   int             `json:"revision"`
+	Answer     json.RawMessage `json:"answer"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AttemptResult представляет итог проверки завершённой попытки
+type AttemptResult struct {
+	AttemptID   int              `json:"attempt_id"`
+	UserID      int              `json:"user_id"`
+	TestID      int              `json:"test_id"`
+	Score       float64          `json:"score"`
+	MaxScore    float64          `json:"max_score"`
+	Percentage  float64          `json:"percentage"`
+	Correct     int              `json:"correct"`
+	Total       int              `json:"total"`
+	CompletedAt time.Time        `json:"completed_at"`
+	Questions   []QuestionResult `json:"questions"`
+}
+
+// QuestionResult представляет результат ответа на отдельный вопрос
+type QuestionResult struct {
+	QuestionID int             `json:"question_id"`
+	Answer     json.RawMessage `json:"answer"`
+	Correct    bool            `json:"correct"`
+	Points     float64         `json:"points"`
+	MaxPoints  float64         `json:"max_points"`
+}
+
+// AttemptReview представляет разбор завершённой попытки с правильными ответами
+type AttemptReview struct {
+	AttemptID  int              `json:"attempt_id"`
+	TestID     int              `json:"test_id"`
+	Score      float64          `json:"score"`
+	MaxScore   float64          `json:"max_score"`
+	Percentage float64          `json:"percentage"`
+	Questions  []ReviewQuestion `json:"questions"`
+}
+
+// ReviewQuestion представляет вопрос в разборе попытки
+type ReviewQuestion struct {
+	QuestionID    int             `json:"question_id"`
+	Type          string          `json:"type"`
+	Text          string          `json:"text"`
+	Options       []string        `json:"options"`
+	Matches       []string        `json:"matches,omitempty"`
+	Answer        json.RawMessage `json:"answer"`
+	CorrectAnswer json.RawMessage `json:"correct_answer"`
+	Correct       bool            `json:"correct"`
+	Points        float64         `json:"points"`
+	MaxPoints     float64         `json:"max_points"`
+}
+
+// Notification представляет уведомление пользователя
+type Notification struct {
 	ID        int       `json:"id"`
 	UserID    int       `json:"user_id"`
-	TestID    int       `json:"test_id"`
-	Finished  bool      `json:"finished"`
+	Type      string    `json:"type"`
+	Message   string    `json:"message"`
+	IsRead    bool      `json:"is_read"`
 	CreatedAt time.Time `json:"created_at"`
-	Answers   []Answer  `json:"answers,omitempty"`
 }
 
-// Answer представляет ответ на вопрос
-type Answer struct {
-	ID         int       `json:"id"`
-	AttemptID  int       `json:"attempt_id"`
-	QuestionID int       `json:"question_id"`
-	Answer     int       `json:"answer"`
-	CreatedAt  time.Time `json:"created_at"`
+// SurveyResults представляет сводные результаты опроса
+type SurveyResults struct {
+	TestID    int              `json:"test_id"`
+	Anonymous bool             `json:"anonymous"`
+	Responses int              `json:"responses"`
+	Questions []SurveyQuestion `json:"questions"`
+}
+
+// SurveyQuestion представляет сводку ответов на вопрос опроса
+type SurveyQuestion struct {
+	QuestionID   int           `json:"question_id"`
+	Type         string        `json:"type"`
+	Text         string        `json:"text"`
+	Responses    int           `json:"responses"`
+	Distribution []OptionCount `json:"distribution,omitempty"`
+	Average      *float64      `json:"average,omitempty"`
+	Texts        []string      `json:"texts,omitempty"`
+}
+
+// OptionCount представляет число выборов варианта ответа
+type OptionCount struct {
+	Option     string  `json:"option"`
+	Count      int     `json:"count"`
+	Percentage float64 `json:"percentage"`
+}
+
+// Статусы прохождения теста студентом в журнале
+const (
+	GradeNotStarted = "not_started" // попыток не было
+	GradeInProgress = "in_progress" // есть только незавершённая попытка
+	GradeCompleted  = "completed"   // есть оценённая попытка
+)
+
+// Gradebook представляет журнал дисциплины: оценки студентов по всем тестам
+type Gradebook struct {
+	CourseID int             `json:"course_id"`
+	Tests    []GradebookTest `json:"tests"`
+	Students []GradebookRow  `json:"students"`
+}
+
+// GradebookTest описывает столбец журнала
+type GradebookTest struct {
+	TestID        int    `json:"test_id"`
+	Name          string `json:"name"`
+	Active        bool   `json:"active"`
+	GradingPolicy string `json:"grading_policy"`
+}
+
+// GradebookRow представляет строку журнала — оценки одного студента
+type GradebookRow struct {
+	UserID   int    `json:"user_id"`
+	UserRef  string `json:"user_ref"`
+	FullName string `json:"full_name"`
+	// Average — средний итоговый процент по завершённым тестам
+	Average   *float64        `json:"average,omitempty"`
+	Completed int             `json:"completed"`
+	Cells     []GradebookCell `json:"cells"`
+}
+
+// GradebookCell представляет итог студента по одному тесту
+type GradebookCell struct {
+	TestID     int      `json:"test_id"`
+	Status     string   `json:"status"`
+	Attempts   int      `json:"attempts"`
+	AttemptID  *int     `json:"attempt_id,omitempty"`
+	Score      *float64 `json:"score,omitempty"`
+	MaxScore   *float64 `json:"max_score,omitempty"`
+	Percentage *float64 `json:"percentage,omitempty"`
+}
+
+// TestAnalytics представляет анализ качества теста по завершённым попыткам
+type TestAnalytics struct {
+	TestID    int     `json:"test_id"`
+	Attempts  int     `json:"attempts"`
+	MeanScore float64 `json:"mean_score"`
+	StdDev    float64 `json:"std_dev"`
+	// KR20 — надёжность теста (для вопросов, оцениваемых 0/1, совпадает с альфой Кронбаха)
+	KR20      *float64       `json:"kr20"`
+	Questions []ItemAnalysis `json:"questions"`
+}
+
+// ItemAnalysis представляет статистику одного вопроса
+type ItemAnalysis struct {
+	QuestionID int    `json:"question_id"`
+	Type       string `json:"type"`
+	Text       string `json:"text"`
+	Answered   int    `json:"answered"`
+	// Difficulty — доля правильных ответов (p-value)
+	Difficulty *float64 `json:"difficulty"`
+	// Discrimination — разница доли правильных ответов в верхних и нижних 27% попыток
+	Discrimination *float64     `json:"discrimination"`
+	AvgTimeSeconds *float64     `json:"avg_time_seconds"`
+	Options        []OptionStat `json:"options,omitempty"`
+}
+
+// OptionStat представляет выбор варианта ответа для анализа дистракторов
+type OptionStat struct {
+	Option     string  `json:"option"`
+	Correct    bool    `json:"correct"`
+	Count      int     `json:"count"`
+	Percentage float64 `json:"percentage"`
+	// UpperCount и LowerCount — сколько раз вариант выбран в верхней и нижней группах
+	UpperCount int `json:"upper_count"`
+	LowerCount int `json:"lower_count"`
+}
+
+// Статусы элементов отчёта об импорте вопросов
+const (
+	ImportImported = "imported" // вопрос создан и добавлен в тест
+	ImportLinked   = "linked"   // такой вопрос уже был в банке, и в тест добавлен он
+	ImportSkipped  = "skipped"  // вопрос пропущен: тип не поддерживается или он уже есть в тесте
+	ImportFailed   = "failed"   // вопрос не удалось разобрать или он не прошёл проверку
+)
+
+// ImportReport представляет результат импорта вопросов в тест
+type ImportReport struct {
+	TestID   int          `json:"test_id"`
+	Format   string       `json:"format"`
+	Imported int          `json:"imported"`
+	Linked   int          `json:"linked"`
+	Skipped  int          `json:"skipped"`
+	Failed   int          `json:"failed"`
+	Items    []ImportItem `json:"items"`
+}
+
+// ImportItem представляет один вопрос исходного файла в отчёте об импорте
+type ImportItem struct {
+	Index      int    `json:"index"`
+	Title      string `json:"title"`
+	Type       string `json:"type,omitempty"`
+	Status     string `json:"status"`
+	QuestionID int    `json:"question_id,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+// TestBundleVersion — текущая версия формата переноса теста
+const TestBundleVersion = 1
+
+// TestBundle представляет тест в переносимом виде: настройки, вопросы с ключами и пулы.
+// ID вопросов в пакете — исходные и служат только для ссылок внутри пакета
+type TestBundle struct {
+	Version    int              `json:"version"`
+	ExportedAt time.Time        `json:"exported_at"`
+	Test       BundleTest       `json:"test"`
+	Questions  []BundleQuestion `json:"questions"`
+	Pools      []BundlePool     `json:"pools"`
+	// Media — внешние ссылки на изображения и файлы, найденные в текстах вопросов
+	Media []string `json:"media,omitempty"`
+}
+
+// BundleTest представляет настройки теста в пакете
+type BundleTest struct {
+	Name             string     `json:"name"`
+	Kind             string     `json:"kind"`
+	Anonymous        bool       `json:"anonymous"`
+	AllowReview      bool       `json:"allow_review"`
+	TimeLimit        *int       `json:"time_limit_seconds"`
+	OpensAt          *time.Time `json:"opens_at"`
+	ClosesAt         *time.Time `json:"closes_at"`
+	MaxAttempts      *int       `json:"max_attempts"`
+	Cooldown         *int       `json:"cooldown_seconds"`
+	GradingPolicy    string     `json:"grading_policy"`
+	ShuffleQuestions bool       `json:"shuffle_questions"`
+	ShuffleOptions   bool       `json:"shuffle_options"`
+}
+
+// BundleQuestion представляет вопрос в пакете. InTest — вопрос входит в состав теста
+// с весом Points; остальные вопросы нужны пулам теста
+type BundleQuestion struct {
+	ID            int             `json:"id"`
+	Type          string          `json:"type"`
+	Text          string          `json:"text"`
+	Options       []string        `json:"options"`
+	Matches       []string        `json:"matches,omitempty"`
+	CorrectAnswer json.RawMessage `json:"correct_answer"`
+	Tags          []string        `json:"tags"`
+	InTest        bool            `json:"in_test"`
+	Points        float64         `json:"points,omitempty"`
+}
+
+// BundlePool представляет пул вопросов в пакете
+type BundlePool struct {
+	Tag    string  `json:"tag"`
+	Count  int     `json:"count"`
+	Points float64 `json:"points"`
+}
+
+// BundleImportResult представляет результат импорта пакета: созданный тест
+// и соответствие ID вопросов пакета новым ID
+type BundleImportResult struct {
+	Test        Test        `json:"test"`
+	QuestionIDs map[int]int `json:"question_ids"`
+}
+
+// ErrorResponse представляет тело ответа с ошибкой. Code — стабильный машиночитаемый код,
+// Message — описание для человека, Details — подробности, например ошибки полей
+type ErrorResponse struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// FieldError описывает ошибку проверки одного поля запроса
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
 }
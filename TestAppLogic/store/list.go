@@ -0,0 +1,283 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testapplogic/models"
+	"time"
+)
+
+// Размер страницы списков по умолчанию и наибольший допустимый
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// cursorTime — формат времени в курсоре; точность совпадает с TIMESTAMP PostgreSQL,
+// а строки сравниваются в том же порядке, что и время
+const cursorTime = "2006-01-02T15:04:05.000000Z"
+
+// ErrInvalidCursor возвращается, если курсор повреждён или выдан для другой сортировки
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListOptions — общие параметры списков: поиск, диапазон даты создания, сортировка и страница
+type ListOptions struct {
+	// Query — подстрока для поиска без учёта регистра
+	Query string
+	// CreatedFrom и CreatedTo ограничивают дату создания: [CreatedFrom, CreatedTo)
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	// Sort — ключ сортировки; при равенстве ключей записи упорядочены по ID
+	Sort string
+	Desc bool
+	// Limit — размер страницы; After — курсор, после которого начинается страница
+	Limit int
+	After *Cursor
+}
+
+// Cursor — позиция в списке: ключ сортировки и ID последней выданной записи
+type Cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v,omitempty"`
+	ID    int    `json:"id"`
+}
+
+// String кодирует курсор для передачи клиенту
+func (c Cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor разбирает курсор, полученный от клиента
+func ParseCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Sort == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// CourseFilter задаёт выборку дисциплин. Сортировки: id, name, created_at
+type CourseFilter struct {
+	ListOptions
+	// MemberID — только дисциплины, которые пользователь ведёт или на которые записан
+	MemberID int
+	// TeacherID — только дисциплины преподавателя
+	TeacherID int
+}
+
+// TestFilter задаёт выборку тестов дисциплины. Сортировки: id, name, created_at
+type TestFilter struct {
+	ListOptions
+	CourseID int
+	Active   *bool
+	Kind     string
+	// IDs — только тесты из списка; пустой список не ограничивает выборку
+	IDs []int
+}
+
+// QuestionFilter задаёт выборку вопросов банка дисциплины. Сортировки: id, created_at.
+// Вопрос должен содержать все теги из Tags
+type QuestionFilter struct {
+	ListOptions
+	CourseID int
+	Tags     []string
+	Type     string
+	Kind     string
+}
+
+// sortColumn описывает ключ сортировки в SQL: колонку и тип значения курсора.
+// Пустой тип означает сортировку по самому ID
+type sortColumn struct {
+	column, cast string
+}
+
+// check проверяет ключ сортировки, размер страницы и соответствие курсора сортировке
+func (o *ListOptions) check(sorts map[string]sortColumn) error {
+	if _, ok := sorts[o.Sort]; !ok {
+		return fmt.Errorf("unknown sort key %q", o.Sort)
+	}
+	if o.Limit <= 0 || o.Limit > MaxLimit {
+		o.Limit = DefaultLimit
+	}
+	if o.After != nil && (o.After.Sort != o.Sort || o.After.Desc != o.Desc) {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+// keyset возвращает условие курсора (начинается с AND), ORDER BY и LIMIT для запроса.
+// Параметры дописываются в args; idColumn — колонка ID с псевдонимом таблицы
+func (o ListOptions) keyset(sorts map[string]sortColumn, idColumn string, args []interface{}) (string, []interface{}) {
+	key := sorts[o.Sort]
+	op, dir := ">", "ASC"
+	if o.Desc {
+		op, dir = "<", "DESC"
+	}
+	var b strings.Builder
+	if o.After != nil {
+		if key.cast == "" {
+			args = append(args, o.After.ID)
+			fmt.Fprintf(&b, " AND %s %s $%d", idColumn, op, len(args))
+		} else {
+			args = append(args, o.After.Value, o.After.ID)
+			fmt.Fprintf(&b, " AND (%s, %s) %s ($%d::%s, $%d)", key.column, idColumn, op, len(args)-1, key.cast, len(args))
+		}
+	}
+	b.WriteString(" ORDER BY ")
+	if key.cast != "" {
+		fmt.Fprintf(&b, "%s %s, ", key.column, dir)
+	}
+	args = append(args, o.Limit+1)
+	fmt.Fprintf(&b, "%s %s LIMIT $%d", idColumn, dir, len(args))
+	return b.String(), args
+}
+
+// createdArgs дописывает в args границы даты создания и возвращает условие (начинается с AND)
+func (o ListOptions) createdArgs(column string, args []interface{}) (string, []interface{}) {
+	var cond string
+	if o.CreatedFrom != nil {
+		args = append(args, *o.CreatedFrom)
+		cond += fmt.Sprintf(" AND %s >= $%d", column, len(args))
+	}
+	if o.CreatedTo != nil {
+		args = append(args, *o.CreatedTo)
+		cond += fmt.Sprintf(" AND %s < $%d", column, len(args))
+	}
+	return cond, args
+}
+
+// likePattern превращает строку поиска в шаблон ILIKE ... ESCAPE '\' для поиска подстроки.
+// Символы %, _ и \ экранируются, чтобы искались буквально; пустой поиск даёт пустую строку
+func likePattern(query string) string {
+	if query == "" {
+		return ""
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(query)
+	return "%" + escaped + "%"
+}
+
+// inCreated проверяет, попадает ли время создания в диапазон фильтра
+func (o ListOptions) inCreated(t time.Time) bool {
+	return (o.CreatedFrom == nil || !t.Before(*o.CreatedFrom)) && (o.CreatedTo == nil || t.Before(*o.CreatedTo))
+}
+
+// matches проверяет, содержит ли одна из строк подстроку поиска
+func (o ListOptions) matches(values ...string) bool {
+	if o.Query == "" {
+		return true
+	}
+	q := strings.ToLower(o.Query)
+	for _, v := range values {
+		if strings.Contains(strings.ToLower(v), q) {
+			return true
+		}
+	}
+	return false
+}
+
+// listEntry — запись списка с её ключом сортировки
+type listEntry struct {
+	id    int
+	value string
+}
+
+// cursorValue приводит значение ключа сортировки к виду, в котором оно хранится в курсоре
+func cursorValue(v interface{}) string {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC().Format(cursorTime)
+	case string:
+		return v
+	default:
+		return ""
+	}
+}
+
+// page сортирует записи, отбрасывает всё до курсора и возвращает индексы записей страницы
+// вместе с курсором следующей страницы. Используется хранилищем в памяти
+func (o ListOptions) page(entries []listEntry) ([]int, *Cursor) {
+	less := func(a, b listEntry) bool {
+		if a.value != b.value {
+			return a.value < b.value
+		}
+		return a.id < b.id
+	}
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := entries[order[i]], entries[order[j]]
+		if o.Desc {
+			return less(b, a)
+		}
+		return less(a, b)
+	})
+	var result []int
+	for _, i := range order {
+		e := entries[i]
+		if o.After != nil {
+			after := listEntry{id: o.After.ID, value: o.After.Value}
+			if (!o.Desc && !less(after, e)) || (o.Desc && !less(e, after)) {
+				continue
+			}
+		}
+		result = append(result, i)
+	}
+	if len(result) <= o.Limit {
+		return result, nil
+	}
+	result = result[:o.Limit]
+	last := entries[result[len(result)-1]]
+	return result, &Cursor{Sort: o.Sort, Desc: o.Desc, Value: last.value, ID: last.id}
+}
+
+// nextCursor отрезает лишнюю запись, запрошенную сверх Limit, и строит курсор по последней
+// оставшейся. value возвращает ключ сортировки записи с индексом i
+func (o ListOptions) nextCursor(n int, id func(i int) int, value func(i int) interface{}) (int, *Cursor) {
+	if n <= o.Limit {
+		return n, nil
+	}
+	last := o.Limit - 1
+	return o.Limit, &Cursor{Sort: o.Sort, Desc: o.Desc, Value: cursorValue(value(last)), ID: id(last)}
+}
+
+// courseSortValue возвращает ключ сортировки дисциплины
+func courseSortValue(c models.Course, key string) interface{} {
+	switch key {
+	case "name":
+		return c.Name
+	case "created_at":
+		return c.CreatedAt
+	}
+	return nil
+}
+
+// testSortValue возвращает ключ сортировки теста
+func testSortValue(t models.Test, key string) interface{} {
+	switch key {
+	case "name":
+		return t.Name
+	case "created_at":
+		return t.CreatedAt
+	}
+	return nil
+}
+
+// questionSortValue возвращает ключ сортировки вопроса
+func questionSortValue(q models.Question, key string) interface{} {
+	if key == "created_at" {
+		return q.CreatedAt
+	}
+	return nil
+}
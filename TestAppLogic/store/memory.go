@@ -0,0 +1,697 @@
+package store
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"sync"
+	"testapplogic/models"
+	"time"
+)
+
+// Memory реализует Store в памяти процесса. Используется в тестах обработчиков,
+// которым не нужен PostgreSQL. Транзакции выполняются по одной; откат возвращает
+// всё хранилище к состоянию на начало транзакции, вместе с изменениями, сделанными
+// за это время вне её
+type Memory struct {
+	db   *memoryDB
+	inTx bool
+}
+
+var (
+	_ Store = (*Memory)(nil)
+	_ Tx    = (*memoryTx)(nil)
+)
+
+// memoryDB — общее состояние хранилища и его транзакций
+type memoryDB struct {
+	mu   sync.RWMutex
+	txMu sync.Mutex
+	data memoryData
+}
+
+// memoryData — записи хранилища. Методы memoryData вызываются под блокировкой
+type memoryData struct {
+	users         map[int]memoryUser
+	refs          map[string]int
+	courses       map[int]memoryCourse
+	members       map[int]map[int]memoryMember // course_id -> user_id -> участник
+	invites       map[string]models.CourseInvite
+	tests         map[int]memoryTest
+	questions     map[int]models.Question
+	versions      map[int][]models.QuestionVersion // question_id -> версии по порядку
+	links         map[int][]memoryLink             // test_id -> вопросы в порядке теста
+	pools         map[int][]models.QuestionPool
+	attempts      map[int]memoryAttempt
+	answers       map[int]models.Answer
+	revisions     map[int][]models.AnswerRevision // answer_id -> история ответа
+	participants  map[memoryParticipant]time.Time
+	notifications map[int]memoryNotification
+	lastID        int
+}
+
+// memoryUser — пользователь сервиса
+type memoryUser struct {
+	ref, fullName string
+}
+
+// memoryCourse — дисциплина с отметкой удаления
+type memoryCourse struct {
+	models.Course
+	deletedAt *time.Time
+}
+
+// memoryMember — запись пользователя на дисциплину
+type memoryMember struct {
+	role      string
+	createdAt time.Time
+}
+
+// memoryTest — тест; withCourse — тест удалён вместе с дисциплиной
+type memoryTest struct {
+	models.Test
+	withCourse bool
+}
+
+// memoryLink — вопрос в составе теста с его весом
+type memoryLink struct {
+	questionID int
+	points     float64
+}
+
+// memoryAttempt — попытка вместе с её вариантом
+type memoryAttempt struct {
+	models.Attempt
+	paper []memoryPaperItem
+}
+
+// memoryPaperItem — вопрос варианта попытки в выпавшей версии
+type memoryPaperItem struct {
+	questionID, version int
+	points              float64
+	order               []int
+}
+
+// memoryParticipant — участник опроса
+type memoryParticipant struct {
+	testID, userID int
+}
+
+// memoryNotification — уведомление с отметками доставки и прочтения
+type memoryNotification struct {
+	models.Notification
+	delivered bool
+	readAt    *time.Time
+}
+
+// NewMemory создаёт пустое хранилище в памяти
+func NewMemory() *Memory {
+	return &Memory{db: &memoryDB{data: memoryData{
+		users:         make(map[int]memoryUser),
+		refs:          make(map[string]int),
+		courses:       make(map[int]memoryCourse),
+		members:       make(map[int]map[int]memoryMember),
+		invites:       make(map[string]models.CourseInvite),
+		tests:         make(map[int]memoryTest),
+		questions:     make(map[int]models.Question),
+		versions:      make(map[int][]models.QuestionVersion),
+		links:         make(map[int][]memoryLink),
+		pools:         make(map[int][]models.QuestionPool),
+		attempts:      make(map[int]memoryAttempt),
+		answers:       make(map[int]models.Answer),
+		revisions:     make(map[int][]models.AnswerRevision),
+		participants:  make(map[memoryParticipant]time.Time),
+		notifications: make(map[int]memoryNotification),
+	}}}
+}
+
+// clone копирует записи для отката транзакции. Записи заменяются целиком и не меняются
+// на месте, поэтому вложенные срезы моделей не копируются
+func (d *memoryData) clone() memoryData {
+	c := *d
+	c.users = make(map[int]memoryUser, len(d.users))
+	for k, v := range d.users {
+		c.users[k] = v
+	}
+	c.refs = make(map[string]int, len(d.refs))
+	for k, v := range d.refs {
+		c.refs[k] = v
+	}
+	c.courses = make(map[int]memoryCourse, len(d.courses))
+	for k, v := range d.courses {
+		c.courses[k] = v
+	}
+	c.members = make(map[int]map[int]memoryMember, len(d.members))
+	for k, v := range d.members {
+		members := make(map[int]memoryMember, len(v))
+		for user, m := range v {
+			members[user] = m
+		}
+		c.members[k] = members
+	}
+	c.invites = make(map[string]models.CourseInvite, len(d.invites))
+	for k, v := range d.invites {
+		c.invites[k] = v
+	}
+	c.tests = make(map[int]memoryTest, len(d.tests))
+	for k, v := range d.tests {
+		c.tests[k] = v
+	}
+	c.questions = make(map[int]models.Question, len(d.questions))
+	for k, v := range d.questions {
+		c.questions[k] = v
+	}
+	c.versions = make(map[int][]models.QuestionVersion, len(d.versions))
+	for k, v := range d.versions {
+		c.versions[k] = append([]models.QuestionVersion(nil), v...)
+	}
+	c.links = make(map[int][]memoryLink, len(d.links))
+	for k, v := range d.links {
+		c.links[k] = append([]memoryLink(nil), v...)
+	}
+	c.pools = make(map[int][]models.QuestionPool, len(d.pools))
+	for k, v := range d.pools {
+		c.pools[k] = append([]models.QuestionPool(nil), v...)
+	}
+	c.attempts = make(map[int]memoryAttempt, len(d.attempts))
+	for k, v := range d.attempts {
+		v.paper = append([]memoryPaperItem(nil), v.paper...)
+		c.attempts[k] = v
+	}
+	c.answers = make(map[int]models.Answer, len(d.answers))
+	for k, v := range d.answers {
+		c.answers[k] = v
+	}
+	c.revisions = make(map[int][]models.AnswerRevision, len(d.revisions))
+	for k, v := range d.revisions {
+		c.revisions[k] = append([]models.AnswerRevision(nil), v...)
+	}
+	c.participants = make(map[memoryParticipant]time.Time, len(d.participants))
+	for k, v := range d.participants {
+		c.participants[k] = v
+	}
+	c.notifications = make(map[int]memoryNotification, len(d.notifications))
+	for k, v := range d.notifications {
+		c.notifications[k] = v
+	}
+	return c
+}
+
+// rlock блокирует хранилище на чтение и возвращает записи вместе с функцией разблокировки
+func (m *Memory) rlock() (*memoryData, func()) {
+	m.db.mu.RLock()
+	return &m.db.data, m.db.mu.RUnlock
+}
+
+// lock блокирует хранилище на запись и возвращает записи вместе с функцией разблокировки
+func (m *Memory) lock() (*memoryData, func()) {
+	m.db.mu.Lock()
+	return &m.db.data, m.db.mu.Unlock
+}
+
+// nextID выдаёт следующий идентификатор
+func (d *memoryData) nextID() int {
+	d.lastID++
+	return d.lastID
+}
+
+// Begin начинает транзакцию; следующая транзакция ждёт завершения текущей
+func (m *Memory) Begin() (Tx, error) {
+	if m.inTx {
+		return nil, ErrNestedTx
+	}
+	m.db.txMu.Lock()
+	d, unlock := m.rlock()
+	snapshot := d.clone()
+	unlock()
+	return &memoryTx{Memory: &Memory{db: m.db, inTx: true}, snapshot: snapshot}, nil
+}
+
+// memoryTx — хранилище в памяти внутри транзакции
+type memoryTx struct {
+	*Memory
+	snapshot memoryData
+	done     bool
+}
+
+// Commit завершает транзакцию, оставляя изменения
+func (t *memoryTx) Commit() error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	t.db.txMu.Unlock()
+	return nil
+}
+
+// Rollback возвращает хранилище к состоянию на начало транзакции; после Commit ничего не делает
+func (t *memoryTx) Rollback() error {
+	if t.done {
+		return nil
+	}
+	t.done = true
+	_, unlock := t.lock()
+	t.db.data = t.snapshot
+	unlock()
+	t.db.txMu.Unlock()
+	return nil
+}
+
+// Ping всегда успешен
+func (m *Memory) Ping() error {
+	return nil
+}
+
+// Courses возвращает страницу неудалённых дисциплин по фильтру и курсор следующей страницы
+func (m *Memory) Courses(f CourseFilter) ([]models.Course, *Cursor, error) {
+	if err := f.check(courseSorts); err != nil {
+		return nil, nil, err
+	}
+	d, unlock := m.rlock()
+	defer unlock()
+	var courses []models.Course
+	var entries []listEntry
+	for id, c := range d.courses {
+		if c.deletedAt != nil {
+			continue
+		}
+		if f.MemberID > 0 {
+			if _, member := d.members[id][f.MemberID]; !member && c.TeacherID != f.MemberID {
+				continue
+			}
+		}
+		if (f.TeacherID > 0 && c.TeacherID != f.TeacherID) || !f.matches(c.Name, c.Description) || !f.inCreated(c.CreatedAt) {
+			continue
+		}
+		courses = append(courses, c.Course)
+		entries = append(entries, listEntry{id: c.ID, value: cursorValue(courseSortValue(c.Course, f.Sort))})
+	}
+	indexes, next := f.page(entries)
+	page := make([]models.Course, 0, len(indexes))
+	for _, i := range indexes {
+		page = append(page, courses[i])
+	}
+	return page, next, nil
+}
+
+// course возвращает неудалённую дисциплину
+func (d *memoryData) course(id int) (models.Course, error) {
+	c, ok := d.courses[id]
+	if !ok || c.deletedAt != nil {
+		return models.Course{}, ErrNotFound
+	}
+	return c.Course, nil
+}
+
+// Course возвращает неудалённую дисциплину
+func (m *Memory) Course(id int) (models.Course, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	return d.course(id)
+}
+
+// CreateCourse создаёт дисциплину и записывает на неё преподавателя
+func (m *Memory) CreateCourse(c *models.Course) error {
+	d, unlock := m.lock()
+	defer unlock()
+	c.ID = d.nextID()
+	d.courses[c.ID] = memoryCourse{Course: *c}
+	d.members[c.ID] = map[int]memoryMember{c.TeacherID: {role: "teacher", createdAt: c.CreatedAt}}
+	return nil
+}
+
+// HasCourseAccess проверяет, ведёт ли пользователь дисциплину или записан на неё
+func (m *Memory) HasCourseAccess(userID, courseID int) (bool, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	c, err := d.course(courseID)
+	if err != nil {
+		return false, nil
+	}
+	_, member := d.members[courseID][userID]
+	return member || c.TeacherID == userID, nil
+}
+
+// IsCourseMember проверяет, записан ли пользователь на дисциплину
+func (m *Memory) IsCourseMember(userID, courseID int) (bool, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	if _, err := d.course(courseID); err != nil {
+		return false, nil
+	}
+	_, member := d.members[courseID][userID]
+	return member, nil
+}
+
+// IsCourseTeacher проверяет, ведёт ли пользователь дисциплину, в том числе удалённую
+func (m *Memory) IsCourseTeacher(userID, courseID int) (bool, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	c, ok := d.courses[courseID]
+	if !ok {
+		return false, nil
+	}
+	return c.TeacherID == userID || d.members[courseID][userID].role == "teacher", nil
+}
+
+// MemberCourses возвращает неудалённые дисциплины пользователя с его ролью
+func (m *Memory) MemberCourses(userID int) ([]MemberCourse, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	var courses []MemberCourse
+	for id, c := range d.courses {
+		if c.deletedAt != nil {
+			continue
+		}
+		member, ok := d.members[id][userID]
+		if !ok && c.TeacherID != userID {
+			continue
+		}
+		role := member.role
+		if !ok {
+			role = "teacher"
+		}
+		courses = append(courses, MemberCourse{Course: c.Course, Role: role})
+	}
+	sort.Slice(courses, func(i, j int) bool {
+		if courses[i].Name != courses[j].Name {
+			return courses[i].Name < courses[j].Name
+		}
+		return courses[i].ID < courses[j].ID
+	})
+	return courses, nil
+}
+
+// UpdateCourse меняет название и описание неудалённой дисциплины
+func (m *Memory) UpdateCourse(c *models.Course) error {
+	d, unlock := m.lock()
+	defer unlock()
+	stored, ok := d.courses[c.ID]
+	if !ok || stored.deletedAt != nil {
+		return ErrNotFound
+	}
+	stored.Name, stored.Description = c.Name, c.Description
+	d.courses[c.ID] = stored
+	*c = stored.Course
+	return nil
+}
+
+// DeleteCourse помечает удалённой дисциплину вместе с её неудалёнными тестами
+func (m *Memory) DeleteCourse(id int, at time.Time) error {
+	d, unlock := m.lock()
+	defer unlock()
+	c, ok := d.courses[id]
+	if !ok || c.deletedAt != nil {
+		return ErrNotFound
+	}
+	c.deletedAt = &at
+	d.courses[id] = c
+	for testID, t := range d.tests {
+		if t.CourseID == id && t.DeletedAt == nil {
+			t.DeletedAt, t.withCourse = &at, true
+			d.tests[testID] = t
+		}
+	}
+	return nil
+}
+
+// DeletedCourse возвращает удалённую дисциплину
+func (m *Memory) DeletedCourse(id int) (models.Course, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	c, ok := d.courses[id]
+	if !ok || c.deletedAt == nil {
+		return models.Course{}, ErrNotFound
+	}
+	return c.Course, nil
+}
+
+// RestoreCourse восстанавливает удалённую дисциплину и тесты, удалённые вместе с ней
+func (m *Memory) RestoreCourse(id int) (models.Course, error) {
+	d, unlock := m.lock()
+	defer unlock()
+	c, ok := d.courses[id]
+	if !ok || c.deletedAt == nil {
+		return models.Course{}, ErrNotFound
+	}
+	c.deletedAt = nil
+	d.courses[id] = c
+	for testID, t := range d.tests {
+		if t.CourseID == id && t.withCourse {
+			t.DeletedAt, t.withCourse = nil, false
+			d.tests[testID] = t
+		}
+	}
+	return c.Course, nil
+}
+
+// test возвращает неудалённый тест
+func (d *memoryData) test(id int) (models.Test, error) {
+	t, ok := d.tests[id]
+	if !ok || t.DeletedAt != nil {
+		return models.Test{}, ErrNotFound
+	}
+	return t.Test, nil
+}
+
+// Test возвращает неудалённый тест без списка вопросов
+func (m *Memory) Test(id int) (models.Test, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	return d.test(id)
+}
+
+// TestWithDeleted возвращает тест, в том числе удалённый
+func (m *Memory) TestWithDeleted(id int) (models.Test, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	t, ok := d.tests[id]
+	if !ok {
+		return models.Test{}, ErrNotFound
+	}
+	return t.Test, nil
+}
+
+// CourseTests возвращает страницу неудалённых тестов дисциплины по фильтру и курсор следующей страницы
+func (m *Memory) CourseTests(f TestFilter) ([]models.Test, *Cursor, error) {
+	if err := f.check(testSorts); err != nil {
+		return nil, nil, err
+	}
+	ids := make(map[int]bool, len(f.IDs))
+	for _, id := range f.IDs {
+		ids[id] = true
+	}
+	d, unlock := m.rlock()
+	defer unlock()
+	var tests []models.Test
+	var entries []listEntry
+	for _, t := range d.tests {
+		if t.CourseID != f.CourseID || t.DeletedAt != nil || (f.Kind != "" && t.Kind != f.Kind) || (f.Active != nil && t.Active != *f.Active) {
+			continue
+		}
+		if (len(ids) > 0 && !ids[t.ID]) || !f.matches(t.Name) || !f.inCreated(t.CreatedAt) {
+			continue
+		}
+		tests = append(tests, t.Test)
+		entries = append(entries, listEntry{id: t.ID, value: cursorValue(testSortValue(t.Test, f.Sort))})
+	}
+	indexes, next := f.page(entries)
+	page := make([]models.Test, 0, len(indexes))
+	for _, i := range indexes {
+		page = append(page, d.summarizeTest(tests[i]))
+	}
+	return page, next, nil
+}
+
+// summarizeTest заполняет ID вопросов, размер варианта и статистику попыток теста
+func (d *memoryData) summarizeTest(t models.Test) models.Test {
+	t.Questions = d.testQuestionIDs(t.ID)
+	for _, link := range d.links[t.ID] {
+		if q, ok := d.questions[link.questionID]; ok && q.DeletedAt == nil {
+			t.QuestionCount++
+			t.TotalPoints += link.points
+		}
+	}
+	for _, p := range d.pools[t.ID] {
+		t.QuestionCount += p.Count
+		t.TotalPoints += float64(p.Count) * p.Points
+	}
+	stats := &models.TestStats{}
+	participants := make(map[int]bool)
+	var sum float64
+	graded := 0
+	for _, a := range d.attempts {
+		if a.TestID != t.ID {
+			continue
+		}
+		stats.Attempts++
+		if a.Finished {
+			stats.FinishedAttempts++
+			if a.Percentage != nil {
+				sum += *a.Percentage
+				graded++
+			}
+		}
+		if a.UserID != 0 {
+			participants[a.UserID] = true
+		}
+	}
+	stats.Participants = len(participants)
+	if graded > 0 {
+		avg := sum / float64(graded)
+		stats.AvgPercentage = &avg
+	}
+	t.Stats = stats
+	return t
+}
+
+// AttemptedTest находит неудалённый тест с попытками пользователя по подстроке названия
+func (m *Memory) AttemptedTest(userID int, name string) (models.Test, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	attempted := make(map[int]bool)
+	for _, a := range d.attempts {
+		if a.UserID == userID {
+			attempted[a.TestID] = true
+		}
+	}
+	var found *models.Test
+	for _, t := range d.tests {
+		if t.DeletedAt != nil || !attempted[t.ID] || !strings.Contains(strings.ToLower(t.Name), strings.ToLower(name)) {
+			continue
+		}
+		if found == nil || t.CreatedAt.After(found.CreatedAt) || (t.CreatedAt.Equal(found.CreatedAt) && t.ID > found.ID) {
+			test := t.Test
+			found = &test
+		}
+	}
+	if found == nil {
+		return models.Test{}, ErrNotFound
+	}
+	return *found, nil
+}
+
+// testQuestionIDs возвращает ID неудалённых вопросов теста в порядке теста
+func (d *memoryData) testQuestionIDs(testID int) []int {
+	ids := []int{}
+	for _, link := range d.links[testID] {
+		if q, ok := d.questions[link.questionID]; ok && q.DeletedAt == nil {
+			ids = append(ids, link.questionID)
+		}
+	}
+	return ids
+}
+
+// TestQuestionIDs возвращает ID неудалённых вопросов теста в порядке теста
+func (m *Memory) TestQuestionIDs(testID int) ([]int, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	return d.testQuestionIDs(testID), nil
+}
+
+// CreateTest создаёт тест и заполняет t.ID
+func (m *Memory) CreateTest(t *models.Test) error {
+	d, unlock := m.lock()
+	defer unlock()
+	t.ID = d.nextID()
+	stored := *t
+	stored.Questions, stored.Stats = nil, nil
+	d.tests[t.ID] = memoryTest{Test: stored}
+	return nil
+}
+
+// updateTest меняет неудалённый тест через fn
+func (m *Memory) updateTest(id int, fn func(t *models.Test)) error {
+	d, unlock := m.lock()
+	defer unlock()
+	t, ok := d.tests[id]
+	if !ok || t.DeletedAt != nil {
+		return ErrNotFound
+	}
+	fn(&t.Test)
+	d.tests[id] = t
+	return nil
+}
+
+// UpdateTest сохраняет изменяемые настройки неудалённого теста
+func (m *Memory) UpdateTest(t *models.Test) error {
+	return m.updateTest(t.ID, func(stored *models.Test) {
+		stored.Name, stored.AllowReview = t.Name, t.AllowReview
+		stored.TimeLimit, stored.OpensAt, stored.ClosesAt = t.TimeLimit, t.OpensAt, t.ClosesAt
+		stored.MaxAttempts, stored.Cooldown, stored.GradingPolicy = t.MaxAttempts, t.Cooldown, t.GradingPolicy
+		stored.ShuffleQuestions, stored.ShuffleOptions = t.ShuffleQuestions, t.ShuffleOptions
+		*t = *stored
+	})
+}
+
+// SetTestActive открывает или закрывает тест и сообщает, изменилось ли состояние
+func (m *Memory) SetTestActive(id int, active bool) (bool, error) {
+	changed := false
+	err := m.updateTest(id, func(t *models.Test) {
+		changed = t.Active != active
+		t.Active = active
+	})
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return changed, err
+}
+
+// SetTestReview разрешает или запрещает разбор попыток
+func (m *Memory) SetTestReview(id int, allow bool) error {
+	return m.updateTest(id, func(t *models.Test) { t.AllowReview = allow })
+}
+
+// SetTestSchedule задаёт ограничение по времени и окно доступности
+func (m *Memory) SetTestSchedule(id int, timeLimit *int, opensAt, closesAt *time.Time) error {
+	return m.updateTest(id, func(t *models.Test) { t.TimeLimit, t.OpensAt, t.ClosesAt = timeLimit, opensAt, closesAt })
+}
+
+// SetTestPolicy задаёт ограничения на пересдачу и правило итоговой оценки
+func (m *Memory) SetTestPolicy(id int, maxAttempts, cooldown *int, policy string) error {
+	return m.updateTest(id, func(t *models.Test) { t.MaxAttempts, t.Cooldown, t.GradingPolicy = maxAttempts, cooldown, policy })
+}
+
+// SetTestShuffle задаёт перемешивание вопросов и вариантов
+func (m *Memory) SetTestShuffle(id int, questions, options bool) error {
+	return m.updateTest(id, func(t *models.Test) { t.ShuffleQuestions, t.ShuffleOptions = questions, options })
+}
+
+// DeleteTest помечает неудалённый тест удалённым
+func (m *Memory) DeleteTest(id int, at time.Time) error {
+	return m.updateTest(id, func(t *models.Test) { t.DeletedAt = &at })
+}
+
+// RestoreTest восстанавливает удалённый тест
+func (m *Memory) RestoreTest(id int) (models.Test, error) {
+	d, unlock := m.lock()
+	defer unlock()
+	t, ok := d.tests[id]
+	if !ok || t.DeletedAt == nil {
+		return models.Test{}, ErrNotFound
+	}
+	t.DeletedAt = nil
+	d.tests[id] = t
+	return t.Test, nil
+}
+
+// EnsureUser находит пользователя по внешнему идентификатору или создаёт его
+func (m *Memory) EnsureUser(ref, fullName string) (int, error) {
+	d, unlock := m.lock()
+	defer unlock()
+	if id, ok := d.refs[ref]; ok {
+		return id, nil
+	}
+	id := d.nextID()
+	d.refs[ref] = id
+	d.users[id] = memoryUser{ref: ref, fullName: fullName}
+	return id, nil
+}
+
+// UserExists проверяет, есть ли пользователь с таким ID
+func (m *Memory) UserExists(id int) (bool, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	_, ok := d.users[id]
+	return ok, nil
+}
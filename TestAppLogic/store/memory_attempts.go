@@ -0,0 +1,485 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"testapplogic/models"
+	"time"
+)
+
+// attempt возвращает попытку без варианта и ответов
+func (d *memoryData) attempt(id int) (models.Attempt, error) {
+	a, ok := d.attempts[id]
+	if !ok {
+		return models.Attempt{}, ErrNotFound
+	}
+	return a.Attempt, nil
+}
+
+// Attempt возвращает попытку без варианта и ответов
+func (m *Memory) Attempt(id int) (models.Attempt, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	return d.attempt(id)
+}
+
+// LockAttempt возвращает попытку. Транзакции Memory выполняются по одной,
+// поэтому отдельная блокировка не нужна
+func (m *Memory) LockAttempt(id int) (models.Attempt, error) {
+	return m.Attempt(id)
+}
+
+// LockUserTest ничего не делает: транзакции Memory выполняются по одной
+func (m *Memory) LockUserTest(testID, userID int) error {
+	return nil
+}
+
+// HasActiveAttempt проверяет, есть ли у пользователя незавершённая попытка по тесту
+func (m *Memory) HasActiveAttempt(userID, testID int) (bool, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	for _, a := range d.attempts {
+		if a.UserID == userID && a.TestID == testID && !a.Finished {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// AttemptUsage возвращает число попыток пользователя по тесту и время окончания последней
+func (m *Memory) AttemptUsage(userID, testID int) (int, *time.Time, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	used := 0
+	var last *time.Time
+	for _, a := range d.attempts {
+		if a.UserID != userID || a.TestID != testID {
+			continue
+		}
+		used++
+		end := a.CreatedAt
+		if a.CompletedAt != nil {
+			end = *a.CompletedAt
+		}
+		if last == nil || end.After(*last) {
+			last = &end
+		}
+	}
+	return used, last, nil
+}
+
+// CreateAttempt создаёт попытку и заполняет a.ID
+func (m *Memory) CreateAttempt(a *models.Attempt) error {
+	d, unlock := m.lock()
+	defer unlock()
+	a.ID = d.nextID()
+	stored := *a
+	stored.Questions, stored.Answers = nil, nil
+	d.attempts[a.ID] = memoryAttempt{Attempt: stored}
+	return nil
+}
+
+// SavePaper сохраняет вариант попытки в порядке показа
+func (m *Memory) SavePaper(attemptID int, paper []PaperQuestion) error {
+	d, unlock := m.lock()
+	defer unlock()
+	a, ok := d.attempts[attemptID]
+	if !ok {
+		return ErrNotFound
+	}
+	for _, item := range paper {
+		a.paper = append(a.paper, memoryPaperItem{
+			questionID: item.Question.ID,
+			version:    item.Question.Version,
+			points:     item.Question.Points,
+			order:      append([]int(nil), item.Order...),
+		})
+	}
+	d.attempts[attemptID] = a
+	return nil
+}
+
+// paperQuestion собирает вопрос варианта попытки из выпавшей версии
+func (d *memoryData) paperQuestion(a memoryAttempt, position int) PaperQuestion {
+	item := a.paper[position]
+	q := d.questions[item.questionID]
+	for _, v := range d.versions[item.questionID] {
+		if v.Version == item.version {
+			q.Type, q.Text, q.Options, q.Matches = v.Type, v.Text, v.Options, v.Matches
+			q.CorrectAnswer, q.Tags, q.Version = v.CorrectAnswer, v.Tags, v.Version
+		}
+	}
+	q.TestID, q.Position, q.Points = a.TestID, position+1, item.points
+	order := item.order
+	if len(order) == 0 || len(order) != len(q.Options) {
+		order = nil
+	}
+	return PaperQuestion{Question: q, Order: order}
+}
+
+// AttemptPaper возвращает вариант попытки в порядке показа
+func (m *Memory) AttemptPaper(attemptID int) ([]PaperQuestion, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	a := d.attempts[attemptID]
+	var paper []PaperQuestion
+	for i := range a.paper {
+		paper = append(paper, d.paperQuestion(a, i))
+	}
+	return paper, nil
+}
+
+// attemptPaperQuestion возвращает вопрос варианта попытки
+func (d *memoryData) attemptPaperQuestion(attemptID, questionID int) (PaperQuestion, error) {
+	a := d.attempts[attemptID]
+	for i, item := range a.paper {
+		if item.questionID == questionID {
+			return d.paperQuestion(a, i), nil
+		}
+	}
+	return PaperQuestion{}, ErrNotFound
+}
+
+// PaperQuestion возвращает вопрос варианта попытки
+func (m *Memory) PaperQuestion(attemptID, questionID int) (PaperQuestion, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	return d.attemptPaperQuestion(attemptID, questionID)
+}
+
+// ActivePaperQuestion находит вопрос в варианте последней незавершённой попытки пользователя
+func (m *Memory) ActivePaperQuestion(userID, questionID int) (PaperQuestion, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	var latest *models.Attempt
+	for _, a := range d.attempts {
+		if a.UserID != userID || a.Finished || !a.hasQuestion(questionID) {
+			continue
+		}
+		if latest == nil || a.CreatedAt.After(latest.CreatedAt) || (a.CreatedAt.Equal(latest.CreatedAt) && a.ID > latest.ID) {
+			attempt := a.Attempt
+			latest = &attempt
+		}
+	}
+	if latest == nil {
+		return PaperQuestion{}, ErrNotFound
+	}
+	return d.attemptPaperQuestion(latest.ID, questionID)
+}
+
+// hasQuestion проверяет, есть ли вопрос в варианте попытки
+func (a memoryAttempt) hasQuestion(questionID int) bool {
+	for _, item := range a.paper {
+		if item.questionID == questionID {
+			return true
+		}
+	}
+	return false
+}
+
+// HasQuestionAttempt проверяет, выпадал ли вопрос пользователю в одной из его попыток
+func (m *Memory) HasQuestionAttempt(userID, questionID int) (bool, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	for _, a := range d.attempts {
+		if a.UserID == userID && a.hasQuestion(questionID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ActivePaper возвращает ID вопросов варианта незавершённой попытки пользователя по тесту
+func (m *Memory) ActivePaper(userID, testID int) ([]int, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	for _, a := range d.attempts {
+		if a.UserID != userID || a.TestID != testID || a.Finished {
+			continue
+		}
+		ids := make([]int, len(a.paper))
+		for i, item := range a.paper {
+			ids[i] = item.questionID
+		}
+		return ids, nil
+	}
+	return nil, nil
+}
+
+// attemptAnswers возвращает текущие ответы попытки по возрастанию ID вопроса
+func (d *memoryData) attemptAnswers(attemptID int) []models.Answer {
+	var answers []models.Answer
+	for _, ans := range d.answers {
+		if ans.AttemptID == attemptID {
+			answers = append(answers, ans)
+		}
+	}
+	sort.Slice(answers, func(i, j int) bool { return answers[i].QuestionID < answers[j].QuestionID })
+	return answers
+}
+
+// AttemptProgress возвращает число вопросов варианта и число вопросов с ответом
+func (m *Memory) AttemptProgress(attemptID int) (total, answered int, err error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	a := d.attempts[attemptID]
+	for _, ans := range d.attemptAnswers(attemptID) {
+		if a.hasQuestion(ans.QuestionID) {
+			answered++
+		}
+	}
+	return len(a.paper), answered, nil
+}
+
+// AttemptAnswers возвращает текущие ответы попытки по возрастанию ID вопроса
+func (m *Memory) AttemptAnswers(attemptID int) ([]models.Answer, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	return d.attemptAnswers(attemptID), nil
+}
+
+// SaveAnswer сохраняет текущий ответ на вопрос попытки и записывает его версию в историю
+func (m *Memory) SaveAnswer(attemptID, questionID int, answer json.RawMessage, at time.Time) (models.Answer, error) {
+	d, unlock := m.lock()
+	defer unlock()
+	ans := models.Answer{AttemptID: attemptID, QuestionID: questionID, Answer: answer, Revision: 1, CreatedAt: at, UpdatedAt: at}
+	for _, stored := range d.answers {
+		if stored.AttemptID != attemptID || stored.QuestionID != questionID {
+			continue
+		}
+		if bytes.Equal(stored.Answer, answer) {
+			return stored, nil
+		}
+		ans.ID, ans.Revision, ans.CreatedAt = stored.ID, stored.Revision+1, stored.CreatedAt
+	}
+	if ans.ID == 0 {
+		ans.ID = d.nextID()
+	}
+	d.answers[ans.ID] = ans
+	d.revisions[ans.ID] = append(d.revisions[ans.ID], models.AnswerRevision{
+		AnswerID:   ans.ID,
+		QuestionID: questionID,
+		Revision:   ans.Revision,
+		Answer:     answer,
+		CreatedAt:  at,
+	})
+	return ans, nil
+}
+
+// AnswerRevisions возвращает историю ответов попытки по вопросам и версиям
+func (m *Memory) AnswerRevisions(attemptID, questionID int) ([]models.AnswerRevision, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	var history []models.AnswerRevision
+	for _, ans := range d.attemptAnswers(attemptID) {
+		if questionID == 0 || ans.QuestionID == questionID {
+			history = append(history, d.revisions[ans.ID]...)
+		}
+	}
+	return history, nil
+}
+
+// SetAnswerCorrect сохраняет результат проверки ответа
+func (m *Memory) SetAnswerCorrect(answerID int, correct bool) error {
+	d, unlock := m.lock()
+	defer unlock()
+	if ans, ok := d.answers[answerID]; ok {
+		ans.IsCorrect = &correct
+		d.answers[answerID] = ans
+	}
+	return nil
+}
+
+// updateAttempt меняет попытку через fn
+func (m *Memory) updateAttempt(id int, fn func(a *models.Attempt)) error {
+	d, unlock := m.lock()
+	defer unlock()
+	if a, ok := d.attempts[id]; ok {
+		fn(&a.Attempt)
+		d.attempts[id] = a
+	}
+	return nil
+}
+
+// SaveAttemptResult завершает попытку с баллами и временем из r
+func (m *Memory) SaveAttemptResult(r *models.AttemptResult) error {
+	score, maxScore, percentage, completedAt := r.Score, r.MaxScore, r.Percentage, r.CompletedAt
+	return m.updateAttempt(r.AttemptID, func(a *models.Attempt) {
+		a.Finished = true
+		a.Score, a.MaxScore, a.Percentage, a.CompletedAt = &score, &maxScore, &percentage, &completedAt
+	})
+}
+
+// FinishAttempt завершает попытку без оценки
+func (m *Memory) FinishAttempt(attemptID int, at time.Time) error {
+	return m.updateAttempt(attemptID, func(a *models.Attempt) {
+		a.Finished, a.CompletedAt = true, &at
+	})
+}
+
+// FinishAnonymousAttempt завершает попытку анонимного опроса: отвязывает её от пользователя,
+// огрубляет время попытки и ответов до дня и удаляет историю ответов
+func (m *Memory) FinishAnonymousAttempt(attemptID int) error {
+	d, unlock := m.lock()
+	defer unlock()
+	a, ok := d.attempts[attemptID]
+	if !ok {
+		return nil
+	}
+	a.Finished, a.UserID, a.CreatedAt = true, 0, truncateDay(a.CreatedAt)
+	d.attempts[attemptID] = a
+	for id, ans := range d.answers {
+		if ans.AttemptID != attemptID {
+			continue
+		}
+		ans.CreatedAt, ans.UpdatedAt, ans.Revision = truncateDay(ans.CreatedAt), truncateDay(ans.UpdatedAt), 1
+		d.answers[id] = ans
+		delete(d.revisions, id)
+	}
+	return nil
+}
+
+// truncateDay отбрасывает время суток, как date_trunc('day', ...)
+func truncateDay(t time.Time) time.Time {
+	y, mo, day := t.Date()
+	return time.Date(y, mo, day, 0, 0, 0, 0, t.Location())
+}
+
+// ExpiredAttempt возвращает ID незавершённой попытки с истёкшим временем
+func (m *Memory) ExpiredAttempt(now time.Time, skip []int) (int, error) {
+	skipped := make(map[int]bool, len(skip))
+	for _, id := range skip {
+		skipped[id] = true
+	}
+	d, unlock := m.rlock()
+	defer unlock()
+	var expired *models.Attempt
+	for id, a := range d.attempts {
+		if a.Finished || a.ExpiresAt == nil || a.ExpiresAt.After(now) || skipped[id] {
+			continue
+		}
+		if expired == nil || a.ExpiresAt.Before(*expired.ExpiresAt) {
+			attempt := a.Attempt
+			expired = &attempt
+		}
+	}
+	if expired == nil {
+		return 0, nil
+	}
+	return expired.ID, nil
+}
+
+// sortByCompletion упорядочивает попытки по времени завершения, незавершённые последними
+func sortByCompletion(attempts []models.Attempt) {
+	sort.Slice(attempts, func(i, j int) bool {
+		a, b := attempts[i], attempts[j]
+		switch {
+		case a.CompletedAt == nil && b.CompletedAt == nil:
+		case a.CompletedAt == nil:
+			return false
+		case b.CompletedAt == nil:
+			return true
+		case !a.CompletedAt.Equal(*b.CompletedAt):
+			return a.CompletedAt.Before(*b.CompletedAt)
+		}
+		return a.ID < b.ID
+	})
+}
+
+// GradedAttempts возвращает оценённые попытки пользователя по тесту в порядке завершения
+func (m *Memory) GradedAttempts(userID, testID int) ([]models.Attempt, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	var attempts []models.Attempt
+	for _, a := range d.attempts {
+		if a.UserID == userID && a.TestID == testID && a.Finished && a.Score != nil {
+			attempts = append(attempts, a.Attempt)
+		}
+	}
+	sortByCompletion(attempts)
+	return attempts, nil
+}
+
+// StudentAttempts возвращает попытки студентов дисциплины по её тестам с проверкой ответов
+func (m *Memory) StudentAttempts(courseID int) ([]models.Attempt, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	var attempts []models.Attempt
+	for _, a := range d.attempts {
+		t, ok := d.tests[a.TestID]
+		if !ok || t.CourseID != courseID || t.Kind != models.TestKindQuiz || d.members[courseID][a.UserID].role != "student" {
+			continue
+		}
+		attempts = append(attempts, a.Attempt)
+	}
+	sortByCompletion(attempts)
+	return attempts, nil
+}
+
+// FinishedAttempts возвращает завершённые попытки теста с ответами и вариантами
+func (m *Memory) FinishedAttempts(testID int) ([]AttemptAnswers, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	var result []AttemptAnswers
+	for _, a := range d.attempts {
+		if a.TestID != testID || !a.Finished {
+			continue
+		}
+		answers := d.attemptAnswers(a.ID)
+		sort.Slice(answers, func(i, j int) bool {
+			if !answers[i].CreatedAt.Equal(answers[j].CreatedAt) {
+				return answers[i].CreatedAt.Before(answers[j].CreatedAt)
+			}
+			return answers[i].ID < answers[j].ID
+		})
+		presented := make([]int, len(a.paper))
+		for i, item := range a.paper {
+			presented[i] = item.questionID
+		}
+		result = append(result, AttemptAnswers{Attempt: a.Attempt, Answers: answers, Presented: presented})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Attempt.ID < result[j].Attempt.ID })
+	return result, nil
+}
+
+// EachTestAttempt передаёт fn попытки теста по возрастанию ID. Попытки копируются
+// под блокировкой, а fn вызывается без неё
+func (m *Memory) EachTestAttempt(testID int, fn func(AttemptExport) error) error {
+	d, unlock := m.rlock()
+	var exports []AttemptExport
+	for _, a := range d.attempts {
+		if a.TestID != testID {
+			continue
+		}
+		u := d.users[a.UserID]
+		exports = append(exports, AttemptExport{Attempt: a.Attempt, UserRef: u.ref, FullName: u.fullName, Answers: d.attemptAnswers(a.ID)})
+	}
+	unlock()
+	sort.Slice(exports, func(i, j int) bool { return exports[i].Attempt.ID < exports[j].Attempt.ID })
+	for _, e := range exports {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HasSurveyResponse проверяет, проходил ли пользователь опрос
+func (m *Memory) HasSurveyResponse(testID, userID int) (bool, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	_, ok := d.participants[memoryParticipant{testID: testID, userID: userID}]
+	return ok, nil
+}
+
+// AddSurveyParticipant отмечает, что пользователь прошёл опрос
+func (m *Memory) AddSurveyParticipant(testID, userID int, at time.Time) error {
+	d, unlock := m.lock()
+	defer unlock()
+	key := memoryParticipant{testID: testID, userID: userID}
+	if _, ok := d.participants[key]; !ok {
+		d.participants[key] = at
+	}
+	return nil
+}
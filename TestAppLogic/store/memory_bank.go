@@ -0,0 +1,307 @@
+package store
+
+import (
+	"sort"
+	"testapplogic/models"
+	"time"
+)
+
+// Question возвращает текущую версию вопроса, в том числе удалённого
+func (m *Memory) Question(id int) (models.Question, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	q, ok := d.questions[id]
+	if !ok {
+		return q, ErrNotFound
+	}
+	return q, nil
+}
+
+// CourseQuestions возвращает страницу неудалённых вопросов банка дисциплины по фильтру
+// и курсор следующей страницы
+func (m *Memory) CourseQuestions(f QuestionFilter) ([]models.Question, *Cursor, error) {
+	if err := f.check(questionSorts); err != nil {
+		return nil, nil, err
+	}
+	d, unlock := m.rlock()
+	defer unlock()
+	var questions []models.Question
+	var entries []listEntry
+	for _, q := range d.questions {
+		if q.CourseID != f.CourseID || q.DeletedAt != nil || (f.Type != "" && q.Type != f.Type) || (f.Kind != "" && q.Kind != f.Kind) {
+			continue
+		}
+		if !f.matches(q.Text) || !f.inCreated(q.CreatedAt) || !hasTags(q.Tags, f.Tags) {
+			continue
+		}
+		questions = append(questions, q)
+		entries = append(entries, listEntry{id: q.ID, value: cursorValue(questionSortValue(q, f.Sort))})
+	}
+	indexes, next := f.page(entries)
+	page := make([]models.Question, 0, len(indexes))
+	for _, i := range indexes {
+		page = append(page, questions[i])
+	}
+	return page, next, nil
+}
+
+// hasTags проверяет, что среди тегов вопроса есть все искомые
+func hasTags(tags, want []string) bool {
+	for _, w := range want {
+		if !hasTag(tags, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasTag проверяет, есть ли тег среди тегов вопроса
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// addVersion сохраняет содержимое вопроса как версию q.Version
+func (d *memoryData) addVersion(q models.Question, createdAt time.Time) {
+	d.versions[q.ID] = append(d.versions[q.ID], models.QuestionVersion{
+		QuestionID:    q.ID,
+		Version:       q.Version,
+		Type:          q.Type,
+		Text:          q.Text,
+		Options:       q.Options,
+		Matches:       q.Matches,
+		CorrectAnswer: q.CorrectAnswer,
+		Tags:          q.Tags,
+		CreatedAt:     createdAt,
+	})
+}
+
+// CreateQuestion сохраняет вопрос в банке первой версией
+func (m *Memory) CreateQuestion(q *models.Question) error {
+	d, unlock := m.lock()
+	defer unlock()
+	q.ID, q.Version = d.nextID(), 1
+	stored := *q
+	stored.TestID, stored.Position, stored.Points = 0, 0, 0
+	d.questions[q.ID] = stored
+	d.addVersion(stored, q.CreatedAt)
+	return nil
+}
+
+// LockQuestion возвращает неудалённый вопрос. Транзакции Memory выполняются по одной,
+// поэтому отдельная блокировка не нужна
+func (m *Memory) LockQuestion(id int) (models.Question, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	q, ok := d.questions[id]
+	if !ok || q.DeletedAt != nil {
+		return models.Question{}, ErrNotFound
+	}
+	return q, nil
+}
+
+// UpdateQuestion сохраняет содержимое q как новую версию вопроса
+func (m *Memory) UpdateQuestion(q *models.Question) error {
+	d, unlock := m.lock()
+	defer unlock()
+	stored, ok := d.questions[q.ID]
+	if !ok || stored.DeletedAt != nil {
+		return ErrNotFound
+	}
+	stored.Type, stored.Text, stored.Options, stored.Matches = q.Type, q.Text, q.Options, q.Matches
+	stored.CorrectAnswer, stored.Tags = q.CorrectAnswer, q.Tags
+	stored.Version++
+	d.questions[q.ID] = stored
+	d.addVersion(stored, time.Now())
+	*q = stored
+	return nil
+}
+
+// DeleteQuestion помечает неудалённый вопрос удалённым
+func (m *Memory) DeleteQuestion(id int, at time.Time) error {
+	d, unlock := m.lock()
+	defer unlock()
+	q, ok := d.questions[id]
+	if !ok || q.DeletedAt != nil {
+		return ErrNotFound
+	}
+	q.DeletedAt = &at
+	d.questions[id] = q
+	return nil
+}
+
+// RestoreQuestion восстанавливает удалённый вопрос
+func (m *Memory) RestoreQuestion(id int) (models.Question, error) {
+	d, unlock := m.lock()
+	defer unlock()
+	q, ok := d.questions[id]
+	if !ok || q.DeletedAt == nil {
+		return models.Question{}, ErrNotFound
+	}
+	q.DeletedAt = nil
+	d.questions[id] = q
+	return q, nil
+}
+
+// QuestionVersions возвращает версии вопроса от первой к последней
+func (m *Memory) QuestionVersions(id int) ([]models.QuestionVersion, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	return append([]models.QuestionVersion(nil), d.versions[id]...), nil
+}
+
+// BankQuestionID находит неудалённый вопрос банка с тем же видом, типом и текстом
+func (m *Memory) BankQuestionID(courseID int, kind, questionType, text string) (int, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	found := 0
+	for id, q := range d.questions {
+		if q.CourseID != courseID || q.Kind != kind || q.Type != questionType || q.Text != text || q.DeletedAt != nil {
+			continue
+		}
+		if found == 0 || id < found {
+			found = id
+		}
+	}
+	if found == 0 {
+		return 0, ErrNotFound
+	}
+	return found, nil
+}
+
+// PoolCandidates возвращает неудалённые вопросы банка с хотя бы одним из тегов, кроме exclude
+func (m *Memory) PoolCandidates(courseID int, kind string, tags []string, exclude []int) ([]models.Question, error) {
+	skip := make(map[int]bool, len(exclude))
+	for _, id := range exclude {
+		skip[id] = true
+	}
+	d, unlock := m.rlock()
+	defer unlock()
+	var questions []models.Question
+	for id, q := range d.questions {
+		if q.CourseID != courseID || q.Kind != kind || q.DeletedAt != nil || skip[id] {
+			continue
+		}
+		for _, tag := range tags {
+			if hasTag(q.Tags, tag) {
+				questions = append(questions, q)
+				break
+			}
+		}
+	}
+	sort.Slice(questions, func(i, j int) bool { return questions[i].ID < questions[j].ID })
+	return questions, nil
+}
+
+// PresentedQuestions возвращает вопросы, которые выдавались по тесту
+func (m *Memory) PresentedQuestions(testID int) ([]models.Question, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	var questions []models.Question
+	seen := make(map[int]bool)
+	for _, link := range d.links[testID] {
+		if q := d.questions[link.questionID]; q.DeletedAt == nil {
+			questions = append(questions, q)
+			seen[q.ID] = true
+		}
+	}
+	var drawn []models.Question
+	for _, a := range d.attempts {
+		if a.TestID != testID {
+			continue
+		}
+		for _, item := range a.paper {
+			if !seen[item.questionID] {
+				drawn = append(drawn, d.questions[item.questionID])
+				seen[item.questionID] = true
+			}
+		}
+	}
+	sort.Slice(drawn, func(i, j int) bool { return drawn[i].ID < drawn[j].ID })
+	return append(questions, drawn...), nil
+}
+
+// TestQuestions возвращает неудалённые вопросы теста в порядке теста с позициями и весами
+func (m *Memory) TestQuestions(testID int) ([]models.Question, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	var questions []models.Question
+	for i, link := range d.links[testID] {
+		q := d.questions[link.questionID]
+		if q.DeletedAt != nil {
+			continue
+		}
+		q.TestID, q.Position, q.Points = testID, i+1, link.points
+		questions = append(questions, q)
+	}
+	return questions, nil
+}
+
+// LinkQuestion добавляет вопрос банка в тест на позицию position и сдвигает следующие вопросы
+func (m *Memory) LinkQuestion(testID, questionID, position int, points float64) (int, error) {
+	d, unlock := m.lock()
+	defer unlock()
+	links := d.links[testID]
+	for _, link := range links {
+		if link.questionID == questionID {
+			return 0, ErrQuestionLinked
+		}
+	}
+	if position <= 0 || position > len(links) {
+		position = len(links) + 1
+	}
+	updated := make([]memoryLink, 0, len(links)+1)
+	updated = append(updated, links[:position-1]...)
+	updated = append(updated, memoryLink{questionID: questionID, points: points})
+	d.links[testID] = append(updated, links[position-1:]...)
+	return position, nil
+}
+
+// SetTestQuestions задаёт состав теста целиком в порядке questions
+func (m *Memory) SetTestQuestions(testID int, questions []TestQuestion) error {
+	d, unlock := m.lock()
+	defer unlock()
+	links := make([]memoryLink, len(questions))
+	for i, tq := range questions {
+		links[i] = memoryLink{questionID: tq.QuestionID, points: tq.Points}
+	}
+	d.links[testID] = links
+	return nil
+}
+
+// UnlinkQuestion убирает вопрос из теста и сдвигает следующие вопросы
+func (m *Memory) UnlinkQuestion(testID, questionID int) error {
+	d, unlock := m.lock()
+	defer unlock()
+	links := d.links[testID]
+	for i, link := range links {
+		if link.questionID == questionID {
+			updated := append([]memoryLink(nil), links[:i]...)
+			d.links[testID] = append(updated, links[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// TestPools возвращает пулы теста
+func (m *Memory) TestPools(testID int) ([]models.QuestionPool, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	return append([]models.QuestionPool(nil), d.pools[testID]...), nil
+}
+
+// SetTestPools заменяет пулы теста и заполняет их ID
+func (m *Memory) SetTestPools(testID int, pools []models.QuestionPool) error {
+	d, unlock := m.lock()
+	defer unlock()
+	for i := range pools {
+		pools[i].ID, pools[i].TestID = d.nextID(), testID
+	}
+	d.pools[testID] = append([]models.QuestionPool(nil), pools...)
+	return nil
+}
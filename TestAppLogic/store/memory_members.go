@@ -0,0 +1,130 @@
+package store
+
+import (
+	"sort"
+	"testapplogic/models"
+	"time"
+)
+
+// CourseMembers возвращает участников дисциплины: сначала преподавателей, затем студентов
+func (m *Memory) CourseMembers(courseID int, role string) ([]models.CourseMember, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	var members []models.CourseMember
+	for userID, member := range d.members[courseID] {
+		if role != "" && member.role != role {
+			continue
+		}
+		u := d.users[userID]
+		members = append(members, models.CourseMember{
+			UserID:    userID,
+			UserRef:   u.ref,
+			FullName:  u.fullName,
+			Role:      member.role,
+			CreatedAt: member.createdAt,
+		})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		a, b := members[i], members[j]
+		if a.Role != b.Role {
+			return a.Role > b.Role
+		}
+		if a.FullName != b.FullName {
+			return a.FullName < b.FullName
+		}
+		return a.UserID < b.UserID
+	})
+	return members, nil
+}
+
+// EnrollUser записывает пользователя на дисциплину; false — он уже записан
+func (m *Memory) EnrollUser(userID, courseID int, role string) (bool, error) {
+	d, unlock := m.lock()
+	defer unlock()
+	if _, ok := d.members[courseID][userID]; ok {
+		return false, nil
+	}
+	if d.members[courseID] == nil {
+		d.members[courseID] = make(map[int]memoryMember)
+	}
+	d.members[courseID][userID] = memoryMember{role: role, createdAt: time.Now()}
+	return true, nil
+}
+
+// RemoveCourseMember исключает пользователя из дисциплины
+func (m *Memory) RemoveCourseMember(userID, courseID int) error {
+	d, unlock := m.lock()
+	defer unlock()
+	if _, ok := d.members[courseID][userID]; !ok {
+		return ErrNotFound
+	}
+	delete(d.members[courseID], userID)
+	return nil
+}
+
+// CreateInvite сохраняет код приглашения
+func (m *Memory) CreateInvite(inv *models.CourseInvite) error {
+	d, unlock := m.lock()
+	defer unlock()
+	d.invites[inv.Code] = *inv
+	return nil
+}
+
+// CourseInvites возвращает коды приглашения дисциплины, новые первыми
+func (m *Memory) CourseInvites(courseID int) ([]models.CourseInvite, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	var invites []models.CourseInvite
+	for _, inv := range d.invites {
+		if inv.CourseID == courseID {
+			invites = append(invites, inv)
+		}
+	}
+	sort.Slice(invites, func(i, j int) bool {
+		a, b := invites[i], invites[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.Code < b.Code
+	})
+	return invites, nil
+}
+
+// DeleteInvite отзывает код приглашения дисциплины
+func (m *Memory) DeleteInvite(courseID int, code string) error {
+	d, unlock := m.lock()
+	defer unlock()
+	if inv, ok := d.invites[code]; !ok || inv.CourseID != courseID {
+		return ErrNotFound
+	}
+	delete(d.invites, code)
+	return nil
+}
+
+// LockInvite возвращает приглашение на неудалённую дисциплину. Транзакции Memory
+// выполняются по одной, поэтому отдельная блокировка не нужна
+func (m *Memory) LockInvite(code string) (models.CourseInvite, error) {
+	d, unlock := m.rlock()
+	defer unlock()
+	inv, ok := d.invites[code]
+	if !ok {
+		return models.CourseInvite{}, ErrNotFound
+	}
+	if _, err := d.course(inv.CourseID); err != nil {
+		return models.CourseInvite{}, ErrNotFound
+	}
+	return inv, nil
+}
+
+// UseInvite засчитывает использование приглашения
+func (m *Memory) UseInvite(code string) error {
+	d, unlock := m.lock()
+	defer unlock()
+	inv, ok := d.invites[code]
+	if !ok {
+		return ErrNotFound
+	}
+	inv.Uses++
+	d.invites[code] = inv
+	return nil
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"sort"
+	"testapplogic/models"
+	"time"
+)
+
+// notify создаёт уведомление для пользователя
+func (d *memoryData) notify(userID int, kind, message string, at time.Time) {
+	id := d.nextID()
+	d.notifications[id] = memoryNotification{Notification: models.Notification{
+		ID:        id,
+		UserID:    userID,
+		Type:      kind,
+		Message:   message,
+		CreatedAt: at,
+	}}
+}
+
+// Notify создаёт уведомление для пользователя
+func (m *Memory) Notify(userID int, kind, message string) error {
+	d, unlock := m.lock()
+	defer unlock()
+	d.notify(userID, kind, message, time.Now())
+	return nil
+}
+
+// NotifyCourseStudents создаёт уведомление для всех студентов дисциплины
+func (m *Memory) NotifyCourseStudents(courseID int, kind, message string) error {
+	d, unlock := m.lock()
+	defer unlock()
+	var students []int
+	for userID, member := range d.members[courseID] {
+		if member.role == "student" {
+			students = append(students, userID)
+		}
+	}
+	sort.Ints(students)
+	now := time.Now()
+	for _, userID := range students {
+		d.notify(userID, kind, message, now)
+	}
+	return nil
+}
+
+// DeliverNotifications возвращает старейшие непрочитанные уведомления пользователя
+// и отмечает их доставленными
+func (m *Memory) DeliverNotifications(userID, limit int) ([]models.Notification, error) {
+	d, unlock := m.lock()
+	defer unlock()
+	var unread []memoryNotification
+	for _, n := range d.notifications {
+		if n.UserID == userID && !n.IsRead {
+			unread = append(unread, n)
+		}
+	}
+	sort.Slice(unread, func(i, j int) bool {
+		a, b := unread[i], unread[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+	if len(unread) > limit {
+		unread = unread[:limit]
+	}
+	var notifications []models.Notification
+	for _, n := range unread {
+		n.delivered = true
+		d.notifications[n.ID] = n
+		notifications = append(notifications, n.Notification)
+	}
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].ID < notifications[j].ID })
+	return notifications, nil
+}
+
+// ReadNotifications отмечает прочитанными уведомления из ids или все доставленные
+func (m *Memory) ReadNotifications(userID int, ids []int) (int, error) {
+	d, unlock := m.lock()
+	defer unlock()
+	selected := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+	now := time.Now()
+	read := 0
+	for id, n := range d.notifications {
+		if n.UserID != userID || n.IsRead {
+			continue
+		}
+		if (len(ids) > 0 && !selected[id]) || (len(ids) == 0 && !n.delivered) {
+			continue
+		}
+		n.IsRead, n.readAt = true, &now
+		d.notifications[id] = n
+		read++
+	}
+	return read, nil
+}
+
+// ReadNotification отмечает прочитанным одно уведомление пользователя
+func (m *Memory) ReadNotification(userID, id int) error {
+	d, unlock := m.lock()
+	defer unlock()
+	n, ok := d.notifications[id]
+	if !ok || n.UserID != userID {
+		return ErrNotFound
+	}
+	if n.readAt == nil {
+		now := time.Now()
+		n.readAt = &now
+	}
+	n.IsRead = true
+	d.notifications[id] = n
+	return nil
+}
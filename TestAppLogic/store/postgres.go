@@ -0,0 +1,668 @@
+package store
+
+import (
+	"database/sql"
+	"testapplogic/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Postgres реализует Store поверх PostgreSQL. Хранилище, полученное из Begin,
+// выполняет все запросы в своей транзакции
+type Postgres struct {
+	DB *sql.DB
+	tx *sql.Tx
+}
+
+var (
+	_ Store = (*Postgres)(nil)
+	_ Tx    = (*postgresTx)(nil)
+)
+
+// queryer объединяет методы *sql.DB и *sql.Tx, через которые выполняются запросы
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// NewPostgres создаёт хранилище поверх открытого подключения
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{DB: db}
+}
+
+// conn возвращает транзакцию хранилища или, вне транзакции, само подключение
+func (p *Postgres) conn() queryer {
+	if p.tx != nil {
+		return p.tx
+	}
+	return p.DB
+}
+
+// Begin начинает транзакцию
+func (p *Postgres) Begin() (Tx, error) {
+	if p.tx != nil {
+		return nil, ErrNestedTx
+	}
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &postgresTx{&Postgres{DB: p.DB, tx: tx}}, nil
+}
+
+// atomic выполняет fn в транзакции: в уже начатой или, вне транзакции, в отдельной.
+// Нужна методам, которые меняют несколько таблиц
+func (p *Postgres) atomic(fn func(p *Postgres) error) error {
+	if p.tx != nil {
+		return fn(p)
+	}
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(&Postgres{DB: p.DB, tx: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// postgresTx — хранилище внутри транзакции PostgreSQL
+type postgresTx struct {
+	*Postgres
+}
+
+// Commit фиксирует транзакцию
+func (t *postgresTx) Commit() error {
+	return t.tx.Commit()
+}
+
+// Rollback откатывает транзакцию; после Commit ничего не делает
+func (t *postgresTx) Rollback() error {
+	if err := t.tx.Rollback(); err != sql.ErrTxDone {
+		return err
+	}
+	return nil
+}
+
+// Ping проверяет подключение к БД
+func (p *Postgres) Ping() error {
+	var status string
+	return p.conn().QueryRow("SELECT 'ok'").Scan(&status)
+}
+
+// courseSorts — ключи сортировки дисциплин
+var courseSorts = map[string]sortColumn{
+	"id":         {"c.id", ""},
+	"name":       {"c.name", "text"},
+	"created_at": {"c.created_at", "timestamp"},
+}
+
+// Courses возвращает страницу неудалённых дисциплин по фильтру и курсор следующей страницы
+func (p *Postgres) Courses(f CourseFilter) ([]models.Course, *Cursor, error) {
+	if err := f.check(courseSorts); err != nil {
+		return nil, nil, err
+	}
+	args := []interface{}{f.MemberID, f.TeacherID, likePattern(f.Query)}
+	created, args := f.createdArgs("c.created_at", args)
+	tail, args := f.keyset(courseSorts, "c.id", args)
+	courses, err := p.queryCourses(`
+		SELECT c.id, c.name, c.description, c.teacher_id, c.created_at
+		FROM courses c
+		WHERE c.deleted_at IS NULL
+			AND ($1 = 0 OR c.teacher_id = $1
+				OR EXISTS(SELECT 1 FROM user_courses uc WHERE uc.user_id = $1 AND uc.course_id = c.id))
+			AND ($2 = 0 OR c.teacher_id = $2)
+			AND ($3 = '' OR c.name ILIKE $3 ESCAPE '\' OR c.description ILIKE $3 ESCAPE '\')
+	`+created+tail, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	n, next := f.nextCursor(len(courses),
+		func(i int) int { return courses[i].ID },
+		func(i int) interface{} { return courseSortValue(courses[i], f.Sort) })
+	return courses[:n], next, nil
+}
+
+// queryCourses выполняет запрос списка дисциплин
+func (p *Postgres) queryCourses(query string, args ...interface{}) ([]models.Course, error) {
+	rows, err := p.conn().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var courses []models.Course
+	for rows.Next() {
+		var c models.Course
+		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.TeacherID, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		courses = append(courses, c)
+	}
+	return courses, rows.Err()
+}
+
+// Course возвращает неудалённую дисциплину
+func (p *Postgres) Course(id int) (models.Course, error) {
+	var c models.Course
+	err := p.conn().QueryRow(`
+		SELECT id, name, description, teacher_id, created_at
+		FROM courses
+		WHERE id = $1 AND deleted_at IS NULL
+	`, id).Scan(&c.ID, &c.Name, &c.Description, &c.TeacherID, &c.CreatedAt)
+	if err == sql.ErrNoRows {
+		return c, ErrNotFound
+	}
+	return c, err
+}
+
+// CreateCourse создаёт дисциплину и записывает на неё преподавателя
+func (p *Postgres) CreateCourse(c *models.Course) error {
+	return p.atomic(func(p *Postgres) error {
+		err := p.tx.QueryRow(`
+			INSERT INTO courses (name, description, teacher_id, created_at)
+			VALUES ($1, $2, $3, $4) RETURNING id
+		`, c.Name, c.Description, c.TeacherID, c.CreatedAt).Scan(&c.ID)
+		if err != nil {
+			return err
+		}
+		_, err = p.tx.Exec(`
+			INSERT INTO user_courses (user_id, course_id, role, created_at)
+			VALUES ($1, $2, 'teacher', $3)
+		`, c.TeacherID, c.ID, c.CreatedAt)
+		return err
+	})
+}
+
+// HasCourseAccess проверяет, ведёт ли пользователь дисциплину или записан на неё
+func (p *Postgres) HasCourseAccess(userID, courseID int) (bool, error) {
+	var exists bool
+	err := p.conn().QueryRow(`
+		SELECT (EXISTS(
+			SELECT 1 FROM user_courses
+			WHERE user_id = $1 AND course_id = $2
+		) OR EXISTS(
+			SELECT 1 FROM courses
+			WHERE id = $2 AND teacher_id = $1
+		)) AND EXISTS(
+			SELECT 1 FROM courses
+			WHERE id = $2 AND deleted_at IS NULL
+		)
+	`, userID, courseID).Scan(&exists)
+	return exists, err
+}
+
+// IsCourseMember проверяет, записан ли пользователь на дисциплину
+func (p *Postgres) IsCourseMember(userID, courseID int) (bool, error) {
+	var exists bool
+	err := p.conn().QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM user_courses uc
+			JOIN courses c ON c.id = uc.course_id
+			WHERE uc.user_id = $1 AND uc.course_id = $2 AND c.deleted_at IS NULL
+		)
+	`, userID, courseID).Scan(&exists)
+	return exists, err
+}
+
+// IsCourseTeacher проверяет, ведёт ли пользователь дисциплину, в том числе удалённую
+func (p *Postgres) IsCourseTeacher(userID, courseID int) (bool, error) {
+	var exists bool
+	err := p.conn().QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM courses WHERE id = $2 AND teacher_id = $1
+		) OR EXISTS(
+			SELECT 1 FROM user_courses
+			WHERE course_id = $2 AND user_id = $1 AND role = 'teacher'
+		)
+	`, userID, courseID).Scan(&exists)
+	return exists, err
+}
+
+// MemberCourses возвращает неудалённые дисциплины пользователя с его ролью. Владелец
+// дисциплины, не записанный на неё, считается преподавателем
+func (p *Postgres) MemberCourses(userID int) ([]MemberCourse, error) {
+	rows, err := p.conn().Query(`
+		SELECT c.id, c.name, c.description, c.teacher_id, c.created_at, COALESCE(uc.role, 'teacher')
+		FROM courses c
+		LEFT JOIN user_courses uc ON uc.course_id = c.id AND uc.user_id = $1
+		WHERE c.deleted_at IS NULL AND (c.teacher_id = $1 OR uc.user_id IS NOT NULL)
+		ORDER BY c.name, c.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var courses []MemberCourse
+	for rows.Next() {
+		var c MemberCourse
+		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.TeacherID, &c.CreatedAt, &c.Role); err != nil {
+			return nil, err
+		}
+		courses = append(courses, c)
+	}
+	return courses, rows.Err()
+}
+
+// UpdateCourse меняет название и описание неудалённой дисциплины
+func (p *Postgres) UpdateCourse(c *models.Course) error {
+	err := p.conn().QueryRow(`
+		UPDATE courses SET name = $1, description = $2
+		WHERE id = $3 AND deleted_at IS NULL
+		RETURNING id, name, description, teacher_id, created_at
+	`, c.Name, c.Description, c.ID).Scan(&c.ID, &c.Name, &c.Description, &c.TeacherID, &c.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// DeleteCourse помечает удалённой дисциплину и её тесты. Тесты помечаются
+// deleted_with_course, чтобы при восстановлении вернуть только их, а не тесты,
+// удалённые раньше отдельно
+func (p *Postgres) DeleteCourse(id int, at time.Time) error {
+	return p.atomic(func(p *Postgres) error {
+		res, err := p.tx.Exec("UPDATE courses SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL", at, id)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		_, err = p.tx.Exec(`
+			UPDATE tests SET deleted_at = $1, deleted_with_course = true
+			WHERE course_id = $2 AND deleted_at IS NULL
+		`, at, id)
+		return err
+	})
+}
+
+// DeletedCourse возвращает удалённую дисциплину
+func (p *Postgres) DeletedCourse(id int) (models.Course, error) {
+	var c models.Course
+	err := p.conn().QueryRow(`
+		SELECT id, name, description, teacher_id, created_at
+		FROM courses
+		WHERE id = $1 AND deleted_at IS NOT NULL
+	`, id).Scan(&c.ID, &c.Name, &c.Description, &c.TeacherID, &c.CreatedAt)
+	if err == sql.ErrNoRows {
+		return c, ErrNotFound
+	}
+	return c, err
+}
+
+// RestoreCourse восстанавливает удалённую дисциплину и тесты, удалённые вместе с ней
+func (p *Postgres) RestoreCourse(id int) (models.Course, error) {
+	var c models.Course
+	err := p.atomic(func(p *Postgres) error {
+		err := p.tx.QueryRow(`
+			UPDATE courses SET deleted_at = NULL
+			WHERE id = $1 AND deleted_at IS NOT NULL
+			RETURNING id, name, description, teacher_id, created_at
+		`, id).Scan(&c.ID, &c.Name, &c.Description, &c.TeacherID, &c.CreatedAt)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+		_, err = p.tx.Exec(`
+			UPDATE tests SET deleted_at = NULL, deleted_with_course = false
+			WHERE course_id = $1 AND deleted_with_course
+		`, id)
+		return err
+	})
+	return c, err
+}
+
+// Test возвращает неудалённый тест
+func (p *Postgres) Test(id int) (models.Test, error) {
+	return p.queryTest("SELECT "+TestColumns+" FROM tests WHERE id = $1 AND deleted_at IS NULL", id)
+}
+
+// TestWithDeleted возвращает тест, в том числе удалённый
+func (p *Postgres) TestWithDeleted(id int) (models.Test, error) {
+	return p.queryTest("SELECT "+TestColumns+" FROM tests WHERE id = $1", id)
+}
+
+// queryTest выполняет запрос одного теста; если теста нет, возвращается ErrNotFound
+func (p *Postgres) queryTest(query string, args ...interface{}) (models.Test, error) {
+	var t models.Test
+	err := p.conn().QueryRow(query, args...).Scan(TestDest(&t)...)
+	if err == sql.ErrNoRows {
+		return t, ErrNotFound
+	}
+	return t, err
+}
+
+// AttemptedTest находит неудалённый тест с попытками пользователя по подстроке названия
+func (p *Postgres) AttemptedTest(userID int, name string) (models.Test, error) {
+	return p.queryTest(`
+		SELECT `+TestColumns+`
+		FROM tests
+		WHERE name ILIKE $1 ESCAPE '\' AND deleted_at IS NULL
+			AND EXISTS(SELECT 1 FROM attempts a WHERE a.test_id = tests.id AND a.user_id = $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	`, likePattern(name), userID)
+}
+
+// testSorts — ключи сортировки тестов
+var testSorts = map[string]sortColumn{
+	"id":         {"id", ""},
+	"name":       {"name", "text"},
+	"created_at": {"created_at", "timestamp"},
+}
+
+// CourseTests возвращает страницу неудалённых тестов дисциплины по фильтру и курсор
+// следующей страницы. ID вопросов, размер варианта и статистика попыток собираются
+// тем же запросом, а не отдельным запросом на каждый тест
+func (p *Postgres) CourseTests(f TestFilter) ([]models.Test, *Cursor, error) {
+	if err := f.check(testSorts); err != nil {
+		return nil, nil, err
+	}
+	ids := f.IDs
+	if ids == nil {
+		ids = []int{}
+	}
+	args := []interface{}{f.CourseID, likePattern(f.Query), f.Kind, f.Active, pq.Array(ids)}
+	created, args := f.createdArgs("created_at", args)
+	tail, args := f.keyset(testSorts, "id", args)
+	rows, err := p.conn().Query(`
+		SELECT `+TestColumns+`,
+			fixed.ids, fixed.count + pooled.count, fixed.points + pooled.points,
+			stats.attempts, stats.finished, stats.participants, stats.avg_percentage
+		FROM tests
+		CROSS JOIN LATERAL (
+			SELECT COALESCE(array_agg(tq.question_id ORDER BY tq.position, tq.question_id), '{}') AS ids,
+				count(*) AS count, COALESCE(sum(tq.points), 0) AS points
+			FROM test_questions tq
+			JOIN questions q ON q.id = tq.question_id
+			WHERE tq.test_id = tests.id AND q.deleted_at IS NULL
+		) fixed
+		CROSS JOIN LATERAL (
+			SELECT COALESCE(sum(tp.count), 0) AS count, COALESCE(sum(tp.count * tp.points), 0) AS points
+			FROM test_pools tp
+			WHERE tp.test_id = tests.id
+		) pooled
+		CROSS JOIN LATERAL (
+			SELECT count(*) AS attempts,
+				count(*) FILTER (WHERE a.finished) AS finished,
+				count(DISTINCT a.user_id) AS participants,
+				avg(a.percentage) FILTER (WHERE a.finished) AS avg_percentage
+			FROM attempts a
+			WHERE a.test_id = tests.id
+		) stats
+		WHERE course_id = $1 AND deleted_at IS NULL
+			AND ($2 = '' OR name ILIKE $2 ESCAPE '\')
+			AND ($3 = '' OR kind = $3)
+			AND ($4::boolean IS NULL OR active = $4)
+			AND (cardinality($5::int[]) = 0 OR id = ANY($5))
+	`+created+tail, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var tests []models.Test
+	for rows.Next() {
+		var t models.Test
+		var ids []int64
+		stats := &models.TestStats{}
+		dest := append(TestDest(&t), pq.Array(&ids), &t.QuestionCount, &t.TotalPoints,
+			&stats.Attempts, &stats.FinishedAttempts, &stats.Participants, &stats.AvgPercentage)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+		t.Questions = make([]int, len(ids))
+		for i, id := range ids {
+			t.Questions[i] = int(id)
+		}
+		t.Stats = stats
+		tests = append(tests, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	n, next := f.nextCursor(len(tests),
+		func(i int) int { return tests[i].ID },
+		func(i int) interface{} { return testSortValue(tests[i], f.Sort) })
+	return tests[:n], next, nil
+}
+
+// TestQuestionIDs возвращает ID неудалённых вопросов теста в порядке теста
+func (p *Postgres) TestQuestionIDs(testID int) ([]int, error) {
+	return p.queryIDs(`
+		SELECT tq.question_id FROM test_questions tq
+		JOIN questions q ON tq.question_id = q.id
+		WHERE tq.test_id = $1 AND q.deleted_at IS NULL
+		ORDER BY tq.position, tq.question_id
+	`, testID)
+}
+
+// queryIDs выполняет запрос, возвращающий столбец ID
+func (p *Postgres) queryIDs(query string, args ...interface{}) ([]int, error) {
+	rows, err := p.conn().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// CreateTest создаёт тест и заполняет t.ID
+func (p *Postgres) CreateTest(t *models.Test) error {
+	return p.conn().QueryRow(`
+		INSERT INTO tests (course_id, name, kind, anonymous, active, allow_review,
+			time_limit_seconds, opens_at, closes_at, max_attempts, cooldown_seconds, grading_policy,
+			shuffle_questions, shuffle_options, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15) RETURNING id
+	`, t.CourseID, t.Name, t.Kind, t.Anonymous, t.Active, t.AllowReview,
+		t.TimeLimit, t.OpensAt, t.ClosesAt, t.MaxAttempts, t.Cooldown,
+		t.GradingPolicy, t.ShuffleQuestions, t.ShuffleOptions, t.CreatedAt).Scan(&t.ID)
+}
+
+// SetTestActive открывает или закрывает тест и сообщает, изменилось ли состояние
+func (p *Postgres) SetTestActive(id int, active bool) (bool, error) {
+	res, err := p.conn().Exec(`
+		UPDATE tests SET active = $1
+		WHERE id = $2 AND active <> $1 AND deleted_at IS NULL
+	`, active, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// UpdateTest сохраняет изменяемые настройки неудалённого теста
+func (p *Postgres) UpdateTest(t *models.Test) error {
+	err := p.conn().QueryRow(`
+		UPDATE tests SET name = $1, allow_review = $2, time_limit_seconds = $3, opens_at = $4, closes_at = $5,
+			max_attempts = $6, cooldown_seconds = $7, grading_policy = $8, shuffle_questions = $9, shuffle_options = $10
+		WHERE id = $11 AND deleted_at IS NULL
+		RETURNING `+TestColumns,
+		t.Name, t.AllowReview, t.TimeLimit, t.OpensAt, t.ClosesAt, t.MaxAttempts,
+		t.Cooldown, t.GradingPolicy, t.ShuffleQuestions, t.ShuffleOptions, t.ID).Scan(TestDest(t)...)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// SetTestReview разрешает или запрещает разбор попыток
+func (p *Postgres) SetTestReview(id int, allow bool) error {
+	return p.execOne("UPDATE tests SET allow_review = $2 WHERE id = $1 AND deleted_at IS NULL", id, allow)
+}
+
+// SetTestSchedule задаёт ограничение по времени и окно доступности
+func (p *Postgres) SetTestSchedule(id int, timeLimit *int, opensAt, closesAt *time.Time) error {
+	return p.execOne(`
+		UPDATE tests SET time_limit_seconds = $2, opens_at = $3, closes_at = $4
+		WHERE id = $1 AND deleted_at IS NULL
+	`, id, timeLimit, opensAt, closesAt)
+}
+
+// SetTestPolicy задаёт ограничения на пересдачу и правило итоговой оценки
+func (p *Postgres) SetTestPolicy(id int, maxAttempts, cooldown *int, policy string) error {
+	return p.execOne(`
+		UPDATE tests SET max_attempts = $2, cooldown_seconds = $3, grading_policy = $4
+		WHERE id = $1 AND deleted_at IS NULL
+	`, id, maxAttempts, cooldown, policy)
+}
+
+// SetTestShuffle задаёт перемешивание вопросов и вариантов
+func (p *Postgres) SetTestShuffle(id int, questions, options bool) error {
+	return p.execOne(`
+		UPDATE tests SET shuffle_questions = $2, shuffle_options = $3
+		WHERE id = $1 AND deleted_at IS NULL
+	`, id, questions, options)
+}
+
+// DeleteTest помечает неудалённый тест удалённым
+func (p *Postgres) DeleteTest(id int, at time.Time) error {
+	return p.execOne("UPDATE tests SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL", id, at)
+}
+
+// execOne выполняет изменение одной записи; если запрос ничего не изменил,
+// возвращается ErrNotFound
+func (p *Postgres) execOne(query string, args ...interface{}) error {
+	res, err := p.conn().Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+// RestoreTest восстанавливает удалённый тест
+func (p *Postgres) RestoreTest(id int) (models.Test, error) {
+	return p.queryTest(`
+		UPDATE tests SET deleted_at = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING `+TestColumns, id)
+}
+
+// Question возвращает текущую версию вопроса, в том числе удалённого
+func (p *Postgres) Question(id int) (models.Question, error) {
+	var q models.Question
+	err := p.conn().QueryRow(`
+		SELECT `+QuestionColumns("")+`
+		FROM questions
+		WHERE id = $1
+	`, id).Scan(QuestionDest(&q)...)
+	if err == sql.ErrNoRows {
+		return q, ErrNotFound
+	}
+	return q, err
+}
+
+// questionSorts — ключи сортировки вопросов банка
+var questionSorts = map[string]sortColumn{
+	"id":         {"id", ""},
+	"created_at": {"created_at", "timestamp"},
+}
+
+// CourseQuestions возвращает страницу неудалённых вопросов банка дисциплины по фильтру
+// и курсор следующей страницы
+func (p *Postgres) CourseQuestions(f QuestionFilter) ([]models.Question, *Cursor, error) {
+	if err := f.check(questionSorts); err != nil {
+		return nil, nil, err
+	}
+	tags := f.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	args := []interface{}{f.CourseID, likePattern(f.Query), pq.Array(tags), f.Type, f.Kind}
+	created, args := f.createdArgs("created_at", args)
+	tail, args := f.keyset(questionSorts, "id", args)
+	rows, err := p.conn().Query(`
+		SELECT `+QuestionColumns("")+`
+		FROM questions
+		WHERE course_id = $1 AND deleted_at IS NULL
+			AND ($2 = '' OR text ILIKE $2 ESCAPE '\')
+			AND tags @> $3
+			AND ($4 = '' OR type = $4)
+			AND ($5 = '' OR kind = $5)
+	`+created+tail, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var questions []models.Question
+	for rows.Next() {
+		var q models.Question
+		if err := rows.Scan(QuestionDest(&q)...); err != nil {
+			return nil, nil, err
+		}
+		questions = append(questions, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	n, next := f.nextCursor(len(questions),
+		func(i int) int { return questions[i].ID },
+		func(i int) interface{} { return questionSortValue(questions[i], f.Sort) })
+	return questions[:n], next, nil
+}
+
+// HasQuestionAttempt проверяет, выпадал ли вопрос пользователю в одной из его попыток
+func (p *Postgres) HasQuestionAttempt(userID, questionID int) (bool, error) {
+	var exists bool
+	err := p.conn().QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM attempts a
+			JOIN attempt_questions aq ON aq.attempt_id = a.id
+			WHERE a.user_id = $1 AND aq.question_id = $2
+		)
+	`, userID, questionID).Scan(&exists)
+	return exists, err
+}
+
+// ActivePaper возвращает ID вопросов варианта незавершённой попытки пользователя по тесту
+func (p *Postgres) ActivePaper(userID, testID int) ([]int, error) {
+	return p.queryIDs(`
+		SELECT aq.question_id
+		FROM attempts a
+		JOIN attempt_questions aq ON aq.attempt_id = a.id
+		WHERE a.user_id = $1 AND a.test_id = $2 AND a.finished = false
+		ORDER BY aq.position
+	`, userID, testID)
+}
+
+// EnsureUser находит пользователя по user_id_reference или создаёт его студентом.
+// Если пользователя одновременно создал другой запрос, возвращается его ID
+func (p *Postgres) EnsureUser(ref, fullName string) (int, error) {
+	var userID int
+	err := p.conn().QueryRow("SELECT id FROM users WHERE user_id_reference = $1", ref).Scan(&userID)
+	if err != sql.ErrNoRows {
+		return userID, err
+	}
+	err = p.conn().QueryRow(`
+		INSERT INTO users (user_id_reference, full_name, roles, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id_reference) DO UPDATE SET user_id_reference = EXCLUDED.user_id_reference
+		RETURNING id
+	`, ref, fullName, pq.Array([]string{"Student"}), time.Now()).Scan(&userID)
+	return userID, err
+}
+
+// UserExists проверяет, есть ли пользователь с таким ID
+func (p *Postgres) UserExists(id int) (bool, error) {
+	var exists bool
+	err := p.conn().QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", id).Scan(&exists)
+	return exists, err
+}
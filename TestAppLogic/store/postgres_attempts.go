@@ -0,0 +1,473 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"testapplogic/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// queryAttempt выполняет запрос одной попытки; если попытки нет, возвращается ErrNotFound
+func (p *Postgres) queryAttempt(query string, args ...interface{}) (models.Attempt, error) {
+	var a models.Attempt
+	err := p.conn().QueryRow(query, args...).Scan(attemptDest(&a)...)
+	if err == sql.ErrNoRows {
+		return a, ErrNotFound
+	}
+	return a, err
+}
+
+// queryAttempts выполняет запрос списка попыток
+func (p *Postgres) queryAttempts(query string, args ...interface{}) ([]models.Attempt, error) {
+	rows, err := p.conn().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var attempts []models.Attempt
+	for rows.Next() {
+		var a models.Attempt
+		if err := rows.Scan(attemptDest(&a)...); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// Attempt возвращает попытку без варианта и ответов
+func (p *Postgres) Attempt(id int) (models.Attempt, error) {
+	return p.queryAttempt("SELECT "+attemptColumns+" FROM attempts a WHERE a.id = $1", id)
+}
+
+// LockAttempt возвращает попытку и блокирует её до конца транзакции
+func (p *Postgres) LockAttempt(id int) (models.Attempt, error) {
+	return p.queryAttempt("SELECT "+attemptColumns+" FROM attempts a WHERE a.id = $1 FOR UPDATE", id)
+}
+
+// LockUserTest блокирует до конца транзакции начало попыток пользователя по тесту
+func (p *Postgres) LockUserTest(testID, userID int) error {
+	_, err := p.conn().Exec("SELECT pg_advisory_xact_lock($1, $2)", testID, userID)
+	return err
+}
+
+// HasActiveAttempt проверяет, есть ли у пользователя незавершённая попытка по тесту
+func (p *Postgres) HasActiveAttempt(userID, testID int) (bool, error) {
+	var exists bool
+	err := p.conn().QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM attempts WHERE user_id = $1 AND test_id = $2 AND finished = false)
+	`, userID, testID).Scan(&exists)
+	return exists, err
+}
+
+// AttemptUsage возвращает число попыток пользователя по тесту и время окончания последней
+func (p *Postgres) AttemptUsage(userID, testID int) (int, *time.Time, error) {
+	var used int
+	var last *time.Time
+	err := p.conn().QueryRow(`
+		SELECT COUNT(*), MAX(COALESCE(completed_at, created_at))
+		FROM attempts WHERE user_id = $1 AND test_id = $2
+	`, userID, testID).Scan(&used, &last)
+	return used, last, err
+}
+
+// CreateAttempt создаёт попытку и заполняет a.ID
+func (p *Postgres) CreateAttempt(a *models.Attempt) error {
+	return p.conn().QueryRow(`
+		INSERT INTO attempts (user_id, test_id, finished, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id
+	`, a.UserID, a.TestID, a.Finished, a.ExpiresAt, a.CreatedAt).Scan(&a.ID)
+}
+
+// SavePaper сохраняет вариант попытки в порядке показа
+func (p *Postgres) SavePaper(attemptID int, paper []PaperQuestion) error {
+	return p.atomic(func(p *Postgres) error {
+		for i, item := range paper {
+			_, err := p.tx.Exec(`
+				INSERT INTO attempt_questions (attempt_id, question_id, version, position, points, option_order)
+				VALUES ($1, $2, $3, $4, $5, $6)
+			`, attemptID, item.Question.ID, item.Question.Version, i+1, item.Question.Points, optionOrderArg(item.Order))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// optionOrderArg готовит порядок вариантов к записи: пустой порядок хранится как NULL
+func optionOrderArg(order []int) interface{} {
+	if order == nil {
+		return nil
+	}
+	return pq.Array(order)
+}
+
+// paperQuery — выборка вопросов варианта попытки; условие дописывает вызывающий
+const paperQuery = `
+	SELECT ` + paperColumns + `
+	FROM attempt_questions aq
+	JOIN attempts a ON aq.attempt_id = a.id
+	JOIN questions q ON aq.question_id = q.id
+	JOIN question_versions v ON v.question_id = aq.question_id AND v.version = aq.version
+`
+
+// AttemptPaper возвращает вариант попытки в порядке показа
+func (p *Postgres) AttemptPaper(attemptID int) ([]PaperQuestion, error) {
+	rows, err := p.conn().Query(paperQuery+"WHERE aq.attempt_id = $1 ORDER BY aq.position", attemptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var paper []PaperQuestion
+	for rows.Next() {
+		var item PaperQuestion
+		var order pq.Int64Array
+		if err := rows.Scan(paperDest(&item.Question, &order)...); err != nil {
+			return nil, err
+		}
+		item.Order = paperOrder(order, len(item.Question.Options))
+		paper = append(paper, item)
+	}
+	return paper, rows.Err()
+}
+
+// PaperQuestion возвращает вопрос варианта попытки
+func (p *Postgres) PaperQuestion(attemptID, questionID int) (PaperQuestion, error) {
+	var item PaperQuestion
+	var order pq.Int64Array
+	err := p.conn().QueryRow(paperQuery+"WHERE aq.attempt_id = $1 AND aq.question_id = $2", attemptID, questionID).
+		Scan(paperDest(&item.Question, &order)...)
+	if err == sql.ErrNoRows {
+		return item, ErrNotFound
+	}
+	item.Order = paperOrder(order, len(item.Question.Options))
+	return item, err
+}
+
+// ActivePaperQuestion находит вопрос в варианте последней незавершённой попытки пользователя
+func (p *Postgres) ActivePaperQuestion(userID, questionID int) (PaperQuestion, error) {
+	var attemptID int
+	err := p.conn().QueryRow(`
+		SELECT a.id
+		FROM attempts a
+		JOIN attempt_questions aq ON aq.attempt_id = a.id
+		WHERE a.user_id = $1 AND aq.question_id = $2 AND a.finished = false
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT 1
+	`, userID, questionID).Scan(&attemptID)
+	if err == sql.ErrNoRows {
+		return PaperQuestion{}, ErrNotFound
+	} else if err != nil {
+		return PaperQuestion{}, err
+	}
+	return p.PaperQuestion(attemptID, questionID)
+}
+
+// AttemptProgress возвращает число вопросов варианта и число вопросов с ответом
+func (p *Postgres) AttemptProgress(attemptID int) (total, answered int, err error) {
+	err = p.conn().QueryRow(`
+		SELECT COUNT(*), COUNT(ans.id)
+		FROM attempt_questions aq
+		LEFT JOIN answers ans ON ans.attempt_id = aq.attempt_id AND ans.question_id = aq.question_id
+		WHERE aq.attempt_id = $1
+	`, attemptID).Scan(&total, &answered)
+	return total, answered, err
+}
+
+// queryAnswers выполняет запрос списка ответов
+func (p *Postgres) queryAnswers(query string, args ...interface{}) ([]models.Answer, error) {
+	rows, err := p.conn().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var answers []models.Answer
+	for rows.Next() {
+		var a models.Answer
+		if err := rows.Scan(answerDest(&a)...); err != nil {
+			return nil, err
+		}
+		answers = append(answers, a)
+	}
+	return answers, rows.Err()
+}
+
+// AttemptAnswers возвращает текущие ответы попытки по возрастанию ID вопроса
+func (p *Postgres) AttemptAnswers(attemptID int) ([]models.Answer, error) {
+	return p.queryAnswers(`
+		SELECT `+answerColumns+`
+		FROM answers ans
+		WHERE ans.attempt_id = $1
+		ORDER BY ans.question_id
+	`, attemptID)
+}
+
+// SaveAnswer сохраняет текущий ответ на вопрос попытки и записывает его версию в историю
+func (p *Postgres) SaveAnswer(attemptID, questionID int, answer json.RawMessage, at time.Time) (models.Answer, error) {
+	ans := models.Answer{AttemptID: attemptID, QuestionID: questionID, Answer: answer}
+	err := p.atomic(func(p *Postgres) error {
+		err := p.tx.QueryRow(`
+			INSERT INTO answers (attempt_id, question_id, answer, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $4)
+			ON CONFLICT (attempt_id, question_id) DO UPDATE
+			SET answer = EXCLUDED.answer, is_correct = NULL,
+				revision = answers.revision + 1, updated_at = EXCLUDED.updated_at
+			WHERE answers.answer IS DISTINCT FROM EXCLUDED.answer
+			RETURNING id, revision, created_at, updated_at
+		`, attemptID, questionID, jsonArg(answer), at).Scan(&ans.ID, &ans.Revision, &ans.CreatedAt, &ans.UpdatedAt)
+		if err == sql.ErrNoRows {
+			// Ответ не изменился
+			return p.tx.QueryRow(`
+				SELECT `+answerColumns+`
+				FROM answers ans WHERE ans.attempt_id = $1 AND ans.question_id = $2
+			`, attemptID, questionID).Scan(answerDest(&ans)...)
+		} else if err != nil {
+			return err
+		}
+		_, err = p.tx.Exec(`
+			INSERT INTO answer_revisions (answer_id, revision, answer, created_at)
+			VALUES ($1, $2, $3, $4)
+		`, ans.ID, ans.Revision, jsonArg(answer), ans.UpdatedAt)
+		return err
+	})
+	return ans, err
+}
+
+// AnswerRevisions возвращает историю ответов попытки по вопросам и версиям
+func (p *Postgres) AnswerRevisions(attemptID, questionID int) ([]models.AnswerRevision, error) {
+	rows, err := p.conn().Query(`
+		SELECT r.answer_id, ans.question_id, r.revision, r.answer, r.created_at
+		FROM answer_revisions r
+		JOIN answers ans ON r.answer_id = ans.id
+		WHERE ans.attempt_id = $1 AND ($2 = 0 OR ans.question_id = $2)
+		ORDER BY ans.question_id, r.revision
+	`, attemptID, questionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var history []models.AnswerRevision
+	for rows.Next() {
+		var rev models.AnswerRevision
+		if err := rows.Scan(&rev.AnswerID, &rev.QuestionID, &rev.Revision, NullableJSON{&rev.Answer}, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, rev)
+	}
+	return history, rows.Err()
+}
+
+// SetAnswerCorrect сохраняет результат проверки ответа
+func (p *Postgres) SetAnswerCorrect(answerID int, correct bool) error {
+	_, err := p.conn().Exec("UPDATE answers SET is_correct = $1 WHERE id = $2", correct, answerID)
+	return err
+}
+
+// SaveAttemptResult завершает попытку с баллами и временем из r
+func (p *Postgres) SaveAttemptResult(r *models.AttemptResult) error {
+	_, err := p.conn().Exec(`
+		UPDATE attempts
+		SET finished = true, score = $1, max_score = $2, percentage = $3, completed_at = $4
+		WHERE id = $5
+	`, r.Score, r.MaxScore, r.Percentage, r.CompletedAt, r.AttemptID)
+	return err
+}
+
+// FinishAttempt завершает попытку без оценки
+func (p *Postgres) FinishAttempt(attemptID int, at time.Time) error {
+	_, err := p.conn().Exec("UPDATE attempts SET finished = true, completed_at = $1 WHERE id = $2", at, attemptID)
+	return err
+}
+
+// FinishAnonymousAttempt завершает попытку анонимного опроса. Время завершения
+// не сохраняется: по нему можно сопоставить попытку с участником
+func (p *Postgres) FinishAnonymousAttempt(attemptID int) error {
+	return p.atomic(func(p *Postgres) error {
+		_, err := p.tx.Exec("UPDATE attempts SET finished = true, user_id = NULL, created_at = date_trunc('day', created_at) WHERE id = $1", attemptID)
+		if err != nil {
+			return err
+		}
+		// По той же причине огрубляется время ответов и удаляется история их изменений
+		_, err = p.tx.Exec(`
+			DELETE FROM answer_revisions
+			WHERE answer_id IN (SELECT id FROM answers WHERE attempt_id = $1)
+		`, attemptID)
+		if err != nil {
+			return err
+		}
+		_, err = p.tx.Exec(`
+			UPDATE answers
+			SET created_at = date_trunc('day', created_at), updated_at = date_trunc('day', updated_at), revision = 1
+			WHERE attempt_id = $1
+		`, attemptID)
+		return err
+	})
+}
+
+// ExpiredAttempt возвращает ID незавершённой попытки с истёкшим временем. SKIP LOCKED
+// не даёт двум репликам сервиса или параллельному завершению взять одну попытку дважды
+func (p *Postgres) ExpiredAttempt(now time.Time, skip []int) (int, error) {
+	if skip == nil {
+		skip = []int{}
+	}
+	var attemptID int
+	err := p.conn().QueryRow(`
+		SELECT id FROM attempts
+		WHERE finished = false AND expires_at <= $1 AND NOT (id = ANY($2))
+		ORDER BY expires_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`, now, pq.Array(skip)).Scan(&attemptID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return attemptID, err
+}
+
+// GradedAttempts возвращает оценённые попытки пользователя по тесту в порядке завершения
+func (p *Postgres) GradedAttempts(userID, testID int) ([]models.Attempt, error) {
+	return p.queryAttempts(`
+		SELECT `+attemptColumns+`
+		FROM attempts a
+		WHERE a.user_id = $1 AND a.test_id = $2 AND a.finished = true AND a.score IS NOT NULL
+		ORDER BY a.completed_at, a.id
+	`, userID, testID)
+}
+
+// StudentAttempts возвращает попытки студентов дисциплины по её тестам с проверкой ответов
+func (p *Postgres) StudentAttempts(courseID int) ([]models.Attempt, error) {
+	return p.queryAttempts(`
+		SELECT `+attemptColumns+`
+		FROM attempts a
+		JOIN tests t ON a.test_id = t.id
+		JOIN user_courses uc ON uc.user_id = a.user_id AND uc.course_id = t.course_id AND uc.role = 'student'
+		WHERE t.course_id = $1 AND t.kind = $2
+		ORDER BY a.completed_at, a.id
+	`, courseID, models.TestKindQuiz)
+}
+
+// FinishedAttempts возвращает завершённые попытки теста с ответами и вариантами
+func (p *Postgres) FinishedAttempts(testID int) ([]AttemptAnswers, error) {
+	attempts, err := p.queryAttempts(`
+		SELECT `+attemptColumns+`
+		FROM attempts a
+		WHERE a.test_id = $1 AND a.finished = true
+		ORDER BY a.id
+	`, testID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]AttemptAnswers, len(attempts))
+	index := make(map[int]int, len(attempts))
+	for i, a := range attempts {
+		result[i].Attempt = a
+		index[a.ID] = i
+	}
+	answers, err := p.queryAnswers(`
+		SELECT `+answerColumns+`
+		FROM answers ans
+		JOIN attempts a ON ans.attempt_id = a.id
+		WHERE a.test_id = $1 AND a.finished = true
+		ORDER BY ans.created_at, ans.id
+	`, testID)
+	if err != nil {
+		return nil, err
+	}
+	for _, ans := range answers {
+		if i, ok := index[ans.AttemptID]; ok {
+			result[i].Answers = append(result[i].Answers, ans)
+		}
+	}
+	rows, err := p.conn().Query(`
+		SELECT aq.attempt_id, aq.question_id
+		FROM attempt_questions aq
+		JOIN attempts a ON aq.attempt_id = a.id
+		WHERE a.test_id = $1 AND a.finished = true
+		ORDER BY aq.attempt_id, aq.position
+	`, testID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var attemptID, questionID int
+		if err := rows.Scan(&attemptID, &questionID); err != nil {
+			return nil, err
+		}
+		if i, ok := index[attemptID]; ok {
+			result[i].Presented = append(result[i].Presented, questionID)
+		}
+	}
+	return result, rows.Err()
+}
+
+// EachTestAttempt передаёт fn попытки теста по возрастанию ID. Ответы читаются вместе
+// с попытками и группируются по мере чтения, поэтому в памяти держится одна попытка
+func (p *Postgres) EachTestAttempt(testID int, fn func(AttemptExport) error) error {
+	rows, err := p.conn().Query(`
+		SELECT `+attemptColumns+`, COALESCE(u.user_id_reference, ''), COALESCE(u.full_name, ''),
+			ans.question_id, ans.answer, ans.is_correct
+		FROM attempts a
+		LEFT JOIN users u ON a.user_id = u.id
+		LEFT JOIN answers ans ON ans.attempt_id = a.id
+		WHERE a.test_id = $1
+		ORDER BY a.id, ans.question_id
+	`, testID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var current *AttemptExport
+	for rows.Next() {
+		var e AttemptExport
+		var questionID *int
+		var answer json.RawMessage
+		var correct *bool
+		dest := append(attemptDest(&e.Attempt), &e.UserRef, &e.FullName, &questionID, NullableJSON{&answer}, &correct)
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		if current == nil || current.Attempt.ID != e.Attempt.ID {
+			if current != nil {
+				if err := fn(*current); err != nil {
+					return err
+				}
+			}
+			current = &e
+		}
+		if questionID != nil {
+			current.Answers = append(current.Answers, models.Answer{
+				AttemptID: current.Attempt.ID, QuestionID: *questionID, Answer: answer, IsCorrect: correct,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if current != nil {
+		return fn(*current)
+	}
+	return nil
+}
+
+// HasSurveyResponse проверяет, проходил ли пользователь опрос
+func (p *Postgres) HasSurveyResponse(testID, userID int) (bool, error) {
+	var exists bool
+	err := p.conn().QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM survey_participants WHERE test_id = $1 AND user_id = $2)
+	`, testID, userID).Scan(&exists)
+	return exists, err
+}
+
+// AddSurveyParticipant отмечает, что пользователь прошёл опрос
+func (p *Postgres) AddSurveyParticipant(testID, userID int, at time.Time) error {
+	_, err := p.conn().Exec(`
+		INSERT INTO survey_participants (test_id, user_id, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (test_id, user_id) DO NOTHING
+	`, testID, userID, at)
+	return err
+}
@@ -0,0 +1,307 @@
+package store
+
+import (
+	"database/sql"
+	"testapplogic/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// queryQuestions выполняет запрос списка вопросов; dest задаёт адреса полей для Scan
+func (p *Postgres) queryQuestions(dest func(q *models.Question) []interface{}, query string, args ...interface{}) ([]models.Question, error) {
+	rows, err := p.conn().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var questions []models.Question
+	for rows.Next() {
+		var q models.Question
+		if err := rows.Scan(dest(&q)...); err != nil {
+			return nil, err
+		}
+		questions = append(questions, q)
+	}
+	return questions, rows.Err()
+}
+
+// queryQuestion выполняет запрос одного вопроса; если вопроса нет, возвращается ErrNotFound
+func (p *Postgres) queryQuestion(query string, args ...interface{}) (models.Question, error) {
+	var q models.Question
+	err := p.conn().QueryRow(query, args...).Scan(QuestionDest(&q)...)
+	if err == sql.ErrNoRows {
+		return q, ErrNotFound
+	}
+	return q, err
+}
+
+// CreateQuestion сохраняет вопрос в банке первой версией
+func (p *Postgres) CreateQuestion(q *models.Question) error {
+	return p.atomic(func(p *Postgres) error {
+		q.Version = 1
+		err := p.tx.QueryRow(`
+			INSERT INTO questions (course_id, kind, type, text, options, matches, correct_answer, tags, created_at, version)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id
+		`, q.CourseID, q.Kind, q.Type, q.Text, pq.Array(q.Options), pq.Array(q.Matches),
+			jsonArg(q.CorrectAnswer), pq.Array(q.Tags), q.CreatedAt, q.Version).Scan(&q.ID)
+		if err != nil {
+			return err
+		}
+		return p.insertQuestionVersion(*q, q.CreatedAt)
+	})
+}
+
+// insertQuestionVersion сохраняет содержимое вопроса как версию q.Version
+func (p *Postgres) insertQuestionVersion(q models.Question, createdAt time.Time) error {
+	_, err := p.conn().Exec(`
+		INSERT INTO question_versions (question_id, version, type, text, options, matches, correct_answer, tags, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, q.ID, q.Version, q.Type, q.Text, pq.Array(q.Options), pq.Array(q.Matches),
+		jsonArg(q.CorrectAnswer), pq.Array(q.Tags), createdAt)
+	return err
+}
+
+// LockQuestion возвращает неудалённый вопрос и блокирует его до конца транзакции
+func (p *Postgres) LockQuestion(id int) (models.Question, error) {
+	return p.queryQuestion(`
+		SELECT `+QuestionColumns("")+`
+		FROM questions
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`, id)
+}
+
+// UpdateQuestion сохраняет содержимое q как новую версию вопроса
+func (p *Postgres) UpdateQuestion(q *models.Question) error {
+	return p.atomic(func(p *Postgres) error {
+		err := p.tx.QueryRow(`
+			UPDATE questions
+			SET type = $1, text = $2, options = $3, matches = $4, correct_answer = $5, tags = $6, version = version + 1
+			WHERE id = $7 AND deleted_at IS NULL
+			RETURNING `+QuestionColumns(""),
+			q.Type, q.Text, pq.Array(q.Options), pq.Array(q.Matches),
+			jsonArg(q.CorrectAnswer), pq.Array(q.Tags), q.ID).Scan(QuestionDest(q)...)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+		return p.insertQuestionVersion(*q, time.Now())
+	})
+}
+
+// DeleteQuestion помечает неудалённый вопрос удалённым
+func (p *Postgres) DeleteQuestion(id int, at time.Time) error {
+	return p.execOne("UPDATE questions SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL", id, at)
+}
+
+// RestoreQuestion восстанавливает удалённый вопрос
+func (p *Postgres) RestoreQuestion(id int) (models.Question, error) {
+	return p.queryQuestion(`
+		UPDATE questions SET deleted_at = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING `+QuestionColumns(""), id)
+}
+
+// QuestionVersions возвращает версии вопроса от первой к последней
+func (p *Postgres) QuestionVersions(id int) ([]models.QuestionVersion, error) {
+	rows, err := p.conn().Query(`
+		SELECT question_id, version, type, text, options, matches, correct_answer, tags, created_at
+		FROM question_versions
+		WHERE question_id = $1
+		ORDER BY version
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var versions []models.QuestionVersion
+	for rows.Next() {
+		var v models.QuestionVersion
+		err := rows.Scan(&v.QuestionID, &v.Version, &v.Type, &v.Text, pq.Array(&v.Options), pq.Array(&v.Matches),
+			NullableJSON{&v.CorrectAnswer}, pq.Array(&v.Tags), &v.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// BankQuestionID находит неудалённый вопрос банка с тем же видом, типом и текстом
+func (p *Postgres) BankQuestionID(courseID int, kind, questionType, text string) (int, error) {
+	var id int
+	err := p.conn().QueryRow(`
+		SELECT id FROM questions
+		WHERE course_id = $1 AND kind = $2 AND type = $3 AND text = $4 AND deleted_at IS NULL
+		ORDER BY id
+		LIMIT 1
+	`, courseID, kind, questionType, text).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return id, err
+}
+
+// PoolCandidates возвращает неудалённые вопросы банка с хотя бы одним из тегов, кроме exclude
+func (p *Postgres) PoolCandidates(courseID int, kind string, tags []string, exclude []int) ([]models.Question, error) {
+	if tags == nil {
+		tags = []string{}
+	}
+	if exclude == nil {
+		exclude = []int{}
+	}
+	return p.queryQuestions(QuestionDest, `
+		SELECT `+QuestionColumns("")+`
+		FROM questions
+		WHERE course_id = $1 AND kind = $2 AND tags && $3 AND deleted_at IS NULL AND NOT (id = ANY($4))
+		ORDER BY id
+	`, courseID, kind, pq.Array(tags), pq.Array(exclude))
+}
+
+// PresentedQuestions возвращает вопросы, которые выдавались по тесту
+func (p *Postgres) PresentedQuestions(testID int) ([]models.Question, error) {
+	return p.queryQuestions(QuestionDest, `
+		SELECT `+QuestionColumns("q")+`
+		FROM questions q
+		LEFT JOIN test_questions tq ON tq.question_id = q.id AND tq.test_id = $1
+		WHERE (tq.test_id IS NOT NULL AND q.deleted_at IS NULL) OR q.id IN (
+			SELECT aq.question_id
+			FROM attempt_questions aq
+			JOIN attempts a ON aq.attempt_id = a.id
+			WHERE a.test_id = $1
+		)
+		ORDER BY tq.position NULLS LAST, q.id
+	`, testID)
+}
+
+// TestQuestions возвращает неудалённые вопросы теста в порядке теста с позициями и весами
+func (p *Postgres) TestQuestions(testID int) ([]models.Question, error) {
+	return p.queryQuestions(testQuestionDest, `
+		SELECT `+testQuestionColumns()+`
+		FROM test_questions tq
+		JOIN questions q ON tq.question_id = q.id
+		WHERE tq.test_id = $1 AND q.deleted_at IS NULL
+		ORDER BY tq.position, q.id
+	`, testID)
+}
+
+// LinkQuestion добавляет вопрос банка в тест на позицию position и сдвигает следующие вопросы
+func (p *Postgres) LinkQuestion(testID, questionID, position int, points float64) (int, error) {
+	err := p.atomic(func(p *Postgres) error {
+		var last int
+		if err := p.tx.QueryRow("SELECT COALESCE(MAX(position), 0) FROM test_questions WHERE test_id = $1", testID).Scan(&last); err != nil {
+			return err
+		}
+		if position <= 0 || position > last {
+			position = last + 1
+		} else {
+			_, err := p.tx.Exec("UPDATE test_questions SET position = position + 1 WHERE test_id = $1 AND position >= $2", testID, position)
+			if err != nil {
+				return err
+			}
+		}
+		res, err := p.tx.Exec(`
+			INSERT INTO test_questions (test_id, question_id, position, points)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (test_id, question_id) DO NOTHING
+		`, testID, questionID, position, points)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrQuestionLinked
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return position, nil
+}
+
+// SetTestQuestions задаёт состав теста целиком в порядке questions
+func (p *Postgres) SetTestQuestions(testID int, questions []TestQuestion) error {
+	ids := make([]int, len(questions))
+	for i, tq := range questions {
+		ids[i] = tq.QuestionID
+	}
+	return p.atomic(func(p *Postgres) error {
+		_, err := p.tx.Exec("DELETE FROM test_questions WHERE test_id = $1 AND NOT (question_id = ANY($2))", testID, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+		for i, tq := range questions {
+			_, err = p.tx.Exec(`
+				INSERT INTO test_questions (test_id, question_id, position, points)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (test_id, question_id) DO UPDATE SET position = EXCLUDED.position, points = EXCLUDED.points
+			`, testID, tq.QuestionID, i+1, tq.Points)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UnlinkQuestion убирает вопрос из теста и сдвигает следующие вопросы
+func (p *Postgres) UnlinkQuestion(testID, questionID int) error {
+	return p.atomic(func(p *Postgres) error {
+		var position int
+		err := p.tx.QueryRow(`
+			DELETE FROM test_questions WHERE test_id = $1 AND question_id = $2 RETURNING position
+		`, testID, questionID).Scan(&position)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+		_, err = p.tx.Exec("UPDATE test_questions SET position = position - 1 WHERE test_id = $1 AND position > $2", testID, position)
+		return err
+	})
+}
+
+// TestPools возвращает пулы теста
+func (p *Postgres) TestPools(testID int) ([]models.QuestionPool, error) {
+	rows, err := p.conn().Query(`
+		SELECT id, test_id, tag, count, points
+		FROM test_pools WHERE test_id = $1
+		ORDER BY id
+	`, testID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var pools []models.QuestionPool
+	for rows.Next() {
+		var pool models.QuestionPool
+		if err := rows.Scan(&pool.ID, &pool.TestID, &pool.Tag, &pool.Count, &pool.Points); err != nil {
+			return nil, err
+		}
+		pools = append(pools, pool)
+	}
+	return pools, rows.Err()
+}
+
+// SetTestPools заменяет пулы теста и заполняет их ID
+func (p *Postgres) SetTestPools(testID int, pools []models.QuestionPool) error {
+	return p.atomic(func(p *Postgres) error {
+		if _, err := p.tx.Exec("DELETE FROM test_pools WHERE test_id = $1", testID); err != nil {
+			return err
+		}
+		for i := range pools {
+			pool := &pools[i]
+			pool.TestID = testID
+			err := p.tx.QueryRow(`
+				INSERT INTO test_pools (test_id, tag, count, points)
+				VALUES ($1, $2, $3, $4) RETURNING id
+			`, testID, pool.Tag, pool.Count, pool.Points).Scan(&pool.ID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
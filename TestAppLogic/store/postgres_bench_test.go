@@ -0,0 +1,135 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testapplogic/db"
+	"testapplogic/models"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// benchTests и benchQuestions задают размер дисциплины в бенчмарке списка тестов
+const (
+	benchTests     = 50
+	benchQuestions = 20
+)
+
+// openBenchDB подключается к БД из TEST_DATABASE_URL и применяет миграции.
+// Без переменной бенчмарк пропускается: ему нужен настоящий PostgreSQL
+func openBenchDB(b *testing.B) *sql.DB {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		b.Skip("TEST_DATABASE_URL is not set")
+	}
+	database, err := sql.Open("postgres", dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { database.Close() })
+	if _, err := db.MigrateUp(database); err != nil {
+		b.Fatal(err)
+	}
+	return database
+}
+
+// seedBenchCourse создаёт дисциплину с benchTests тестами по benchQuestions вопросов
+// и двумя попытками на тест. Дисциплина и преподаватель удаляются после бенчмарка
+func seedBenchCourse(b *testing.B, p *Postgres) int {
+	ref := fmt.Sprintf("bench-%d", time.Now().UnixNano())
+	teacherID, err := p.EnsureUser(ref, "Bench Teacher")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { p.DB.Exec("DELETE FROM users WHERE id = $1", teacherID) })
+	course := models.Course{Name: "Bench course", Description: ref, TeacherID: teacherID, CreatedAt: time.Now()}
+	if err := p.CreateCourse(&course); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { p.DB.Exec("DELETE FROM courses WHERE id = $1", course.ID) })
+	for i := 0; i < benchTests; i++ {
+		t := models.Test{CourseID: course.ID, Name: fmt.Sprintf("Test %d", i), Kind: models.TestKindQuiz,
+			Active: true, GradingPolicy: models.GradingBest, CreatedAt: time.Now()}
+		if err := p.CreateTest(&t); err != nil {
+			b.Fatal(err)
+		}
+		_, err := p.DB.Exec(`
+			WITH created AS (
+				INSERT INTO questions (course_id, kind, type, text, options, correct_answer, created_at)
+				SELECT $1, 'quiz', 'single', 'Question ' || n, ARRAY['a', 'b'], '0', $3
+				FROM generate_series(1, $4) n
+				RETURNING id
+			)
+			INSERT INTO test_questions (test_id, question_id, position, points)
+			SELECT $2, id, ROW_NUMBER() OVER (ORDER BY id), 1 FROM created
+		`, course.ID, t.ID, time.Now(), benchQuestions)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, err = p.DB.Exec(`
+			INSERT INTO attempts (user_id, test_id, finished, percentage, created_at)
+			VALUES ($1, $2, true, 80, $3), ($1, $2, false, NULL, $3)
+		`, teacherID, t.ID, time.Now())
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	return course.ID
+}
+
+// BenchmarkCourseTests сравнивает прежнюю загрузку списка тестов, где ID вопросов
+// запрашивались отдельно для каждого теста, с одним запросом CourseTests.
+// Запуск: TEST_DATABASE_URL=postgres://... go test ./store -run '^$' -bench CourseTests
+func BenchmarkCourseTests(b *testing.B) {
+	p := NewPostgres(openBenchDB(b))
+	courseID := seedBenchCourse(b, p)
+	filter := TestFilter{ListOptions: ListOptions{Sort: "created_at", Limit: MaxLimit}, CourseID: courseID}
+
+	b.Run("PerTestQuestionIDs", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			rows, err := p.DB.Query(`
+				SELECT `+TestColumns+`
+				FROM tests
+				WHERE course_id = $1 AND deleted_at IS NULL
+				ORDER BY created_at, id
+			`, courseID)
+			if err != nil {
+				b.Fatal(err)
+			}
+			var tests []models.Test
+			for rows.Next() {
+				var t models.Test
+				if err := rows.Scan(TestDest(&t)...); err != nil {
+					b.Fatal(err)
+				}
+				tests = append(tests, t)
+			}
+			rows.Close()
+			for j := range tests {
+				if tests[j].Questions, err = p.TestQuestionIDs(tests[j].ID); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if len(tests) != benchTests {
+				b.Fatalf("got %d tests, want %d", len(tests), benchTests)
+			}
+		}
+		b.ReportMetric(float64(1+benchTests), "queries/op")
+	})
+
+	b.Run("Aggregated", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tests, _, err := p.CourseTests(filter)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if len(tests) != benchTests || len(tests[0].Questions) != benchQuestions {
+				b.Fatalf("got %d tests with %d questions", len(tests), len(tests[0].Questions))
+			}
+		}
+		b.ReportMetric(1, "queries/op")
+	})
+}
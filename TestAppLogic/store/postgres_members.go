@@ -0,0 +1,115 @@
+package store
+
+import (
+	"database/sql"
+	"testapplogic/models"
+	"time"
+)
+
+// CourseMembers возвращает участников дисциплины: сначала преподавателей, затем студентов
+func (p *Postgres) CourseMembers(courseID int, role string) ([]models.CourseMember, error) {
+	rows, err := p.conn().Query(`
+		SELECT u.id, u.user_id_reference, COALESCE(u.full_name, ''), uc.role, uc.created_at
+		FROM user_courses uc
+		JOIN users u ON uc.user_id = u.id
+		WHERE uc.course_id = $1 AND ($2 = '' OR uc.role = $2)
+		ORDER BY uc.role DESC, u.full_name, u.id
+	`, courseID, role)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var members []models.CourseMember
+	for rows.Next() {
+		var m models.CourseMember
+		if err := rows.Scan(&m.UserID, &m.UserRef, &m.FullName, &m.Role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// EnrollUser записывает пользователя на дисциплину; false — он уже записан
+func (p *Postgres) EnrollUser(userID, courseID int, role string) (bool, error) {
+	res, err := p.conn().Exec(`
+		INSERT INTO user_courses (user_id, course_id, role, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, course_id) DO NOTHING
+	`, userID, courseID, role, time.Now())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// RemoveCourseMember исключает пользователя из дисциплины
+func (p *Postgres) RemoveCourseMember(userID, courseID int) error {
+	return p.execOne("DELETE FROM user_courses WHERE user_id = $1 AND course_id = $2", userID, courseID)
+}
+
+// inviteColumns — колонки приглашения в порядке inviteDest
+const inviteColumns = "code, course_id, COALESCE(created_by, 0), max_uses, uses, expires_at, created_at"
+
+// inviteDest возвращает адреса полей приглашения для Scan в порядке inviteColumns
+func inviteDest(inv *models.CourseInvite) []interface{} {
+	return []interface{}{&inv.Code, &inv.CourseID, &inv.CreatedBy, &inv.MaxUses, &inv.Uses, &inv.ExpiresAt, &inv.CreatedAt}
+}
+
+// CreateInvite сохраняет код приглашения
+func (p *Postgres) CreateInvite(inv *models.CourseInvite) error {
+	_, err := p.conn().Exec(`
+		INSERT INTO course_invites (code, course_id, created_by, max_uses, uses, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, inv.Code, inv.CourseID, inv.CreatedBy, inv.MaxUses, inv.Uses, inv.ExpiresAt, inv.CreatedAt)
+	return err
+}
+
+// CourseInvites возвращает коды приглашения дисциплины, новые первыми
+func (p *Postgres) CourseInvites(courseID int) ([]models.CourseInvite, error) {
+	rows, err := p.conn().Query(`
+		SELECT `+inviteColumns+`
+		FROM course_invites
+		WHERE course_id = $1
+		ORDER BY created_at DESC, code
+	`, courseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var invites []models.CourseInvite
+	for rows.Next() {
+		var inv models.CourseInvite
+		if err := rows.Scan(inviteDest(&inv)...); err != nil {
+			return nil, err
+		}
+		invites = append(invites, inv)
+	}
+	return invites, rows.Err()
+}
+
+// DeleteInvite отзывает код приглашения дисциплины
+func (p *Postgres) DeleteInvite(courseID int, code string) error {
+	return p.execOne("DELETE FROM course_invites WHERE code = $1 AND course_id = $2", code, courseID)
+}
+
+// LockInvite возвращает приглашение на неудалённую дисциплину и блокирует его
+func (p *Postgres) LockInvite(code string) (models.CourseInvite, error) {
+	var inv models.CourseInvite
+	err := p.conn().QueryRow(`
+		SELECT `+inviteColumns+`
+		FROM course_invites
+		WHERE code = $1 AND course_id IN (SELECT id FROM courses WHERE deleted_at IS NULL)
+		FOR UPDATE
+	`, code).Scan(inviteDest(&inv)...)
+	if err == sql.ErrNoRows {
+		return inv, ErrNotFound
+	}
+	return inv, err
+}
+
+// UseInvite засчитывает использование приглашения
+func (p *Postgres) UseInvite(code string) error {
+	return p.execOne("UPDATE course_invites SET uses = uses + 1 WHERE code = $1", code)
+}
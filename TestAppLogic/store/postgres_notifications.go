@@ -0,0 +1,92 @@
+package store
+
+import (
+	"database/sql"
+	"sort"
+	"testapplogic/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Notify создаёт уведомление для пользователя
+func (p *Postgres) Notify(userID int, kind, message string) error {
+	_, err := p.conn().Exec(`
+		INSERT INTO notifications (user_id, type, message, created_at)
+		VALUES ($1, $2, $3, $4)
+	`, userID, kind, message, time.Now())
+	return err
+}
+
+// NotifyCourseStudents создаёт уведомление для всех студентов дисциплины
+func (p *Postgres) NotifyCourseStudents(courseID int, kind, message string) error {
+	_, err := p.conn().Exec(`
+		INSERT INTO notifications (user_id, type, message, created_at)
+		SELECT user_id, $2, $3, $4
+		FROM user_courses
+		WHERE course_id = $1 AND role = 'student'
+	`, courseID, kind, message, time.Now())
+	return err
+}
+
+// DeliverNotifications возвращает старейшие непрочитанные уведомления пользователя
+// и отмечает их доставленными
+func (p *Postgres) DeliverNotifications(userID, limit int) ([]models.Notification, error) {
+	rows, err := p.conn().Query(`
+		UPDATE notifications
+		SET delivered_at = COALESCE(delivered_at, $3)
+		WHERE id IN (
+			SELECT id FROM notifications
+			WHERE user_id = $1 AND is_read = false
+			ORDER BY created_at, id
+			LIMIT $2
+		)
+		RETURNING id, user_id, type, message, is_read, created_at
+	`, userID, limit, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var notifications []models.Notification
+	for rows.Next() {
+		var n models.Notification
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.Message, &n.IsRead, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	// UPDATE ... RETURNING не гарантирует порядок строк
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].ID < notifications[j].ID })
+	return notifications, rows.Err()
+}
+
+// ReadNotifications отмечает прочитанными уведомления из ids или все доставленные
+func (p *Postgres) ReadNotifications(userID int, ids []int) (int, error) {
+	now := time.Now()
+	var res sql.Result
+	var err error
+	if len(ids) > 0 {
+		res, err = p.conn().Exec(`
+			UPDATE notifications SET is_read = true, read_at = $3
+			WHERE user_id = $1 AND is_read = false AND id = ANY($2)
+		`, userID, pq.Array(ids), now)
+	} else {
+		res, err = p.conn().Exec(`
+			UPDATE notifications SET is_read = true, read_at = $2
+			WHERE user_id = $1 AND is_read = false AND delivered_at IS NOT NULL
+		`, userID, now)
+	}
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// ReadNotification отмечает прочитанным одно уведомление пользователя
+func (p *Postgres) ReadNotification(userID, id int) error {
+	return p.execOne(`
+		UPDATE notifications SET is_read = true, read_at = COALESCE(read_at, $3)
+		WHERE id = $1 AND user_id = $2
+	`, id, userID, time.Now())
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"testapplogic/models"
+
+	"github.com/lib/pq"
+)
+
+// TestColumns — список колонок теста в порядке TestDest
+const TestColumns = "id, name, course_id, kind, anonymous, active, allow_review, time_limit_seconds, opens_at, closes_at, max_attempts, cooldown_seconds, grading_policy, shuffle_questions, shuffle_options, created_at, deleted_at"
+
+// TestDest возвращает адреса полей теста для Scan в порядке TestColumns
+func TestDest(t *models.Test) []interface{} {
+	return []interface{}{&t.ID, &t.Name, &t.CourseID, &t.Kind, &t.Anonymous, &t.Active, &t.AllowReview,
+		&t.TimeLimit, &t.OpensAt, &t.ClosesAt, &t.MaxAttempts, &t.Cooldown, &t.GradingPolicy, &t.ShuffleQuestions, &t.ShuffleOptions, &t.CreatedAt, &t.DeletedAt}
+}
+
+// QuestionColumns возвращает список колонок вопроса в порядке QuestionDest
+func QuestionColumns(alias string) string {
+	p := ""
+	if alias != "" {
+		p = alias + "."
+	}
+	return p + "id, " + p + "course_id, " + p + "kind, " + p + "type, " + p + "text, " + p + "options, " +
+		p + "matches, " + p + "correct_answer, " + p + "tags, " + p + "created_at, " + p + "version, " + p + "deleted_at"
+}
+
+// QuestionDest возвращает адреса полей вопроса для Scan в порядке QuestionColumns
+func QuestionDest(q *models.Question) []interface{} {
+	return []interface{}{&q.ID, &q.CourseID, &q.Kind, &q.Type, &q.Text, pq.Array(&q.Options),
+		pq.Array(&q.Matches), NullableJSON{&q.CorrectAnswer}, pq.Array(&q.Tags), &q.CreatedAt, &q.Version, &q.DeletedAt}
+}
+
+// testQuestionColumns — колонки вопроса в составе теста в порядке testQuestionDest
+// для запроса вида questions q JOIN test_questions tq
+func testQuestionColumns() string {
+	return QuestionColumns("q") + ", tq.test_id, tq.position, tq.points"
+}
+
+// testQuestionDest возвращает адреса полей для Scan в порядке testQuestionColumns
+func testQuestionDest(q *models.Question) []interface{} {
+	return append(QuestionDest(q), &q.TestID, &q.Position, &q.Points)
+}
+
+// paperColumns — колонки вопроса варианта попытки в порядке paperDest. Содержимое вопроса
+// берётся из версии, которая выпала в попытке: для запроса вида attempt_questions aq
+// JOIN attempts a JOIN questions q JOIN question_versions v
+const paperColumns = "q.id, q.course_id, q.kind, v.type, v.text, v.options, v.matches, v.correct_answer, v.tags, q.created_at, v.version, q.deleted_at, " +
+	"a.test_id, aq.position, aq.points, aq.option_order"
+
+// paperDest возвращает адреса полей для Scan в порядке paperColumns;
+// порядок вариантов сканируется в order
+func paperDest(q *models.Question, order *pq.Int64Array) []interface{} {
+	return append(testQuestionDest(q), order)
+}
+
+// paperOrder переводит сохранённый порядок вариантов в []int. Если порядок не задан
+// или вопрос с тех пор изменил число вариантов, варианты показываются как есть
+func paperOrder(values pq.Int64Array, options int) []int {
+	if len(values) == 0 || len(values) != options {
+		return nil
+	}
+	out := make([]int, len(values))
+	for i, v := range values {
+		out[i] = int(v)
+	}
+	return out
+}
+
+// attemptColumns — колонки попытки в порядке attemptDest для запроса к attempts a
+const attemptColumns = "a.id, COALESCE(a.user_id, 0), a.test_id, a.finished, a.score, a.max_score, a.percentage, a.expires_at, a.completed_at, a.created_at"
+
+// attemptDest возвращает адреса полей попытки для Scan в порядке attemptColumns
+func attemptDest(a *models.Attempt) []interface{} {
+	return []interface{}{&a.ID, &a.UserID, &a.TestID, &a.Finished, &a.Score, &a.MaxScore, &a.Percentage, &a.ExpiresAt, &a.CompletedAt, &a.CreatedAt}
+}
+
+// answerColumns — колонки ответа в порядке answerDest для запроса к answers ans
+const answerColumns = "ans.id, ans.attempt_id, ans.question_id, ans.answer, ans.is_correct, ans.revision, ans.created_at, ans.updated_at"
+
+// answerDest возвращает адреса полей ответа для Scan в порядке answerColumns
+func answerDest(a *models.Answer) []interface{} {
+	return []interface{}{&a.ID, &a.AttemptID, &a.QuestionID, NullableJSON{&a.Answer}, &a.IsCorrect, &a.Revision, &a.CreatedAt, &a.UpdatedAt}
+}
+
+// jsonArg подготавливает JSON для записи в колонку JSONB: pq передаёт []byte как bytea,
+// поэтому JSON отправляется строкой, а пустое значение — как NULL
+func jsonArg(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
+
+// NullableJSON сканирует JSONB, который может быть NULL, в json.RawMessage
+type NullableJSON struct {
+	Dest *json.RawMessage
+}
+
+// Scan реализует sql.Scanner
+func (n NullableJSON) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*n.Dest = nil
+	case []byte:
+		*n.Dest = append(json.RawMessage(nil), v...)
+	case string:
+		*n.Dest = json.RawMessage(v)
+	default:
+		return fmt.Errorf("cannot scan %T into json.RawMessage", src)
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+// Package store отделяет обработчики от хранилища: обработчики и проверки доступа
+// работают с интерфейсами, а реализация выбирается при запуске
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"testapplogic/models"
+	"time"
+)
+
+var (
+	// ErrNotFound возвращается, когда запись не найдена или удалена
+	ErrNotFound = errors.New("not found")
+	// ErrQuestionLinked возвращается при повторном добавлении вопроса в тест
+	ErrQuestionLinked = errors.New("question is already in the test")
+	// ErrNestedTx возвращается при попытке начать транзакцию внутри транзакции
+	ErrNestedTx = errors.New("transaction is already started")
+)
+
+// CourseStore хранит дисциплины и записи на них
+type CourseStore interface {
+	// Courses возвращает страницу неудалённых дисциплин по фильтру и курсор следующей
+	// страницы; на последней странице курсор равен nil
+	Courses(f CourseFilter) ([]models.Course, *Cursor, error)
+	// Course возвращает неудалённую дисциплину
+	Course(id int) (models.Course, error)
+	// CreateCourse создаёт дисциплину и записывает на неё преподавателя c.TeacherID
+	CreateCourse(c *models.Course) error
+	// HasCourseAccess проверяет, ведёт ли пользователь дисциплину или записан на неё
+	HasCourseAccess(userID, courseID int) (bool, error)
+	// IsCourseMember проверяет, записан ли пользователь на дисциплину
+	IsCourseMember(userID, courseID int) (bool, error)
+	// IsCourseTeacher проверяет, ведёт ли пользователь дисциплину, в том числе удалённую:
+	// он её владелец или записан на неё преподавателем
+	IsCourseTeacher(userID, courseID int) (bool, error)
+	// MemberCourses возвращает неудалённые дисциплины пользователя с его ролью,
+	// упорядоченные по названию
+	MemberCourses(userID int) ([]MemberCourse, error)
+	// UpdateCourse меняет название и описание неудалённой дисциплины c.ID
+	// и заполняет остальные поля c
+	UpdateCourse(c *models.Course) error
+	// DeleteCourse помечает удалённой дисциплину вместе с её неудалёнными тестами
+	DeleteCourse(id int, at time.Time) error
+	// DeletedCourse возвращает удалённую дисциплину
+	DeletedCourse(id int) (models.Course, error)
+	// RestoreCourse восстанавливает удалённую дисциплину и тесты, удалённые вместе с ней
+	RestoreCourse(id int) (models.Course, error)
+}
+
+// MemberCourse — дисциплина вместе с ролью в ней пользователя
+type MemberCourse struct {
+	models.Course
+	Role string
+}
+
+// MemberStore хранит участников дисциплин и коды приглашения
+type MemberStore interface {
+	// CourseMembers возвращает участников дисциплины: сначала преподавателей, затем
+	// студентов, по имени. Непустой role оставляет участников с этой ролью
+	CourseMembers(courseID int, role string) ([]models.CourseMember, error)
+	// EnrollUser записывает пользователя на дисциплину; false — он уже записан.
+	// Уведомление о записи отправляет вызывающий
+	EnrollUser(userID, courseID int, role string) (bool, error)
+	// RemoveCourseMember исключает пользователя из дисциплины
+	RemoveCourseMember(userID, courseID int) error
+	// CreateInvite сохраняет код приглашения
+	CreateInvite(inv *models.CourseInvite) error
+	// CourseInvites возвращает коды приглашения дисциплины, новые первыми
+	CourseInvites(courseID int) ([]models.CourseInvite, error)
+	// DeleteInvite отзывает код приглашения дисциплины
+	DeleteInvite(courseID int, code string) error
+	// LockInvite возвращает приглашение на неудалённую дисциплину и в транзакции
+	// блокирует его до её конца, чтобы число использований не превысило лимит
+	LockInvite(code string) (models.CourseInvite, error)
+	// UseInvite засчитывает использование приглашения
+	UseInvite(code string) error
+}
+
+// TestStore хранит тесты и их состав
+type TestStore interface {
+	// Test возвращает неудалённый тест без списка вопросов
+	Test(id int) (models.Test, error)
+	// TestWithDeleted возвращает тест, в том числе удалённый
+	TestWithDeleted(id int) (models.Test, error)
+	// CourseTests возвращает страницу неудалённых тестов дисциплины и курсор следующей
+	// страницы. Тесты приходят с ID вопросов, размером варианта и статистикой попыток
+	CourseTests(f TestFilter) ([]models.Test, *Cursor, error)
+	// AttemptedTest находит неудалённый тест, по которому у пользователя есть попытки,
+	// по подстроке названия; из нескольких выбирается созданный последним
+	AttemptedTest(userID int, name string) (models.Test, error)
+	// TestQuestionIDs возвращает ID неудалённых вопросов теста в порядке теста
+	TestQuestionIDs(testID int) ([]int, error)
+	// CreateTest создаёт тест и заполняет t.ID
+	CreateTest(t *models.Test) error
+	// UpdateTest сохраняет изменяемые настройки неудалённого теста t.ID: название,
+	// разбор, расписание, пересдачи и перемешивание. Остальные поля t заполняются
+	UpdateTest(t *models.Test) error
+	// SetTestActive открывает или закрывает тест и сообщает, изменилось ли состояние
+	SetTestActive(id int, active bool) (bool, error)
+	// SetTestReview разрешает или запрещает разбор попыток
+	SetTestReview(id int, allow bool) error
+	// SetTestSchedule задаёт ограничение по времени и окно доступности
+	SetTestSchedule(id int, timeLimit *int, opensAt, closesAt *time.Time) error
+	// SetTestPolicy задаёт ограничения на пересдачу и правило итоговой оценки
+	SetTestPolicy(id int, maxAttempts, cooldown *int, policy string) error
+	// SetTestShuffle задаёт перемешивание вопросов и вариантов
+	SetTestShuffle(id int, questions, options bool) error
+	// DeleteTest помечает неудалённый тест удалённым
+	DeleteTest(id int, at time.Time) error
+	// RestoreTest восстанавливает удалённый тест
+	RestoreTest(id int) (models.Test, error)
+	// TestQuestions возвращает неудалённые вопросы теста в порядке теста
+	// вместе с позициями и весами
+	TestQuestions(testID int) ([]models.Question, error)
+	// LinkQuestion добавляет вопрос банка в тест на позицию position (с единицы)
+	// и сдвигает следующие вопросы; position <= 0 — в конец теста. Возвращает итоговую
+	// позицию или ErrQuestionLinked, если вопрос уже в тесте
+	LinkQuestion(testID, questionID, position int, points float64) (int, error)
+	// SetTestQuestions задаёт состав теста целиком в порядке questions;
+	// остальные вопросы убираются из теста
+	SetTestQuestions(testID int, questions []TestQuestion) error
+	// UnlinkQuestion убирает вопрос из теста и сдвигает следующие вопросы
+	UnlinkQuestion(testID, questionID int) error
+	// TestPools возвращает пулы теста
+	TestPools(testID int) ([]models.QuestionPool, error)
+	// SetTestPools заменяет пулы теста и заполняет их ID
+	SetTestPools(testID int, pools []models.QuestionPool) error
+}
+
+// TestQuestion — вопрос в составе теста с его весом
+type TestQuestion struct {
+	QuestionID int
+	Points     float64
+}
+
+// QuestionStore хранит вопросы банка и их версии
+type QuestionStore interface {
+	// Question возвращает текущую версию вопроса, в том числе удалённого
+	Question(id int) (models.Question, error)
+	// CourseQuestions возвращает страницу неудалённых вопросов банка дисциплины
+	// и курсор следующей страницы
+	CourseQuestions(f QuestionFilter) ([]models.Question, *Cursor, error)
+	// CreateQuestion сохраняет вопрос в банке первой версией и заполняет q.ID и q.Version
+	CreateQuestion(q *models.Question) error
+	// LockQuestion возвращает неудалённый вопрос и в транзакции блокирует его до её конца,
+	// чтобы номера версий не пересеклись
+	LockQuestion(id int) (models.Question, error)
+	// UpdateQuestion сохраняет содержимое q как новую версию вопроса q.ID
+	// и заполняет q сохранённым вопросом
+	UpdateQuestion(q *models.Question) error
+	// DeleteQuestion помечает неудалённый вопрос удалённым; связи с тестами остаются
+	DeleteQuestion(id int, at time.Time) error
+	// RestoreQuestion восстанавливает удалённый вопрос
+	RestoreQuestion(id int) (models.Question, error)
+	// QuestionVersions возвращает версии вопроса от первой к последней
+	QuestionVersions(id int) ([]models.QuestionVersion, error)
+	// BankQuestionID находит неудалённый вопрос банка с тем же видом, типом и текстом
+	BankQuestionID(courseID int, kind, questionType, text string) (int, error)
+	// PoolCandidates возвращает неудалённые вопросы банка с хотя бы одним из тегов,
+	// кроме вопросов из exclude, по возрастанию ID
+	PoolCandidates(courseID int, kind string, tags []string, exclude []int) ([]models.Question, error)
+	// PresentedQuestions возвращает вопросы, которые выдавались по тесту: текущий состав
+	// в порядке теста, затем вопросы из вариантов попыток
+	PresentedQuestions(testID int) ([]models.Question, error)
+}
+
+// PaperQuestion — вопрос варианта попытки в той версии, которая выпала студенту,
+// с весом и порядком показа вариантов. Order[i] — исходный индекс варианта,
+// показанного i-м; nil — варианты не перемешаны
+type PaperQuestion struct {
+	Question models.Question
+	Order    []int
+}
+
+// AttemptAnswers — завершённая попытка с текущими ответами в порядке их отправки
+// и ID вопросов её варианта
+type AttemptAnswers struct {
+	Attempt   models.Attempt
+	Answers   []models.Answer
+	Presented []int
+}
+
+// AttemptExport — попытка для выгрузки вместе с пользователем и ответами по ID вопроса
+type AttemptExport struct {
+	Attempt  models.Attempt
+	UserRef  string
+	FullName string
+	Answers  []models.Answer
+}
+
+// AttemptStore хранит попытки, их варианты и ответы
+type AttemptStore interface {
+	// Attempt возвращает попытку без варианта и ответов, в том числе попытку удалённого теста
+	Attempt(id int) (models.Attempt, error)
+	// LockAttempt возвращает попытку и в транзакции блокирует её до конца транзакции
+	LockAttempt(id int) (models.Attempt, error)
+	// LockUserTest в транзакции блокирует до её конца начало попыток пользователя по тесту
+	LockUserTest(testID, userID int) error
+	// HasActiveAttempt проверяет, есть ли у пользователя незавершённая попытка по тесту
+	HasActiveAttempt(userID, testID int) (bool, error)
+	// AttemptUsage возвращает число попыток пользователя по тесту и время, когда
+	// закончилась последняя из них; nil — попыток не было
+	AttemptUsage(userID, testID int) (int, *time.Time, error)
+	// CreateAttempt создаёт попытку и заполняет a.ID
+	CreateAttempt(a *models.Attempt) error
+	// SavePaper сохраняет вариант попытки в порядке показа. Вопросы сохраняются
+	// в версии Question.Version и с весом Question.Points
+	SavePaper(attemptID int, paper []PaperQuestion) error
+	// AttemptPaper возвращает вариант попытки в порядке показа
+	AttemptPaper(attemptID int) ([]PaperQuestion, error)
+	// PaperQuestion возвращает вопрос варианта попытки
+	PaperQuestion(attemptID, questionID int) (PaperQuestion, error)
+	// ActivePaperQuestion находит вопрос в варианте последней незавершённой попытки пользователя
+	ActivePaperQuestion(userID, questionID int) (PaperQuestion, error)
+	// HasQuestionAttempt проверяет, выпадал ли вопрос пользователю в одной из его попыток
+	HasQuestionAttempt(userID, questionID int) (bool, error)
+	// ActivePaper возвращает ID вопросов варианта незавершённой попытки пользователя
+	// по тесту; без такой попытки возвращается пустой список
+	ActivePaper(userID, testID int) ([]int, error)
+	// AttemptProgress возвращает число вопросов варианта и число вопросов с ответом
+	AttemptProgress(attemptID int) (total, answered int, err error)
+	// AttemptAnswers возвращает текущие ответы попытки по возрастанию ID вопроса
+	AttemptAnswers(attemptID int) ([]models.Answer, error)
+	// SaveAnswer сохраняет текущий ответ на вопрос попытки и записывает его версию в историю.
+	// Повторная отправка того же ответа ничего не меняет и возвращает сохранённый ответ
+	SaveAnswer(attemptID, questionID int, answer json.RawMessage, at time.Time) (models.Answer, error)
+	// AnswerRevisions возвращает историю ответов попытки по вопросам и версиям;
+	// questionID > 0 оставляет один вопрос
+	AnswerRevisions(attemptID, questionID int) ([]models.AnswerRevision, error)
+	// SetAnswerCorrect сохраняет результат проверки ответа
+	SetAnswerCorrect(answerID int, correct bool) error
+	// SaveAttemptResult завершает попытку r.AttemptID с баллами и временем из r
+	SaveAttemptResult(r *models.AttemptResult) error
+	// FinishAttempt завершает попытку без оценки
+	FinishAttempt(attemptID int, at time.Time) error
+	// FinishAnonymousAttempt завершает попытку анонимного опроса: отвязывает её
+	// от пользователя, огрубляет время попытки и ответов до дня и удаляет историю ответов
+	FinishAnonymousAttempt(attemptID int) error
+	// ExpiredAttempt возвращает ID незавершённой попытки с истёкшим временем, кроме
+	// попыток из skip; 0 — таких нет. В транзакции попытка блокируется до её конца,
+	// а попытки, заблокированные другими транзакциями, пропускаются
+	ExpiredAttempt(now time.Time, skip []int) (int, error)
+	// GradedAttempts возвращает оценённые попытки пользователя по тесту в порядке завершения
+	GradedAttempts(userID, testID int) ([]models.Attempt, error)
+	// StudentAttempts возвращает попытки студентов дисциплины по её тестам с проверкой
+	// ответов в порядке завершения
+	StudentAttempts(courseID int) ([]models.Attempt, error)
+	// FinishedAttempts возвращает завершённые попытки теста по возрастанию ID
+	// с ответами и вариантами
+	FinishedAttempts(testID int) ([]AttemptAnswers, error)
+	// EachTestAttempt передаёт fn попытки теста по возрастанию ID, читая их по одной
+	EachTestAttempt(testID int, fn func(AttemptExport) error) error
+	// HasSurveyResponse проверяет, проходил ли пользователь опрос
+	HasSurveyResponse(testID, userID int) (bool, error)
+	// AddSurveyParticipant отмечает, что пользователь прошёл опрос
+	AddSurveyParticipant(testID, userID int, at time.Time) error
+}
+
+// NotificationStore хранит уведомления пользователей
+type NotificationStore interface {
+	// Notify создаёт уведомление для пользователя
+	Notify(userID int, kind, message string) error
+	// NotifyCourseStudents создаёт уведомление для всех студентов дисциплины
+	NotifyCourseStudents(courseID int, kind, message string) error
+	// DeliverNotifications возвращает до limit старейших непрочитанных уведомлений
+	// пользователя по возрастанию ID и отмечает их доставленными
+	DeliverNotifications(userID, limit int) ([]models.Notification, error)
+	// ReadNotifications отмечает прочитанными уведомления из ids, а без ids — все
+	// доставленные, и возвращает их число
+	ReadNotifications(userID int, ids []int) (int, error)
+	// ReadNotification отмечает прочитанным одно уведомление пользователя
+	ReadNotification(userID, id int) error
+}
+
+// UserStore хранит пользователей сервиса
+type UserStore interface {
+	// EnsureUser находит пользователя по внешнему идентификатору или создаёт его студентом
+	EnsureUser(ref, fullName string) (int, error)
+	// UserExists проверяет, есть ли пользователь с таким ID
+	UserExists(id int) (bool, error)
+}
+
+// Store объединяет все хранилища сервиса
+type Store interface {
+	CourseStore
+	MemberStore
+	TestStore
+	QuestionStore
+	AttemptStore
+	NotificationStore
+	UserStore
+	// Begin начинает транзакцию. Внутри транзакции Begin возвращает ErrNestedTx
+	Begin() (Tx, error)
+	// Ping проверяет доступность хранилища
+	Ping() error
+}
+
+// Tx — хранилище внутри транзакции. После Commit вызов Rollback ничего не делает,
+// поэтому его можно откладывать через defer сразу после Begin
+type Tx interface {
+	Store
+	Commit() error
+	Rollback() error
+}